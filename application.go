@@ -0,0 +1,414 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// appCredentialsDirPrefix starts the name of the directory inside a backup
+// that a restore writes the new credentials of the target org's apps to
+const appCredentialsDirPrefix = "app_credentials_"
+
+// samlSignOnModes are the sign-on modes whose apps sign assertions with a
+// certificate of the org they live in
+var samlSignOnModes = map[string]bool{
+	"SAML_2_0":      true,
+	"SAML_1_1":      true,
+	"WS_FEDERATION": true,
+}
+
+// passwordSignOnModes are the sign-on modes whose apps can hold a password
+// Okta never returns
+var passwordSignOnModes = map[string]bool{
+	"AUTO_LOGIN":            true,
+	"BROWSER_PLUGIN":        true,
+	"BASIC_AUTH":            true,
+	"SECURE_PASSWORD_STORE": true,
+}
+
+// SuppliedAppCredentials are the OIDC client credentials an app keeps in the
+// target org instead of getting new ones, and the secrets of its provisioning
+// connection, which Okta never returns
+type SuppliedAppCredentials struct {
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// ProvisioningToken is the API token of a TOKEN provisioning connection
+	ProvisioningToken string `yaml:"provisioning_token"`
+	// ProvisioningClientID is the client of an OAUTH2 provisioning connection
+	ProvisioningClientID string `yaml:"provisioning_client_id"`
+}
+
+// LoadAppCredentials reads a YAML file of client credentials keyed by app
+// label, substituting ${ENV} references. Every referenced variable must be set.
+func LoadAppCredentials(filePath string) (map[string]SuppliedAppCredentials, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read app credentials file: %w", err)
+	}
+
+	var credentials map[string]SuppliedAppCredentials
+	if err := yaml.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("could not parse app credentials file %s: %w", filePath, err)
+	}
+
+	missing := make(map[string]bool)
+	for label, supplied := range credentials {
+		supplied.ClientID = expandEnvRefs(supplied.ClientID, missing)
+		supplied.ClientSecret = expandEnvRefs(supplied.ClientSecret, missing)
+		supplied.ProvisioningToken = expandEnvRefs(supplied.ProvisioningToken, missing)
+		supplied.ProvisioningClientID = expandEnvRefs(supplied.ProvisioningClientID, missing)
+		credentials[label] = supplied
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("app credentials file %s uses unset environment variables: %s",
+			filePath, strings.Join(sortedKeys(missing), ", "))
+	}
+
+	return credentials, nil
+}
+
+// AppCredentialsEntry is what the team owning one restored app needs to
+// reconnect it
+type AppCredentialsEntry struct {
+	Label        string `json:"label"`
+	SignOnMode   string `json:"signOnMode"`
+	OldID        string `json:"oldId"`
+	NewID        string `json:"newId"`
+	ClientID     string `json:"clientId,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+	Metadata     string `json:"metadata,omitempty"`
+	Certificate  string `json:"certificate,omitempty"`
+	KeyID        string `json:"keyId,omitempty"`
+	KeyExpiresAt string `json:"keyExpiresAt,omitempty"`
+	// UpdatedInPlace is set on apps the target org already had
+	UpdatedInPlace bool     `json:"updatedInPlace,omitempty"`
+	Notes          []string `json:"notes,omitempty"`
+}
+
+// AppCredentialsReport lists the client IDs, secrets, IdP metadata and
+// signing certificates of the apps a restore created. It holds secrets, so
+// it is only readable by its owner.
+type AppCredentialsReport struct {
+	OrgName string                `json:"orgName"`
+	Apps    []AppCredentialsEntry `json:"apps"`
+	Dir     string                `json:"-"`
+}
+
+func NewAppCredentialsReport(inputDir, orgName string) *AppCredentialsReport {
+	return &AppCredentialsReport{
+		OrgName: orgName,
+		Dir:     filepath.Join(inputDir, appCredentialsDirPrefix+orgName),
+	}
+}
+
+func (r *AppCredentialsReport) filePath() string {
+	return filepath.Join(r.Dir, "report.json")
+}
+
+// Load reads the report of an earlier restore into the same org, so a rerun
+// adds to it
+func (r *AppCredentialsReport) Load() error {
+	data, err := os.ReadFile(r.filePath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading app credentials report: %w", err)
+	}
+	return json.Unmarshal(data, r)
+}
+
+// Add records an app, replacing an earlier entry for the same new ID
+func (r *AppCredentialsReport) Add(entry AppCredentialsEntry) {
+	for i, existing := range r.Apps {
+		if existing.NewID == entry.NewID {
+			r.Apps[i] = entry
+			return
+		}
+	}
+	r.Apps = append(r.Apps, entry)
+}
+
+// find returns the entry for an app, or nil if the report has none
+func (r *AppCredentialsReport) find(newID string) *AppCredentialsEntry {
+	for i := range r.Apps {
+		if r.Apps[i].NewID == newID {
+			return &r.Apps[i]
+		}
+	}
+	return nil
+}
+
+// Note adds a note to the entry for an app, unless it already has it
+func (r *AppCredentialsReport) Note(newID, note string) {
+	entry := r.find(newID)
+	if entry == nil {
+		return
+	}
+	for _, existing := range entry.Notes {
+		if existing == note {
+			return
+		}
+	}
+	entry.Notes = append(entry.Notes, note)
+}
+
+func (r *AppCredentialsReport) Save() error {
+	if len(r.Apps) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(r.Dir, 0700); err != nil {
+		return fmt.Errorf("could not create directory %s: %w", r.Dir, err)
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling app credentials report: %w", err)
+	}
+	return os.WriteFile(r.filePath(), data, 0600)
+}
+
+// Print summarizes the report, leaving the secrets in the file
+func (r *AppCredentialsReport) Print() {
+	if len(r.Apps) == 0 {
+		return
+	}
+
+	fmt.Printf("Application credentials (secrets are in %s):\n", r.filePath())
+	for _, entry := range r.Apps {
+		fmt.Printf("  %s (%s) %s -> %s\n", entry.Label, entry.SignOnMode, entry.OldID, entry.NewID)
+		if entry.ClientID != "" {
+			fmt.Printf("      client ID: %s\n", entry.ClientID)
+		}
+		if entry.Metadata != "" {
+			fmt.Printf("      IdP metadata: %s\n", entry.Metadata)
+		}
+		if entry.Certificate != "" {
+			fmt.Printf("      signing certificate: %s\n", entry.Certificate)
+		}
+		if entry.KeyID != "" {
+			fmt.Printf("      signing key: %s, valid until %s\n", entry.KeyID, entry.KeyExpiresAt)
+		}
+		for _, note := range entry.Notes {
+			fmt.Printf("      %s\n", note)
+		}
+	}
+}
+
+// prepareApplication readies a backed up app for creation in another org and
+// returns notes for the credentials report. OIDC apps get new client
+// credentials unless some were supplied, and SAML and WS-Fed apps drop the
+// signing key of the old org so Okta generates a new one.
+func prepareApplication(app map[string]interface{}, supplied map[string]SuppliedAppCredentials) []string {
+	signOnMode, _ := app["signOnMode"].(string)
+	var notes []string
+
+	switch {
+	case signOnMode == "OPENID_CONNECT":
+		if credentials := supplied[objectLabel(app)]; credentials.ClientID != "" || credentials.ClientSecret != "" {
+			if credentials.ClientID != "" {
+				setJSONPath(app, "credentials.oauthClient.client_id", credentials.ClientID)
+			}
+			if credentials.ClientSecret != "" {
+				setJSONPath(app, "credentials.oauthClient.client_secret", credentials.ClientSecret)
+			}
+			notes = append(notes, "client credentials taken from the app credentials file")
+		} else {
+			deleteJSONPath(app, "credentials.oauthClient.client_id")
+			deleteJSONPath(app, "credentials.oauthClient.client_secret")
+			notes = append(notes, "new client credentials generated, update the app's configuration")
+		}
+	case samlSignOnModes[signOnMode]:
+		deleteJSONPath(app, "credentials.signing.kid")
+		notes = append(notes, "new signing certificate generated, give the service provider the new IdP metadata")
+	case passwordSignOnModes[signOnMode]:
+		if scheme, _ := lookupJSONPath(app, "credentials.scheme"); scheme == "SHARED_USERNAME_AND_PASSWORD" {
+			notes = append(notes, "the shared password is not in the backup, set it again in the Admin Console")
+		}
+	}
+
+	return notes
+}
+
+// restoreApplication creates an app from a backup file with the handling its
+// sign-on mode needs, and records its new credentials in the report
+func restoreApplication(cfg *Config, filePath, oldID string, opts *RestoreOptions) (string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", filePath, err)
+	}
+
+	var app map[string]interface{}
+	if err := json.Unmarshal(data, &app); err != nil {
+		return "", fmt.Errorf("error parsing %s: %w", filePath, err)
+	}
+
+	notes := prepareApplication(app, opts.appCredentials)
+
+	tmpPath, err := writeTempObject(app)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpPath)
+
+	created, err := createResource(cfg, "application", tmpPath)
+	if err != nil {
+		return "", err
+	}
+
+	newID, ok := created["id"].(string)
+	if !ok {
+		return "", fmt.Errorf("response does not contain ID field")
+	}
+
+	signOnMode, _ := app["signOnMode"].(string)
+	entry := AppCredentialsEntry{Label: objectLabel(app), SignOnMode: signOnMode, OldID: oldID, NewID: newID, Notes: notes}
+
+	switch {
+	case signOnMode == "OPENID_CONNECT":
+		clientID, _ := lookupJSONPath(created, "credentials.oauthClient.client_id")
+		clientSecret, _ := lookupJSONPath(created, "credentials.oauthClient.client_secret")
+		entry.ClientID, _ = clientID.(string)
+		entry.ClientSecret, _ = clientSecret.(string)
+
+		authMethod, _ := lookupJSONPath(created, "credentials.oauthClient.token_endpoint_auth_method")
+		if method, _ := authMethod.(string); strings.HasPrefix(method, "client_secret") && entry.ClientSecret == "" {
+			entry.Notes = append(entry.Notes, "Okta did not return the client secret, read it in the Admin Console")
+		}
+	case samlSignOnModes[signOnMode]:
+		exportSAMLCredentials(cfg, created, &entry, opts.appReport.Dir)
+	}
+
+	if note := uploadAppLogo(cfg, oldID, newID, opts); note != "" {
+		entry.Notes = append(entry.Notes, note)
+	}
+
+	opts.appReport.Add(entry)
+	return newID, nil
+}
+
+// updateApplication replaces an app the target org already has, keeping the
+// target's own credentials so its clients and service providers keep working
+func updateApplication(cfg *Config, liveID, filePath, oldID string, opts *RestoreOptions) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", filePath, err)
+	}
+
+	var app map[string]interface{}
+	if err := json.Unmarshal(data, &app); err != nil {
+		return fmt.Errorf("error parsing %s: %w", filePath, err)
+	}
+
+	output, err := RunOktaCli(cfg, "application", "get", "--appId", liveID)
+	if err != nil {
+		return fmt.Errorf("could not read application %s: %w", liveID, err)
+	}
+	var live map[string]interface{}
+	if err := json.Unmarshal(output, &live); err != nil {
+		return fmt.Errorf("error parsing application %s: %w", liveID, err)
+	}
+
+	if credentials, ok := live["credentials"]; ok {
+		app["credentials"] = credentials
+	} else {
+		delete(app, "credentials")
+	}
+
+	tmpPath, err := writeTempObject(app)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	if _, err := RunOktaCli(cfg, "application", "replace", "--appId", liveID, "--restore-from", tmpPath); err != nil {
+		return err
+	}
+
+	signOnMode, _ := app["signOnMode"].(string)
+	notes := []string{"updated in place, its credentials are unchanged"}
+	if note := uploadAppLogo(cfg, oldID, liveID, opts); note != "" {
+		notes = append(notes, note)
+	}
+	opts.appReport.Add(AppCredentialsEntry{
+		Label:          objectLabel(app),
+		SignOnMode:     signOnMode,
+		OldID:          oldID,
+		NewID:          liveID,
+		Notes:          notes,
+		UpdatedInPlace: true,
+	})
+	return nil
+}
+
+// exportSAMLCredentials writes the IdP metadata and signing certificate of a
+// restored SAML or WS-Fed app for its service provider, noting what failed
+func exportSAMLCredentials(cfg *Config, app map[string]interface{}, entry *AppCredentialsEntry, dir string) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		entry.Notes = append(entry.Notes, fmt.Sprintf("could not create %s: %v", dir, err))
+		return
+	}
+
+	if entry.SignOnMode == "SAML_2_0" {
+		output, err := RunOktaCli(cfg, "applicationSSO", "previewSAMLmetadataForApplication", "--appId", entry.NewID)
+		if err != nil {
+			entry.Notes = append(entry.Notes, fmt.Sprintf("could not export the IdP metadata: %v", err))
+		} else {
+			metadata := string(output)
+			var quoted string
+			if err := json.Unmarshal(output, &quoted); err == nil {
+				metadata = quoted
+			}
+
+			path := filepath.Join(dir, entry.NewID+"-metadata.xml")
+			if err := os.WriteFile(path, []byte(metadata), 0644); err != nil {
+				entry.Notes = append(entry.Notes, fmt.Sprintf("could not write the IdP metadata: %v", err))
+			} else {
+				entry.Metadata = path
+			}
+		}
+	}
+
+	kid, _ := lookupJSONPath(app, "credentials.signing.kid")
+	keys, err := RunOktaCliList(cfg, "applicationCredentials", "listApplicationKeys", "--appId", entry.NewID)
+	if err != nil {
+		entry.Notes = append(entry.Notes, fmt.Sprintf("could not read the signing certificate: %v", err))
+		return
+	}
+	for _, key := range keys {
+		if kid != nil && key["kid"] != kid {
+			continue
+		}
+		path := filepath.Join(dir, entry.NewID+"-signing.pem")
+		if err := writeCertificatePEM(path, key); err != nil {
+			entry.Notes = append(entry.Notes, fmt.Sprintf("could not write the signing certificate: %v", err))
+		} else {
+			entry.Certificate = path
+		}
+		return
+	}
+	entry.Notes = append(entry.Notes, "the new signing certificate was not found")
+}
+
+// writeCertificatePEM writes the first certificate of a JSON Web Key's x5c
+// chain as PEM
+func writeCertificatePEM(path string, key map[string]interface{}) error {
+	chain, _ := key["x5c"].([]interface{})
+	if len(chain) == 0 {
+		return fmt.Errorf("key %v has no certificate", key["kid"])
+	}
+	encoded, _ := chain[0].(string)
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("key %v has an invalid certificate: %w", key["kid"], err)
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
@@ -1,15 +1,55 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
+// BackupOptions holds the optional settings for a backup
+type BackupOptions struct {
+	// Filter limits the backup to matching resource types
+	Filter ResourceFilter
+	// ListFilters narrow the objects listed for a resource type, see ListFilter
+	ListFilters []string
+	// Incremental builds the backup on the previous snapshot, fetching only
+	// what changed since it was taken
+	Incremental bool
+	// Base is the snapshot an incremental backup builds on; by default the
+	// newest snapshot of the org next to the output directory
+	Base string
+	// NoHistory treats the backup as a one-off copy: it is not compared with
+	// earlier snapshots, so no tombstones are written and nothing is archived
+	NoHistory bool
+}
+
 // PerformBackup performs the backup operation using the okta-cli-client
-func PerformBackup(cfg *Config, outputDir string) error {
+func PerformBackup(cfg *Config, outputDir string, opts *BackupOptions) error {
+	manifest := &Manifest{
+		OrgName:    cfg.OrgName,
+		OktaDomain: cfg.OktaDomain,
+		StartedAt:  time.Now().UTC(),
+	}
+	
+	var incremental *incrementalBackup
+	if opts.Incremental {
+		if len(opts.ListFilters) > 0 {
+			return fmt.Errorf("--filter cannot be combined with --incremental")
+		}
+		
+		var err error
+		incremental, outputDir, err = prepareIncrementalBackup(cfg, opts, outputDir)
+		if err != nil {
+			return err
+		}
+		manifest.Incremental = true
+		manifest.Base = incremental.base.Dir
+	}
+	
 	// Set default output directory if not specified
 	if outputDir == "" {
 		home, err := os.UserHomeDir()
@@ -17,21 +57,75 @@ func PerformBackup(cfg *Config, outputDir string) error {
 			return fmt.Errorf("error getting user home directory: %w", err)
 		}
 		outputDir = filepath.Join(home, ".okta", cfg.OrgName)
+		if len(opts.ListFilters) > 0 {
+			outputDir = fmt.Sprintf("%s-filtered-%s", outputDir, time.Now().UTC().Format("20060102T150405"))
+		}
+	}
+	if len(opts.ListFilters) > 0 {
+		if err := checkFilteredOutputDir(cfg, outputDir); err != nil {
+			return err
+		}
 	}
 	
 	// Get backup config
-	backupConfig := GetBackupConfig()
+	backupConfig := GetBackupConfig().Filter(&opts.Filter)
+	
+	listFilters, err := ParseListFilters(opts.ListFilters)
+	if err != nil {
+		return err
+	}
+	manifest.ListFilters = opts.ListFilters
+	
+	var base *Manifest
+	if incremental != nil {
+		base = incremental.base
+	}
+	history := &snapshotHistory{}
+	if !opts.NoHistory {
+		history = loadSnapshotHistory(cfg, backupConfig, outputDir, base)
+		if err := history.keepPrevious(outputDir); err != nil {
+			return err
+		}
+	}
 	
 	// Process first pass resources (resources that don't require IDs)
 	fmt.Println("Backing up first pass resources...")
 	for _, resource := range backupConfig.FirstPassResources {
 		fmt.Printf("Backing up %s using %s command...\n", resource.Name, resource.ListCommand)
 		
-		cmd := exec.Command("okta-cli-client", PrepareOktaCliArgs(cfg, resource.Name, resource.ListCommand, "--batch-backup", "--backup-dir", outputDir)...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		if filters, ok := listFilters[resource.objectType()]; ok {
+			if err := backupFilteredResource(cfg, resource, filters, outputDir); err != nil {
+				fmt.Printf("Warning: Failed to execute filtered %s %s backup: %v\n", resource.Name, resource.ListCommand, err)
+			}
+			continue
+		}
 		
-		if err := cmd.Run(); err != nil {
+		if incremental != nil && incremental.handles(resource) {
+			if err := incremental.backupChanged(cfg, resource, outputDir); err != nil {
+				fmt.Printf("Warning: Failed to execute incremental %s %s backup: %v\n", resource.Name, resource.ListCommand, err)
+			}
+			continue
+		}
+		
+		fetch := func() error {
+			if len(resource.ListTypes) > 0 {
+				return backupTypedResource(cfg, resource, outputDir)
+			}
+			cmd := exec.Command("okta-cli-client", PrepareOktaCliArgs(cfg, resource.Name, resource.ListCommand, "--batch-backup", "--backup-dir", outputDir)...)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			return cmd.Run()
+		}
+		
+		if incremental != nil {
+			err = incremental.fullFetch(resource, outputDir, fetch)
+		} else {
+			history.clearResource(resource, outputDir)
+			if err = fetch(); err != nil {
+				history.restoreResource(resource, outputDir)
+			}
+		}
+		if err != nil {
 			fmt.Printf("Warning: Failed to execute %s %s backup: %v\n", resource.Name, resource.ListCommand, err)
 			// Continue with next resource rather than failing the entire backup
 			continue
@@ -56,18 +150,67 @@ func PerformBackup(cfg *Config, outputDir string) error {
 	
 	// Process second pass resources (resources that require IDs from first pass)
 	fmt.Println("Backing up second pass resources...")
-	if err := backupSecondPassResources(cfg, backupConfig, outputDir); err != nil {
+	if incremental != nil {
+		incremental.pruneSecondPass(backupConfig, outputDir)
+	}
+	if err := backupSecondPassResources(cfg, backupConfig, outputDir, incremental); err != nil {
 		fmt.Printf("Warning: Error during second pass resources backup: %v\n", err)
 	}
+	pruneOrphanedChildren(backupConfig, outputDir)
+	
+	// Logos are only refreshed along with the apps. An incremental backup
+	// that leaves the apps out keeps the ones copied from its base.
+	if backupConfig.Has("application/lists") {
+		fmt.Println("Backing up custom application logos...")
+		logos, err := backupAppLogos(outputDir)
+		if err != nil {
+			fmt.Printf("Warning: Failed to back up application logos: %v\n", err)
+		}
+		manifest.Logos = logos
+	} else if incremental != nil {
+		manifest.Logos = incremental.base.Logos
+	}
+	
+	if incremental != nil {
+		manifest.Deleted = incremental.deleted
+	}
+	
+	switch {
+	case opts.NoHistory:
+	case history.previous == nil:
+		fmt.Println("No previous snapshot, skipping deletion tracking")
+	case len(opts.ListFilters) > 0 || len(history.previous.ListFilters) > 0:
+		fmt.Println("Filtered snapshots are not compared, skipping deletion tracking")
+	default:
+		fmt.Printf("Comparing with previous snapshot %s...\n", history.previous.Dir)
+		added, err := history.writeTombstones(backupConfig, outputDir, manifest.StartedAt)
+		if err != nil {
+			fmt.Printf("Warning: could not write tombstones: %v\n", err)
+		} else {
+			fmt.Printf("Recorded %d new tombstones\n", added)
+		}
+	}
+	manifest.Dir = outputDir
+	manifest.CompletedAt = time.Now().UTC()
+	if err := WriteManifest(manifest); err != nil {
+		fmt.Printf("Warning: could not write manifest: %v\n", err)
+	}
 	
 	fmt.Println("Backup completed successfully!")
 	return nil
 }
 
 // backupSecondPassResources handles the backup of resources that depend on IDs from first pass resources
-func backupSecondPassResources(cfg *Config, config *BackupConfig, outputDir string) error {
+func backupSecondPassResources(cfg *Config, config *BackupConfig, outputDir string, incremental *incrementalBackup) error {
 	for _, resource := range config.SecondPassResources {
-		sourceDir := filepath.Join(outputDir, resource.SourceIDDir, "lists")
+		if resource.SourceListCommand != "" {
+			if err := backupNestedChildObjects(cfg, resource, outputDir); err != nil {
+				fmt.Printf("Warning: Failed to back up %s %s: %v\n", resource.Name, resource.ListCommand, err)
+			}
+			continue
+		}
+		
+		sourceDir := filepath.Join(outputDir, strings.ToLower(resource.SourceIDDir), "lists")
 		
 		if _, err := os.Stat(sourceDir); os.IsNotExist(err) {
 			fmt.Printf("Warning: Source directory %s not found for %s, skipping...\n", 
@@ -88,18 +231,38 @@ func backupSecondPassResources(cfg *Config, config *BackupConfig, outputDir stri
 		
 		fmt.Printf("Found %d IDs for %s in %s\n", len(ids), resource.Name, sourceDir)
 		
+		var parents map[string]map[string]interface{}
+		if len(resource.SourceTypes) > 0 || resource.ProvisioningOnly {
+			if parents, err = readResourceObjects(sourceDir); err != nil {
+				fmt.Printf("Warning: Failed to read %s: %v\n", sourceDir, err)
+				continue
+			}
+		}
+		
 		paramFlag := getParameterFlagForResource(resource.Name)
 		
 		for _, id := range ids {
+			if !incremental.needsSecondPass(resource, id) {
+				continue
+			}
+			if parents != nil && !resource.appliesTo(parents[id]) {
+				continue
+			}
+			
 			fmt.Printf("Backing up %s for %s ID %s using %s command...\n", 
 				resource.Name, resource.SourceIDDir, id, resource.ListCommand)
 			
-			cmd := exec.Command("okta-cli-client", PrepareOktaCliArgs(cfg, resource.Name, resource.ListCommand, 
-				fmt.Sprintf("--%s", paramFlag), id, "--batch-backup", "--backup-dir", outputDir)...)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
+			if resource.NoBatchBackup {
+				err = backupChildObjects(cfg, resource, id, outputDir)
+			} else {
+				cmd := exec.Command("okta-cli-client", PrepareOktaCliArgs(cfg, resource.Name, resource.ListCommand, 
+					fmt.Sprintf("--%s", paramFlag), id, "--batch-backup", "--backup-dir", outputDir)...)
+				cmd.Stdout = os.Stdout
+				cmd.Stderr = os.Stderr
+				err = cmd.Run()
+			}
 			
-			if err := cmd.Run(); err != nil {
+			if err != nil {
 				fmt.Printf("Warning: Failed to execute %s %s backup for ID %s: %v\n", 
 					resource.Name, resource.ListCommand, id, err)
 				continue
@@ -110,6 +273,54 @@ func backupSecondPassResources(cfg *Config, config *BackupConfig, outputDir stri
 	return nil
 }
 
+// pruneOrphanedChildren removes the second pass data of parents that are no
+// longer in the snapshot, which a backup written over an earlier snapshot or
+// built on a base would otherwise carry forward. Entries whose parents were
+// not backed up are left alone.
+func pruneOrphanedChildren(config *BackupConfig, outputDir string) {
+	for _, resource := range config.SecondPassResources {
+		parentDir := filepath.Join(outputDir, strings.ToLower(resource.SourceIDDir), "lists")
+		parentDirs := []string{parentDir}
+		if resource.SourceListCommand != "" {
+			parentDir = filepath.Join(outputDir, strings.ToLower(resource.SourceIDDir), resource.SourceListCommand)
+			grandparents, err := os.ReadDir(parentDir)
+			if err != nil {
+				continue
+			}
+			parentDirs = nil
+			for _, grandparent := range grandparents {
+				if grandparent.IsDir() {
+					parentDirs = append(parentDirs, filepath.Join(parentDir, grandparent.Name()))
+				}
+			}
+		}
+		
+		parents := make(map[string]bool)
+		found := false
+		for _, dir := range parentDirs {
+			ids, err := getResourceIDsFromDirectory(dir)
+			if err != nil {
+				continue
+			}
+			found = true
+			for _, id := range ids {
+				parents[id] = true
+			}
+		}
+		if !found && resource.SourceListCommand == "" {
+			continue
+		}
+		
+		resourceDir := filepath.Join(outputDir, strings.ToLower(resource.Name), resource.ListCommand)
+		children, _ := os.ReadDir(resourceDir)
+		for _, child := range children {
+			if child.IsDir() && !parents[child.Name()] {
+				os.RemoveAll(filepath.Join(resourceDir, child.Name()))
+			}
+		}
+	}
+}
+
 func getResourceIDsFromDirectory(dirPath string) ([]string, error) {
 	var ids []string
 	
@@ -128,3 +339,226 @@ func getResourceIDsFromDirectory(dirPath string) ([]string, error) {
 	
 	return ids, nil
 }
+
+// listResourceObjects lists every object of a first pass resource, once per
+// list type when its list command refuses to list without one
+func listResourceObjects(cfg *Config, resource BackupConfigResource, args ...string) ([]map[string]interface{}, error) {
+	if len(resource.ListTypes) == 0 {
+		return RunOktaCliList(cfg, append([]string{resource.Name, resource.ListCommand}, args...)...)
+	}
+	
+	var all []map[string]interface{}
+	for _, listType := range resource.ListTypes {
+		items, err := RunOktaCliList(cfg, append([]string{resource.Name, resource.ListCommand, "--type", listType}, args...)...)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s of type %s: %w", resource.Name, listType, err)
+		}
+		all = append(all, items...)
+	}
+	
+	return all, nil
+}
+
+// backupTypedResource writes every object of a resource listed per type where
+// the batch backup would have put them
+func backupTypedResource(cfg *Config, resource BackupConfigResource, outputDir string) error {
+	items, err := listResourceObjects(cfg, resource)
+	if err != nil {
+		return err
+	}
+	
+	return writeListedObjects(filepath.Join(outputDir, strings.ToLower(resource.Name), resource.ListCommand), resource, items)
+}
+
+// backupChildObjects lists the children of one parent and writes them where
+// the batch backup would have put them
+func backupChildObjects(cfg *Config, resource BackupConfigResource, parentID, outputDir string) error {
+	children, err := listChildObjects(cfg, resource, parentID)
+	if err != nil {
+		return err
+	}
+	
+	resourceDir := filepath.Join(outputDir, strings.ToLower(resource.Name), resource.ListCommand, parentID)
+	if err := os.MkdirAll(resourceDir, 0755); err != nil {
+		return fmt.Errorf("could not create directory %s: %w", resourceDir, err)
+	}
+	
+	for id, child := range children {
+		if err := writeBackupObject(resourceDir, id, child); err != nil {
+			return err
+		}
+	}
+	
+	return nil
+}
+
+// backupNestedChildObjects backs up an entry whose parents are second pass
+// objects, reading them from <parent entry>/<grandparent ID>/ where that
+// entry wrote them. The children are stored per parent, like other second
+// pass objects.
+func backupNestedChildObjects(cfg *Config, resource BackupConfigResource, outputDir string) error {
+	parentDir := filepath.Join(outputDir, strings.ToLower(resource.SourceIDDir), resource.SourceListCommand)
+	grandparents, err := os.ReadDir(parentDir)
+	if os.IsNotExist(err) {
+		fmt.Printf("Warning: Source directory %s not found for %s, skipping...\n", parentDir, resource.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+	
+	for _, grandparent := range grandparents {
+		if !grandparent.IsDir() {
+			continue
+		}
+		parentIDs, err := getResourceIDsFromDirectory(filepath.Join(parentDir, grandparent.Name()))
+		if err != nil {
+			return err
+		}
+		
+		for _, parentID := range parentIDs {
+			fmt.Printf("Backing up %s for %s ID %s using %s command...\n", 
+				resource.Name, resource.SourceIDDir, parentID, resource.ListCommand)
+			
+			children, err := listNestedChildObjects(cfg, resource, grandparent.Name(), parentID)
+			if err != nil {
+				fmt.Printf("Warning: Failed to execute %s %s backup for ID %s: %v\n", 
+					resource.Name, resource.ListCommand, parentID, err)
+				continue
+			}
+			
+			resourceDir := filepath.Join(outputDir, strings.ToLower(resource.Name), resource.ListCommand, parentID)
+			if err := os.MkdirAll(resourceDir, 0755); err != nil {
+				return fmt.Errorf("could not create directory %s: %w", resourceDir, err)
+			}
+			for id, child := range children {
+				if err := writeBackupObject(resourceDir, id, child); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	
+	return nil
+}
+
+// listNestedChildObjects reads the children of a second pass object, which
+// the CLI addresses by the object and its own parent
+func listNestedChildObjects(cfg *Config, resource BackupConfigResource, grandparentID, parentID string) (ResourceSet, error) {
+	items, err := RunOktaCliList(cfg, resource.Name, resource.ListCommand, 
+		fmt.Sprintf("--%s", getParameterFlagForResource(resource.SourceIDDir)), grandparentID, 
+		fmt.Sprintf("--%s", getParameterFlagForResource(resource.Name)), parentID)
+	if err != nil {
+		return nil, err
+	}
+	return resourceSetFromList(resource, items), nil
+}
+
+// listChildObjects reads the children of one parent keyed by the ID they are
+// stored under. A parent's only child, such as an app's provisioning
+// connection, is read with its get command and stored under that name, like
+// other singletons.
+func listChildObjects(cfg *Config, resource BackupConfigResource, parentID string) (ResourceSet, error) {
+	paramFlag := fmt.Sprintf("--%s", getParameterFlagForResource(resource.Name))
+	
+	if resource.IsSingleton {
+		data, err := RunOktaCli(cfg, resource.Name, resource.GetCommand, paramFlag, parentID)
+		if err != nil {
+			return nil, err
+		}
+		
+		var object map[string]interface{}
+		if err := json.Unmarshal(data, &object); err != nil {
+			return nil, fmt.Errorf("error parsing response: %w", err)
+		}
+		return ResourceSet{resource.GetCommand: object}, nil
+	}
+	
+	items, err := RunOktaCliList(cfg, resource.Name, resource.ListCommand, paramFlag, parentID)
+	if err != nil {
+		return nil, err
+	}
+	return resourceSetFromList(resource, items), nil
+}
+
+// listedObjectID returns the ID a listed object is stored under. JSON Web
+// Keys have no id, so they are stored under their kid, and entries with a
+// KeyField under that field.
+func listedObjectID(resource BackupConfigResource, item map[string]interface{}) (string, bool) {
+	fields := []string{"id", "kid"}
+	if resource.KeyField != "" {
+		fields = append(fields, resource.KeyField)
+	}
+	for _, field := range fields {
+		if id, ok := item[field].(string); ok {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// writeListedObjects writes listed objects into a backup directory, one file per ID
+func writeListedObjects(resourceDir string, resource BackupConfigResource, items []map[string]interface{}) error {
+	if err := os.MkdirAll(resourceDir, 0755); err != nil {
+		return fmt.Errorf("could not create directory %s: %w", resourceDir, err)
+	}
+	
+	for _, item := range items {
+		id, ok := listedObjectID(resource, item)
+		if !ok {
+			continue
+		}
+		if err := writeBackupObject(resourceDir, id, item); err != nil {
+			return err
+		}
+	}
+	
+	return nil
+}
+
+// readResourceObjects reads every JSON object in a backup directory, keyed by
+// the ID taken from its filename
+func readResourceObjects(dirPath string) (map[string]map[string]interface{}, error) {
+	objects := make(map[string]map[string]interface{})
+	
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		
+		filePath := filepath.Join(dirPath, entry.Name())
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading file %s: %w", filePath, err)
+		}
+		
+		var object map[string]interface{}
+		if err := json.Unmarshal(data, &object); err != nil {
+			return nil, fmt.Errorf("error parsing JSON in %s: %w", filePath, err)
+		}
+		
+		objects[strings.TrimSuffix(entry.Name(), ".json")] = object
+	}
+	
+	return objects, nil
+}
+
+// writeBackupObject writes one object into a backup directory the way
+// okta-cli-client's batch backup does, as <id>.json
+func writeBackupObject(dirPath, id string, object map[string]interface{}) error {
+	data, err := json.MarshalIndent(object, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling %s: %w", id, err)
+	}
+	
+	if err := os.WriteFile(filepath.Join(dirPath, id+".json"), data, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", id, err)
+	}
+	
+	return nil
+}
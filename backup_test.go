@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListedObjectID(t *testing.T) {
+	group := BackupConfigResource{Name: "group", ListCommand: "lists"}
+	features := BackupConfigResource{Name: "applicationFeatures", ListCommand: "listFeaturesForApplication", KeyField: "name"}
+
+	tests := []struct {
+		name     string
+		resource BackupConfigResource
+		item     map[string]interface{}
+		want     string
+		wantOK   bool
+	}{
+		{"id", group, map[string]interface{}{"id": "00g1", "name": "Engineering"}, "00g1", true},
+		{"kid", BackupConfigResource{Name: "applicationCredentials"}, map[string]interface{}{"kid": "kid1"}, "kid1", true},
+		{"name of an app feature", features, map[string]interface{}{"name": "USER_PROVISIONING"}, "USER_PROVISIONING", true},
+		{"name of anything else", group, map[string]interface{}{"name": "Engineering"}, "", false},
+		{"nothing", features, map[string]interface{}{"status": "ENABLED"}, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := listedObjectID(test.resource, test.item)
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("listedObjectID() = %q, %v, want %q, %v", got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestSecondPassSourcesResolve(t *testing.T) {
+	config := GetBackupConfig()
+	entries := make(map[string]bool)
+	for _, resource := range config.FirstPassResources {
+		entries[resource.Name+"/lists"] = true
+	}
+	for _, resource := range config.SecondPassResources {
+		entries[resource.Name+"/"+resource.ListCommand] = true
+	}
+
+	for _, resource := range config.SecondPassResources {
+		source := resource.SourceIDDir + "/lists"
+		if resource.SourceListCommand != "" {
+			source = resource.SourceIDDir + "/" + resource.SourceListCommand
+		}
+		if !entries[source] {
+			t.Errorf("%s reads its parents from %s, which nothing backs up", resource.entryName(), source)
+		}
+	}
+}
+
+func TestBackupNestedChildObjects(t *testing.T) {
+	outputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"authorizationserverpolicies/list/aus1/00p1": {"id": "00p1", "name": "Default Policy"},
+		"authorizationserverpolicies/list/aus1/00p2": {"id": "00p2", "name": "Partners"},
+	})
+	fakeOktaCli(t, map[string]interface{}{
+		"authorizationServerRules listAuthorizationServerPolicyRules --authServerId aus1 --policyId 00p1": []interface{}{
+			map[string]interface{}{"id": "0pr1", "name": "Default Rule"},
+		},
+		"authorizationServerRules listAuthorizationServerPolicyRules --authServerId aus1 --policyId 00p2": []interface{}{
+			map[string]interface{}{"id": "0pr2", "name": "Partner Rule"},
+			map[string]interface{}{"id": "0pr3", "name": "Partner Fallback"},
+		},
+	})
+
+	var rules BackupConfigResource
+	for _, resource := range GetBackupConfig().SecondPassResources {
+		if resource.Name == "authorizationServerRules" {
+			rules = resource
+		}
+	}
+	if err := backupNestedChildObjects(&Config{OrgName: "dev-111"}, rules, outputDir); err != nil {
+		t.Fatalf("backupNestedChildObjects() returned %v", err)
+	}
+
+	var got []string
+	dir := filepath.Join(outputDir, "authorizationserverrules", "listAuthorizationServerPolicyRules")
+	filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	want := []string{"00p1/0pr1.json", "00p2/0pr2.json", "00p2/0pr3.json"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("backupNestedChildObjects() wrote %v, want %v", got, want)
+	}
+}
+
+func TestPruneOrphanedChildren(t *testing.T) {
+	outputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"user/lists/00u1":                            {"id": "00u1"},
+		"user/listGroups/00u1/00g1":                  {"id": "00g1"},
+		"user/listGroups/00u2/00g1":                  {"id": "00g1"},
+		"authorizationserverpolicies/list/aus1/00p1": {"id": "00p1"},
+		"authorizationserverrules/listAuthorizationServerPolicyRules/00p1/0pr1": {"id": "0pr1"},
+		"authorizationserverrules/listAuthorizationServerPolicyRules/00p2/0pr2": {"id": "0pr2"},
+		"application/lists/0oa1": {"id": "0oa1"},
+		"applicationgroups/listApplicationGroupAssignments/0oa1/00g1": {"id": "00g1"},
+		// Nothing backs up the parents of this entry, so it is left alone
+		"userfactor/listFactors/00u9/uft1": {"id": "uft1"},
+	})
+	config := &BackupConfig{SecondPassResources: []BackupConfigResource{
+		{Name: "user", ListCommand: "listGroups", SourceIDDir: "user"},
+		{Name: "authorizationServerRules", ListCommand: "listAuthorizationServerPolicyRules", SourceIDDir: "authorizationServerPolicies", SourceListCommand: "list"},
+		{Name: "applicationGroups", ListCommand: "listApplicationGroupAssignments", SourceIDDir: "application"},
+		{Name: "userFactor", ListCommand: "listFactors", SourceIDDir: "identityProvider"},
+	}}
+
+	pruneOrphanedChildren(config, outputDir)
+
+	tests := []struct {
+		dir  string
+		want []string
+	}{
+		{dir: "user/listGroups", want: []string{"00u1"}},
+		{dir: "authorizationserverrules/listAuthorizationServerPolicyRules", want: []string{"00p1"}},
+		{dir: "applicationgroups/listApplicationGroupAssignments", want: []string{"0oa1"}},
+		{dir: "userfactor/listFactors", want: []string{"00u9"}},
+	}
+	for _, test := range tests {
+		entries, _ := os.ReadDir(filepath.Join(outputDir, filepath.FromSlash(test.dir)))
+		var got []string
+		for _, entry := range entries {
+			got = append(got, entry.Name())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("pruneOrphanedChildren() left %s = %v, want %v", test.dir, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// oktaIDPattern matches the IDs Okta gives objects: 20 characters starting
+// with the prefix of the object's type, such as 00g for groups or 0oa for apps
+var oktaIDPattern = regexp.MustCompile(`^(?:00[gpuT]|0oa|0gr|0pr|rst|rul|aus|scp|ocl|nzo|tos|who|cal|oty|aut|bnd|thm)[0-9A-Za-z]{17}$`)
+
+// idShapePattern matches any value shaped like an Okta ID, which is only
+// taken for one in fields named after IDs
+var idShapePattern = regexp.MustCompile(`^[0-9A-Za-z]{20}$`)
+
+// isIDField reports whether a field holds object IDs, e.g. id, appId or groupIds
+func isIDField(field string) bool {
+	return field == "id" || strings.HasSuffix(field, "Id") || strings.HasSuffix(field, "Ids") || strings.HasSuffix(field, "ID")
+}
+
+// normalizeOrgResources rewrites one org's objects so they can be compared
+// with another org's: every reference to a known object's ID becomes
+// resource:name, other IDs become {id}, and the org's own name (in domains
+// and URLs) becomes {org}. Objects keyed by ID are rekeyed by natural key so
+// the two sides line up; objects sharing one are reported and keep their ID.
+func normalizeOrgResources(cfg *Config, resources map[string]ResourceSet) map[string]ResourceSet {
+	names := make(map[string]string)
+	for setName, set := range resources {
+		resourceName, _, _ := strings.Cut(setName, "/")
+		for id, object := range set {
+			if object["id"] == id {
+				names[id] = resourceName + ":" + objectLabel(object)
+			}
+		}
+	}
+
+	orgPattern := regexp.MustCompile(`\b` + regexp.QuoteMeta(cfg.OrgName) + `\b`)
+	var normalize func(field string, value interface{}) interface{}
+	normalize = func(field string, value interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			if name, ok := names[v]; ok {
+				return name
+			}
+			if oktaIDPattern.MatchString(v) || (isIDField(field) && idShapePattern.MatchString(v)) {
+				return "{id}"
+			}
+			// Group rule expressions quote the IDs of the groups they test
+			v = expressionIDPattern.ReplaceAllStringFunc(v, func(quoted string) string {
+				if name, ok := names[strings.Trim(quoted, `"`)]; ok {
+					return fmt.Sprintf("%q", name)
+				}
+				return `"{id}"`
+			})
+			return orgPattern.ReplaceAllString(v, "{org}")
+		case []interface{}:
+			normalized := make([]interface{}, len(v))
+			for i, item := range v {
+				normalized[i] = normalize(field, item)
+			}
+			return normalized
+		case map[string]interface{}:
+			normalized := make(map[string]interface{}, len(v))
+			for key, item := range v {
+				normalized[key] = normalize(key, item)
+			}
+			return normalized
+		}
+		return value
+	}
+
+	normalized := make(map[string]ResourceSet)
+	for setName, set := range resources {
+		byLabel := make(map[string][]string)
+		for key, object := range set {
+			parent, _, nested := strings.Cut(key, "/")
+			newKey := key
+			if object["id"] == key {
+				newKey = objectLabel(object)
+			} else if nested {
+				newKey = objectLabel(object)
+				parentName, ok := names[parent]
+				if !ok {
+					parentName = parent
+				}
+				newKey = parentName + "/" + newKey
+			}
+			byLabel[newKey] = append(byLabel[newKey], key)
+		}
+
+		rekeyed := make(ResourceSet)
+		for newKey, keys := range byLabel {
+			if len(keys) > 1 {
+				fmt.Printf("Warning: %d %s objects in %s are named %s, comparing them by ID\n", len(keys), setName, cfg.OrgName, newKey)
+				for _, key := range keys {
+					rekeyed[newKey+" ("+key+")"] = normalize("", set[key]).(map[string]interface{})
+				}
+				continue
+			}
+			rekeyed[newKey] = normalize("", set[keys[0]]).(map[string]interface{})
+		}
+		normalized[setName] = rekeyed
+	}
+
+	return normalized
+}
+
+// CompareOrgs fetches the configuration resource types from two live orgs and
+// compares them after normalizing org-specific IDs and domains
+func CompareOrgs(left, right *Config, filter *ResourceFilter, opts *DiffOptions) (*Diff, error) {
+	if left.OrgName == right.OrgName {
+		return nil, fmt.Errorf("both sides point at %s", left.OrgName)
+	}
+
+	// Every org signs with keys of its own, so they always differ
+	config := GetBackupConfig().Filter(&configurationFilter).Filter(filter).
+		Filter(&ResourceFilter{Exclude: []string{"applicationCredentials"}})
+
+	fmt.Printf("Fetching configuration of %s...\n", left.OrgName)
+	leftResources := normalizeOrgResources(left, FetchLiveResources(left, config))
+	fmt.Printf("Fetching configuration of %s...\n", right.OrgName)
+	rightResources := normalizeOrgResources(right, FetchLiveResources(right, config))
+
+	// A type that could only be read from one side is not a difference
+	for name := range leftResources {
+		if _, ok := rightResources[name]; !ok {
+			fmt.Printf("Warning: %s could not be read from %s, skipping\n", name, right.OrgName)
+			delete(leftResources, name)
+		}
+	}
+	for name := range rightResources {
+		if _, ok := leftResources[name]; !ok {
+			fmt.Printf("Warning: %s could not be read from %s, skipping\n", name, left.OrgName)
+			delete(rightResources, name)
+		}
+	}
+
+	return diffResources(left.OrgName, right.OrgName, leftResources, rightResources, opts), nil
+}
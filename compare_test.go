@@ -0,0 +1,128 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeOrgResources(t *testing.T) {
+	cfg := &Config{OrgName: "dev-111"}
+
+	tests := []struct {
+		name      string
+		resources map[string]ResourceSet
+		want      map[string]ResourceSet
+	}{
+		{
+			name: "objects rekeyed by label",
+			resources: map[string]ResourceSet{
+				"group/lists": {"00g1a2b3c4d5e6f7g8h9": {"id": "00g1a2b3c4d5e6f7g8h9", "profile": map[string]interface{}{"name": "Engineering"}}},
+			},
+			want: map[string]ResourceSet{
+				"group/lists": {"Engineering": {"id": "group:Engineering", "profile": map[string]interface{}{"name": "Engineering"}}},
+			},
+		},
+		{
+			name: "references to known objects become names",
+			resources: map[string]ResourceSet{
+				"group/lists": {"00g1a2b3c4d5e6f7g8h9": {"id": "00g1a2b3c4d5e6f7g8h9", "profile": map[string]interface{}{"name": "Engineering"}}},
+				"policy/lists": {"00p1a2b3c4d5e6f7g8h9": {
+					"id":   "00p1a2b3c4d5e6f7g8h9",
+					"name": "Engineers",
+					"conditions": map[string]interface{}{
+						"people": map[string]interface{}{"groups": map[string]interface{}{"include": []interface{}{"00g1a2b3c4d5e6f7g8h9", "00g9z8y7x6w5v4u3t2s1"}}},
+					},
+				}},
+			},
+			want: map[string]ResourceSet{
+				"group/lists": {"Engineering": {"id": "group:Engineering", "profile": map[string]interface{}{"name": "Engineering"}}},
+				"policy/lists": {"Engineers": {
+					"id":   "policy:Engineers",
+					"name": "Engineers",
+					"conditions": map[string]interface{}{
+						"people": map[string]interface{}{"groups": map[string]interface{}{"include": []interface{}{"group:Engineering", "{id}"}}},
+					},
+				}},
+			},
+		},
+		{
+			name: "only ID fields hold IDs of any shape",
+			resources: map[string]ResourceSet{
+				"application/lists": {"0oa1a2b3c4d5e6f7g8h9": {
+					"id":    "0oa1a2b3c4d5e6f7g8h9",
+					"label": "Portal",
+					"settings": map[string]interface{}{
+						"clientId": "abcdefghij0123456789",
+						"tagline":  "abcdefghij0123456789",
+					},
+				}},
+			},
+			want: map[string]ResourceSet{
+				"application/lists": {"Portal": {
+					"id":    "application:Portal",
+					"label": "Portal",
+					"settings": map[string]interface{}{
+						"clientId": "{id}",
+						"tagline":  "abcdefghij0123456789",
+					},
+				}},
+			},
+		},
+		{
+			name: "org name masked in URLs and rule expressions rewritten",
+			resources: map[string]ResourceSet{
+				"group/lists":         {"00g1a2b3c4d5e6f7g8h9": {"id": "00g1a2b3c4d5e6f7g8h9", "profile": map[string]interface{}{"name": "Engineering"}}},
+				"trustedOrigin/lists": {"tos1a2b3c4d5e6f7g8h9": {"id": "tos1a2b3c4d5e6f7g8h9", "name": "Portal", "origin": "https://dev-111.okta.com"}},
+				"group/listRules": {"0gr1a2b3c4d5e6f7g8h9": {
+					"id":         "0gr1a2b3c4d5e6f7g8h9",
+					"name":       "Engineers",
+					"expression": `isMemberOfAnyGroup("00g1a2b3c4d5e6f7g8h9", "00g9z8y7x6w5v4u3t2s1")`,
+				}},
+			},
+			want: map[string]ResourceSet{
+				"group/lists":         {"Engineering": {"id": "group:Engineering", "profile": map[string]interface{}{"name": "Engineering"}}},
+				"trustedOrigin/lists": {"Portal": {"id": "trustedOrigin:Portal", "name": "Portal", "origin": "https://{org}.okta.com"}},
+				"group/listRules": {"Engineers": {
+					"id":         "group:Engineers",
+					"name":       "Engineers",
+					"expression": `isMemberOfAnyGroup("group:Engineering", "{id}")`,
+				}},
+			},
+		},
+		{
+			name: "children keyed by parent name",
+			resources: map[string]ResourceSet{
+				"authorizationServer/lists":                  {"aus1a2b3c4d5e6f7g8h9": {"id": "aus1a2b3c4d5e6f7g8h9", "name": "default"}},
+				"authorizationServerScopes/listOAuth2Scopes": {"aus1a2b3c4d5e6f7g8h9/scp1a2b3c4d5e6f7g8h9": {"id": "scp1a2b3c4d5e6f7g8h9", "name": "read"}},
+			},
+			want: map[string]ResourceSet{
+				"authorizationServer/lists":                  {"default": {"id": "authorizationServer:default", "name": "default"}},
+				"authorizationServerScopes/listOAuth2Scopes": {"authorizationServer:default/read": {"id": "{id}", "name": "read"}},
+			},
+		},
+		{
+			name: "objects sharing a label keep their IDs",
+			resources: map[string]ResourceSet{
+				"group/lists": {
+					"00g1a2b3c4d5e6f7g8h9": {"id": "00g1a2b3c4d5e6f7g8h9", "profile": map[string]interface{}{"name": "Sales"}},
+					"00g9z8y7x6w5v4u3t2s1": {"id": "00g9z8y7x6w5v4u3t2s1", "profile": map[string]interface{}{"name": "Sales"}},
+				},
+			},
+			want: map[string]ResourceSet{
+				"group/lists": {
+					"Sales (00g1a2b3c4d5e6f7g8h9)": {"id": "group:Sales", "profile": map[string]interface{}{"name": "Sales"}},
+					"Sales (00g9z8y7x6w5v4u3t2s1)": {"id": "group:Sales", "profile": map[string]interface{}{"name": "Sales"}},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := normalizeOrgResources(cfg, test.resources)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("normalizeOrgResources() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -19,6 +19,62 @@ type BackupConfigResource struct {
 	SourceIDDir string
 	// Flag to indicate if this is a singleton resource (no list capability)
 	IsSingleton bool
+	// Types to list one at a time, for list commands that refuse to list without one
+	ListTypes []string `json:",omitempty"`
+	// For second pass resources that only some parents have, the parent types that do
+	SourceTypes []string `json:",omitempty"`
+	// For application resources only apps with provisioning enabled have
+	ProvisioningOnly bool `json:",omitempty"`
+	// For entries listing objects other than the resource itself (group rules
+	// are listed with the group commands), the type their IDs are tracked under
+	ObjectType string `json:",omitempty"`
+	// For list commands whose batch backup crashes, list the objects and write
+	// them ourselves
+	NoBatchBackup bool `json:",omitempty"`
+	// For objects listed with neither an id nor a kid, the field they are
+	// stored under (app features are stored under their name)
+	KeyField string `json:",omitempty"`
+	// For entries whose parents are second pass objects themselves, such as
+	// the rules of an authorization server's policies, the list command the
+	// parents were backed up with. SourceIDDir then names the parents' entry.
+	SourceListCommand string `json:",omitempty"`
+}
+
+// objectType returns the type the IDs of an entry's objects are tracked under
+func (r BackupConfigResource) objectType() string {
+	if r.ObjectType != "" {
+		return r.ObjectType
+	}
+	return r.Name
+}
+
+// entryName identifies a registry entry as name/command, e.g. user/listGroups
+func (r BackupConfigResource) entryName() string {
+	if r.IsSingleton {
+		return r.Name + "/" + r.GetCommand
+	}
+	return r.Name + "/" + r.ListCommand
+}
+
+// appliesTo reports whether a second pass resource exists for a parent object
+func (r BackupConfigResource) appliesTo(parent map[string]interface{}) bool {
+	if r.ProvisioningOnly {
+		// Apps list the provisioning features they have, such as PUSH_NEW_USERS
+		features, _ := parent["features"].([]interface{})
+		if len(features) == 0 {
+			return false
+		}
+	}
+	if len(r.SourceTypes) == 0 {
+		return true
+	}
+	parentType, _ := parent["type"].(string)
+	for _, sourceType := range r.SourceTypes {
+		if sourceType == parentType {
+			return true
+		}
+	}
+	return false
 }
 
 // BackupConfig is the main configuration for backup operations
@@ -37,6 +93,7 @@ func GetBackupConfig() *BackupConfig {
 			// Users and Groups
 			{Name: "user", ListCommand: "lists", GetCommand: "get", RequiresIDs: false},
 			{Name: "group", ListCommand: "lists", GetCommand: "get", RequiresIDs: false},
+			{Name: "group", ListCommand: "listRules", GetCommand: "getRule", RequiresIDs: false, ObjectType: "groupRule"},
 			{Name: "userType", ListCommand: "lists", GetCommand: "get", RequiresIDs: false},
 			
 			// Applications
@@ -64,9 +121,9 @@ func GetBackupConfig() *BackupConfig {
 			{Name: "inlineHook", ListCommand: "lists", GetCommand: "get", RequiresIDs: false},
 			{Name: "hookKey", ListCommand: "lists", GetCommand: "get", RequiresIDs: false},
 			
-			// Policies
-			// blocked on https://github.com/okta/okta-cli-client/issues/17
-			// {Name: "policy", ListCommand: "listPolicies", GetCommand: "get", RequiresIDs: false},
+			// Policies, listed per type since the batch backup cannot pass one
+			// (https://github.com/okta/okta-cli-client/issues/17)
+			{Name: "policy", ListCommand: "lists", GetCommand: "get", RequiresIDs: false, ListTypes: policyTypes},
 			
 			// Roles
 			{Name: "role", ListCommand: "lists", GetCommand: "get", RequiresIDs: false},
@@ -97,9 +154,8 @@ func GetBackupConfig() *BackupConfig {
 		SecondPassResources: []BackupConfigResource{
 			// Group related resources that require group IDs
 			{Name: "group", ListCommand: "listUsers", GetCommand: "", RequiresIDs: true, SourceIDDir: "group"},
-			//{Name: "group", ListCommand: "listRules", GetCommand: "", RequiresIDs: true, SourceIDDir: "group"},
 			{Name: "group", ListCommand: "listAssignedApplicationsFor", GetCommand: "", RequiresIDs: true, SourceIDDir: "group"},
-			//{Name: "groupOwner", ListCommand: "lists", GetCommand: "", RequiresIDs: true, SourceIDDir: "group"},
+			{Name: "groupOwner", ListCommand: "lists", GetCommand: "", RequiresIDs: true, SourceIDDir: "group"},
 			
 			// User related resources that require user IDs
 			{Name: "user", ListCommand: "listAppLinks", GetCommand: "", RequiresIDs: true, SourceIDDir: "user"},
@@ -110,13 +166,16 @@ func GetBackupConfig() *BackupConfig {
 			{Name: "roleAssignment", ListCommand: "listAssignedRolesForUser", GetCommand: "", RequiresIDs: true, SourceIDDir: "user"},
 			
 			// Application related resources that require application IDs
-			// segfaults, query params? 
-			// {Name: "applicationGroups", ListCommand: "listApplicationGroupAssignments", GetCommand: "", RequiresIDs: true, SourceIDDir: "application"},
-			// {Name: "applicationUsers", ListCommand: "list", GetCommand: "", RequiresIDs: true, SourceIDDir: "application"},
+			// The batch backup segfaults on these, so they are listed directly
+			{Name: "applicationUsers", ListCommand: "list", GetCommand: "", RequiresIDs: true, SourceIDDir: "application", NoBatchBackup: true},
+			{Name: "applicationGroups", ListCommand: "listApplicationGroupAssignments", GetCommand: "", RequiresIDs: true, SourceIDDir: "application", NoBatchBackup: true},
 			// {Name: "applicationTokens", ListCommand: "listOAuth2TokensForApplication", GetCommand: "", RequiresIDs: true, SourceIDDir: "application"},
-			// {Name: "applicationCredentials", ListCommand: "listApplicationKeys", GetCommand: "", RequiresIDs: true, SourceIDDir: "application"},
-			// {Name: "applicationCredentials", ListCommand: "listCsrsForApplication", GetCommand: "", RequiresIDs: true, SourceIDDir: "application"},
-			// {Name: "applicationFeatures", ListCommand: "listFeaturesForApplication", GetCommand: "", RequiresIDs: true, SourceIDDir: "application"},
+			// Signing keys have a kid but no id, so the batch backup cannot name their files either
+			{Name: "applicationCredentials", ListCommand: "listApplicationKeys", GetCommand: "", RequiresIDs: true, SourceIDDir: "application", NoBatchBackup: true},
+			{Name: "applicationCredentials", ListCommand: "listCsrsForApplication", GetCommand: "", RequiresIDs: true, SourceIDDir: "application"},
+			// An app has a single provisioning connection, read like a singleton
+			{Name: "applicationConnections", ListCommand: "getDefaultProvisioningConnectionForApplication", GetCommand: "getDefaultProvisioningConnectionForApplication", RequiresIDs: true, SourceIDDir: "application", IsSingleton: true, NoBatchBackup: true, ProvisioningOnly: true, KeyField: "name"},
+			{Name: "applicationFeatures", ListCommand: "listFeaturesForApplication", GetCommand: "", RequiresIDs: true, SourceIDDir: "application", NoBatchBackup: true, ProvisioningOnly: true, KeyField: "name"},
 			// {Name: "applicationGrants", ListCommand: "listScopeConsentGrants", GetCommand: "", RequiresIDs: true, SourceIDDir: "application"},
 			
 			// Authorization server related resources that require server IDs
@@ -127,9 +186,12 @@ func GetBackupConfig() *BackupConfig {
 			
 			// Policy related resources that require policy IDs
 			{Name: "policy", ListCommand: "listRules", GetCommand: "", RequiresIDs: true, SourceIDDir: "policy"},
+			{Name: "policy", ListCommand: "listMappings", GetCommand: "", RequiresIDs: true, SourceIDDir: "policy", SourceTypes: []string{"ACCESS_POLICY"}},
 			
 			// Other resources with dependencies
-			{Name: "authorizationServerRules", ListCommand: "listAuthorizationServerPolicyRules", GetCommand: "", RequiresIDs: true, SourceIDDir: "authorizationServerPolicy"},
+			// Rules need both the server and the policy, so they are read from
+			// the policies the entry above backed up per server
+			{Name: "authorizationServerRules", ListCommand: "listAuthorizationServerPolicyRules", GetCommand: "", RequiresIDs: true, SourceIDDir: "authorizationServerPolicies", SourceListCommand: "list", NoBatchBackup: true},
 			{Name: "identityProvider", ListCommand: "listKeys", GetCommand: "", RequiresIDs: true, SourceIDDir: "identityProvider"},
 			{Name: "identityProvider", ListCommand: "listSigningKeys", GetCommand: "", RequiresIDs: true, SourceIDDir: "identityProvider"},
 		},
@@ -166,12 +228,56 @@ func GetBackupConfig() *BackupConfig {
 	return backupconfig
 }
 
+// configurationFilter selects the resource types that describe how an org is
+// configured, as opposed to the people in it (users, memberships, factors,
+// grants) or its secrets
+var configurationFilter = ResourceFilter{
+	Include: []string{
+		"application*",
+		"authorizationServer*",
+		"identityProvider/lists",
+		"networkZone",
+		"trustedOrigin",
+		"eventHook",
+		"inlineHook",
+		"policy*",
+		"group/lists",
+		"group/listRules",
+		"userType",
+		"role",
+		"feature",
+		"customization",
+		"emailDomain",
+		"template",
+		"orgSetting",
+		"attackProtection",
+		"threatInsight",
+		"rateLimitSettings",
+	},
+	Exclude: []string{
+		"applicationUsers",
+		"applicationTokens",
+		"applicationGrants",
+	},
+}
+
+// policyTypes lists the values accepted by the type parameter of the policies
+// list endpoint, which refuses to list without one
+var policyTypes = []string{
+	"OKTA_SIGN_ON",
+	"PASSWORD",
+	"MFA_ENROLL",
+	"IDP_DISCOVERY",
+	"ACCESS_POLICY",
+	"PROFILE_ENROLLMENT",
+}
+
 func getParameterFlagForResource(resourceName string) string {
     // Map resource names to their appropriate command-line parameter flags
     paramMap := map[string]string{
         "group":                   "groupId",
         "user":                    "userId",
-        "application":             "applicationId",
+        "application":             "appId",
         "authorizationServer":     "authServerId",
         "authorizationServerPolicies": "authServerId",
         "authorizationServerRules": "policyId",
@@ -184,11 +290,17 @@ func getParameterFlagForResource(resourceName string) string {
         "applicationTokens":       "appId",
         "applicationCredentials":  "appId",
         "applicationFeatures":     "appId",
+        "applicationConnections":  "appId",
         "applicationGrants":       "appId",
         "authorizationServerClaims": "authServerId",
         "authorizationServerScopes": "authServerId",
         "authorizationServerClients": "authServerId",
         "groupOwner":              "groupId",
+        "groupRule":               "groupRuleId",
+        "networkZone":             "zoneId",
+        "trustedOrigin":           "trustedOriginId",
+        "eventHook":               "eventHookId",
+        "inlineHook":              "inlineHookId",
     }
     
     // Return the appropriate parameter or default to "id" if not found
@@ -200,6 +312,21 @@ func getParameterFlagForResource(resourceName string) string {
     return "id"
 }
 
+// getChildIDFlagForResource returns the flag naming one child object of a
+// second pass resource, keyed by name/listCommand, or "" when the CLI has no
+// way to address a single child
+func getChildIDFlagForResource(resourceName, listCommand string) string {
+    childParams := map[string]string{
+        "authorizationServerClaims/listOAuth2Claims":  "claimId",
+        "authorizationServerScopes/listOAuth2Scopes":  "scopeId",
+        "authorizationServerPolicies/list":            "policyId",
+        "authorizationServerRules/listAuthorizationServerPolicyRules": "ruleId",
+        "policy/listRules":                            "ruleId",
+    }
+    
+    return childParams[resourceName+"/"+listCommand]
+}
+
 // SaveBackupConfig saves the backup configuration to a file
 func SaveBackupConfig(filePath string) error {
 	backupconfig := GetBackupConfig()
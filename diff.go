@@ -0,0 +1,414 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// volatileFields change on their own without anyone editing the object, so
+// comparisons skip them wherever they appear
+var volatileFields = map[string]bool{
+	"lastUpdated":           true,
+	"_links":                true,
+	"lastLogin":             true,
+	"lastMembershipUpdated": true,
+	"passwordChanged":       true,
+	"statusChanged":         true,
+}
+
+// FieldChange is one difference between two versions of an object
+type FieldChange struct {
+	Path  string      `json:"path"`
+	Left  interface{} `json:"left,omitempty"`
+	Right interface{} `json:"right,omitempty"`
+}
+
+// ObjectDiff describes one object that differs between two sides
+type ObjectDiff struct {
+	Key     string        `json:"key"`
+	Label   string        `json:"label"`
+	LeftID  string        `json:"leftId,omitempty"`
+	RightID string        `json:"rightId,omitempty"`
+	Changes []FieldChange `json:"changes,omitempty"`
+}
+
+// ResourceDiff holds the differences for one resource type
+type ResourceDiff struct {
+	Resource string       `json:"resource"`
+	Added    []ObjectDiff `json:"added,omitempty"`
+	Removed  []ObjectDiff `json:"removed,omitempty"`
+	Changed  []ObjectDiff `json:"changed,omitempty"`
+	// Duplicates are objects that share their label with another object on
+	// the same side, so they could not be matched by label
+	Duplicates []ObjectDiff `json:"duplicates,omitempty"`
+}
+
+// Empty reports whether both sides matched. Duplicates could not be matched
+// at all, so they count as a difference.
+func (d ResourceDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && len(d.Duplicates) == 0
+}
+
+// Diff is the full comparison between two sides, e.g. two snapshots
+type Diff struct {
+	Left      string         `json:"left"`
+	Right     string         `json:"right"`
+	Resources []ResourceDiff `json:"resources"`
+}
+
+// Empty reports whether nothing differs
+func (d *Diff) Empty() bool {
+	for _, resource := range d.Resources {
+		if !resource.Empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// DiffOptions controls how objects are compared
+type DiffOptions struct {
+	// Ignore lists extra field names to skip, on top of volatileFields
+	Ignore []string
+}
+
+func (o *DiffOptions) ignores(field string) bool {
+	if volatileFields[field] {
+		return true
+	}
+	for _, ignored := range o.Ignore {
+		if ignored == field {
+			return true
+		}
+	}
+	return false
+}
+
+// ResourceSet is every object of one resource type, keyed by ID
+type ResourceSet map[string]map[string]interface{}
+
+// loadSnapshotResources reads every resource type of the registry from a
+// snapshot, keyed by name/command. Second pass objects are keyed by
+// parentID/childID.
+func loadSnapshotResources(snapshotDir string, config *BackupConfig) map[string]ResourceSet {
+	resources := make(map[string]ResourceSet)
+
+	for _, resource := range config.FirstPassResources {
+		dir := filepath.Join(snapshotDir, strings.ToLower(resource.Name), resource.ListCommand)
+		if objects, err := readResourceObjects(dir); err == nil {
+			resources[resource.Name+"/"+resource.ListCommand] = objects
+		}
+	}
+
+	for _, resource := range config.SingletonResources {
+		dir := filepath.Join(snapshotDir, strings.ToLower(resource.Name), resource.GetCommand)
+		if objects, err := readResourceObjects(dir); err == nil {
+			resources[resource.Name+"/"+resource.GetCommand] = objects
+		}
+	}
+
+	for _, resource := range config.SecondPassResources {
+		dir := filepath.Join(snapshotDir, strings.ToLower(resource.Name), resource.ListCommand)
+		parents, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		set := make(ResourceSet)
+		for _, parent := range parents {
+			if !parent.IsDir() {
+				continue
+			}
+			children, err := readResourceObjects(filepath.Join(dir, parent.Name()))
+			if err != nil {
+				continue
+			}
+			for id, object := range children {
+				set[parent.Name()+"/"+id] = object
+			}
+		}
+		resources[resource.Name+"/"+resource.ListCommand] = set
+	}
+
+	return resources
+}
+
+// naturalKey identifies an object independently of its ID, so the same object
+// can be matched across orgs or after it was recreated
+func naturalKey(key string, object map[string]interface{}) string {
+	label := objectLabel(object)
+	if parent, _, ok := strings.Cut(key, "/"); ok {
+		return parent + "/" + label
+	}
+	return label
+}
+
+// diffResourceSets compares one resource type, matching objects by ID first
+// and then by natural key
+func diffResourceSets(resource string, left, right ResourceSet, opts *DiffOptions) ResourceDiff {
+	result := ResourceDiff{Resource: resource}
+
+	unmatchedLeft := make(map[string]bool)
+	unmatchedRight := make(map[string]bool)
+	pairs := make(map[string]string)
+
+	for key := range left {
+		if _, ok := right[key]; ok {
+			pairs[key] = key
+		} else {
+			unmatchedLeft[key] = true
+		}
+	}
+	for key := range right {
+		if _, ok := left[key]; !ok {
+			unmatchedRight[key] = true
+		}
+	}
+
+	leftByLabel := make(map[string][]string)
+	for key := range unmatchedLeft {
+		label := naturalKey(key, left[key])
+		leftByLabel[label] = append(leftByLabel[label], key)
+	}
+	rightByLabel := make(map[string][]string)
+	for key := range unmatchedRight {
+		label := naturalKey(key, right[key])
+		rightByLabel[label] = append(rightByLabel[label], key)
+	}
+
+	matchedByLabel := make(map[string]bool)
+	for label, leftKeys := range leftByLabel {
+		rightKeys := rightByLabel[label]
+		if len(rightKeys) == 0 {
+			continue
+		}
+		if len(leftKeys) > 1 || len(rightKeys) > 1 {
+			for _, key := range leftKeys {
+				result.Duplicates = append(result.Duplicates, ObjectDiff{Key: key, Label: objectLabel(left[key]), LeftID: key})
+			}
+			for _, key := range rightKeys {
+				result.Duplicates = append(result.Duplicates, ObjectDiff{Key: key, Label: objectLabel(right[key]), RightID: key})
+			}
+			continue
+		}
+		pairs[leftKeys[0]] = rightKeys[0]
+		matchedByLabel[leftKeys[0]] = true
+		delete(unmatchedLeft, leftKeys[0])
+		delete(unmatchedRight, rightKeys[0])
+	}
+
+	// Objects matched by label are different objects with their own IDs
+	labelOpts := &DiffOptions{Ignore: append([]string{"id", "created"}, opts.Ignore...)}
+	for leftKey, rightKey := range pairs {
+		pairOpts := opts
+		if matchedByLabel[leftKey] {
+			pairOpts = labelOpts
+		}
+		var changes []FieldChange
+		diffValues("", left[leftKey], right[rightKey], pairOpts, &changes)
+		if len(changes) > 0 {
+			result.Changed = append(result.Changed, ObjectDiff{
+				Key: leftKey, Label: objectLabel(left[leftKey]), LeftID: leftKey, RightID: rightKey, Changes: changes,
+			})
+		}
+	}
+	for key := range unmatchedLeft {
+		result.Removed = append(result.Removed, ObjectDiff{Key: key, Label: objectLabel(left[key]), LeftID: key})
+	}
+	for key := range unmatchedRight {
+		result.Added = append(result.Added, ObjectDiff{Key: key, Label: objectLabel(right[key]), RightID: key})
+	}
+
+	for _, list := range [][]ObjectDiff{result.Added, result.Removed, result.Changed, result.Duplicates} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	}
+
+	return result
+}
+
+// diffValues walks two decoded JSON values and records every field that differs
+func diffValues(path string, left, right interface{}, opts *DiffOptions, changes *[]FieldChange) {
+	leftMap, leftIsMap := left.(map[string]interface{})
+	rightMap, rightIsMap := right.(map[string]interface{})
+
+	if leftIsMap && rightIsMap {
+		keys := make(map[string]bool)
+		for key := range leftMap {
+			keys[key] = true
+		}
+		for key := range rightMap {
+			keys[key] = true
+		}
+
+		for _, key := range sortedKeys(keys) {
+			if opts.ignores(key) {
+				continue
+			}
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			diffValues(childPath, leftMap[key], rightMap[key], opts, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(stripIgnored(left, opts), stripIgnored(right, opts)) {
+		*changes = append(*changes, FieldChange{Path: path, Left: left, Right: right})
+	}
+}
+
+// stripIgnored drops ignored fields from objects nested inside arrays, which
+// diffValues compares whole
+func stripIgnored(value interface{}, opts *DiffOptions) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		stripped := make([]interface{}, len(v))
+		for i, item := range v {
+			stripped[i] = stripIgnored(item, opts)
+		}
+		return stripped
+	case map[string]interface{}:
+		stripped := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if !opts.ignores(key) {
+				stripped[key] = stripIgnored(item, opts)
+			}
+		}
+		return stripped
+	}
+
+	return value
+}
+
+// diffResources compares every resource type present on either side
+func diffResources(leftName, rightName string, left, right map[string]ResourceSet, opts *DiffOptions) *Diff {
+	diff := &Diff{Left: leftName, Right: rightName}
+
+	names := make(map[string]bool)
+	for name := range left {
+		names[name] = true
+	}
+	for name := range right {
+		names[name] = true
+	}
+
+	for _, name := range sortedKeys(names) {
+		resourceDiff := diffResourceSets(name, left[name], right[name], opts)
+		if !resourceDiff.Empty() {
+			diff.Resources = append(diff.Resources, resourceDiff)
+		}
+	}
+
+	return diff
+}
+
+// DiffSnapshots compares two backup trees
+func DiffSnapshots(leftDir, rightDir string, opts *DiffOptions) (*Diff, error) {
+	for _, dir := range []string{leftDir, rightDir} {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("cannot read snapshot %s: %w", dir, err)
+		}
+	}
+
+	config := GetBackupConfig()
+	left := loadSnapshotResources(leftDir, config)
+	right := loadSnapshotResources(rightDir, config)
+
+	return diffResources(leftDir, rightDir, left, right, opts), nil
+}
+
+// RenderDiff writes a diff as text, json or markdown
+func RenderDiff(w io.Writer, diff *Diff, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	case "markdown", "md":
+		renderDiffMarkdown(w, diff)
+		return nil
+	case "text", "":
+		renderDiffText(w, diff)
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, expected text, json or markdown", format)
+}
+
+func formatDiffValue(value interface{}) string {
+	if value == nil {
+		return "(none)"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+func renderDiffText(w io.Writer, diff *Diff) {
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", diff.Left, diff.Right)
+	if diff.Empty() {
+		fmt.Fprintln(w, "No differences")
+		return
+	}
+
+	for _, resource := range diff.Resources {
+		fmt.Fprintf(w, "\n%s: %d added, %d removed, %d changed, %d duplicates\n",
+			resource.Resource, len(resource.Added), len(resource.Removed), len(resource.Changed), len(resource.Duplicates))
+		for _, object := range resource.Added {
+			fmt.Fprintf(w, "  + %s (%s)\n", object.Key, object.Label)
+		}
+		for _, object := range resource.Removed {
+			fmt.Fprintf(w, "  - %s (%s)\n", object.Key, object.Label)
+		}
+		for _, object := range resource.Changed {
+			fmt.Fprintf(w, "  ~ %s (%s)\n", object.Key, object.Label)
+			for _, change := range object.Changes {
+				fmt.Fprintf(w, "      %s: %s -> %s\n", change.Path, formatDiffValue(change.Left), formatDiffValue(change.Right))
+			}
+		}
+		for _, object := range resource.Duplicates {
+			fmt.Fprintf(w, "  ! %s (%s) shares its label with another object, not matched by label\n", object.Key, object.Label)
+		}
+	}
+}
+
+func renderDiffMarkdown(w io.Writer, diff *Diff) {
+	fmt.Fprintf(w, "## `%s` → `%s`\n\n", diff.Left, diff.Right)
+	if diff.Empty() {
+		fmt.Fprintln(w, "No differences.")
+		return
+	}
+
+	fmt.Fprintln(w, "| Resource | Added | Removed | Changed | Duplicates |")
+	fmt.Fprintln(w, "|---|---:|---:|---:|---:|")
+	for _, resource := range diff.Resources {
+		fmt.Fprintf(w, "| `%s` | %d | %d | %d | %d |\n", resource.Resource, len(resource.Added), len(resource.Removed), len(resource.Changed), len(resource.Duplicates))
+	}
+
+	for _, resource := range diff.Resources {
+		fmt.Fprintf(w, "\n### `%s`\n\n", resource.Resource)
+		for _, object := range resource.Added {
+			fmt.Fprintf(w, "- **added** `%s` %s\n", object.Key, object.Label)
+		}
+		for _, object := range resource.Removed {
+			fmt.Fprintf(w, "- **removed** `%s` %s\n", object.Key, object.Label)
+		}
+		for _, object := range resource.Changed {
+			fmt.Fprintf(w, "- **changed** `%s` %s\n", object.Key, object.Label)
+			for _, change := range object.Changes {
+				fmt.Fprintf(w, "  - `%s`: `%s` → `%s`\n", change.Path, formatDiffValue(change.Left), formatDiffValue(change.Right))
+			}
+		}
+		for _, object := range resource.Duplicates {
+			fmt.Fprintf(w, "- **duplicate label** `%s` %s, not matched by label\n", object.Key, object.Label)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		left   interface{}
+		right  interface{}
+		ignore []string
+		want   []FieldChange
+	}{
+		{
+			name:  "equal",
+			left:  map[string]interface{}{"name": "a", "status": "ACTIVE"},
+			right: map[string]interface{}{"name": "a", "status": "ACTIVE"},
+		},
+		{
+			name:  "changed field",
+			left:  map[string]interface{}{"status": "ACTIVE"},
+			right: map[string]interface{}{"status": "INACTIVE"},
+			want:  []FieldChange{{Path: "status", Left: "ACTIVE", Right: "INACTIVE"}},
+		},
+		{
+			name:  "nested fields in order",
+			left:  map[string]interface{}{"profile": map[string]interface{}{"name": "a", "description": "x"}},
+			right: map[string]interface{}{"profile": map[string]interface{}{"name": "b", "description": "y"}},
+			want: []FieldChange{
+				{Path: "profile.description", Left: "x", Right: "y"},
+				{Path: "profile.name", Left: "a", Right: "b"},
+			},
+		},
+		{
+			name:  "added and removed fields",
+			left:  map[string]interface{}{"a": "1"},
+			right: map[string]interface{}{"b": "2"},
+			want: []FieldChange{
+				{Path: "a", Left: "1"},
+				{Path: "b", Right: "2"},
+			},
+		},
+		{
+			name:  "volatile fields",
+			left:  map[string]interface{}{"lastUpdated": "2026-01-01", "_links": map[string]interface{}{"self": "x"}},
+			right: map[string]interface{}{"lastUpdated": "2026-02-01", "_links": map[string]interface{}{"self": "y"}},
+		},
+		{
+			name:   "ignored fields",
+			left:   map[string]interface{}{"id": "00g1", "name": "a"},
+			right:  map[string]interface{}{"id": "00g2", "name": "a"},
+			ignore: []string{"id"},
+		},
+		{
+			name:  "arrays compared whole without volatile fields",
+			left:  map[string]interface{}{"items": []interface{}{map[string]interface{}{"v": "1", "lastUpdated": "a"}}},
+			right: map[string]interface{}{"items": []interface{}{map[string]interface{}{"v": "1", "lastUpdated": "b"}}},
+		},
+		{
+			name:  "arrays that differ",
+			left:  map[string]interface{}{"uris": []interface{}{"a"}},
+			right: map[string]interface{}{"uris": []interface{}{"a", "b"}},
+			want:  []FieldChange{{Path: "uris", Left: []interface{}{"a"}, Right: []interface{}{"a", "b"}}},
+		},
+		{
+			name:  "type change",
+			left:  map[string]interface{}{"settings": map[string]interface{}{"a": "1"}},
+			right: map[string]interface{}{"settings": "none"},
+			want:  []FieldChange{{Path: "settings", Left: map[string]interface{}{"a": "1"}, Right: "none"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []FieldChange
+			diffValues("", test.left, test.right, &DiffOptions{Ignore: test.ignore}, &got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("diffValues() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDiffResourceSets(t *testing.T) {
+	group := func(id, name, created string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "created": created, "profile": map[string]interface{}{"name": name}}
+	}
+
+	tests := []struct {
+		name       string
+		left       ResourceSet
+		right      ResourceSet
+		added      []string
+		removed    []string
+		changed    []string
+		duplicates []string
+	}{
+		{
+			name:  "same ID",
+			left:  ResourceSet{"00g1": group("00g1", "a", "2026-01-01")},
+			right: ResourceSet{"00g1": group("00g1", "a", "2026-01-01")},
+		},
+		{
+			name:  "matched by label ignores id and created",
+			left:  ResourceSet{"00g1": group("00g1", "a", "2026-01-01")},
+			right: ResourceSet{"00g9": group("00g9", "a", "2026-03-01")},
+		},
+		{
+			name:    "matched by label reports other changes",
+			left:    ResourceSet{"00g1": group("00g1", "a", "2026-01-01")},
+			right:   ResourceSet{"00g9": map[string]interface{}{"id": "00g9", "profile": map[string]interface{}{"name": "a", "description": "x"}}},
+			changed: []string{"00g1"},
+		},
+		{
+			name:    "added and removed",
+			left:    ResourceSet{"00g1": group("00g1", "a", "")},
+			right:   ResourceSet{"00g2": group("00g2", "b", "")},
+			added:   []string{"00g2"},
+			removed: []string{"00g1"},
+		},
+		{
+			name:       "duplicate labels are not matched",
+			left:       ResourceSet{"00g1": group("00g1", "a", "")},
+			right:      ResourceSet{"00g2": group("00g2", "a", ""), "00g3": group("00g3", "a", "")},
+			added:      []string{"00g2", "00g3"},
+			removed:    []string{"00g1"},
+			duplicates: []string{"00g1", "00g2", "00g3"},
+		},
+	}
+
+	keys := func(objects []ObjectDiff) []string {
+		var keys []string
+		for _, object := range objects {
+			keys = append(keys, object.Key)
+		}
+		return keys
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := diffResourceSets("group/lists", test.left, test.right, &DiffOptions{})
+			if k := keys(got.Added); !reflect.DeepEqual(k, test.added) {
+				t.Errorf("added = %v, want %v", k, test.added)
+			}
+			if k := keys(got.Removed); !reflect.DeepEqual(k, test.removed) {
+				t.Errorf("removed = %v, want %v", k, test.removed)
+			}
+			if k := keys(got.Changed); !reflect.DeepEqual(k, test.changed) {
+				t.Errorf("changed = %v, want %v", k, test.changed)
+			}
+			if k := keys(got.Duplicates); !reflect.DeepEqual(k, test.duplicates) {
+				t.Errorf("duplicates = %v, want %v", k, test.duplicates)
+			}
+		})
+	}
+}
+
+func TestResourceDiffEmpty(t *testing.T) {
+	object := ObjectDiff{Key: "00g1", Label: "a"}
+
+	tests := []struct {
+		name string
+		diff ResourceDiff
+		want bool
+	}{
+		{name: "nothing", diff: ResourceDiff{Resource: "group/lists"}, want: true},
+		{name: "added", diff: ResourceDiff{Added: []ObjectDiff{object}}, want: false},
+		{name: "removed", diff: ResourceDiff{Removed: []ObjectDiff{object}}, want: false},
+		{name: "changed", diff: ResourceDiff{Changed: []ObjectDiff{object}}, want: false},
+		{name: "only duplicates", diff: ResourceDiff{Duplicates: []ObjectDiff{object}}, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.diff.Empty(); got != test.want {
+				t.Errorf("Empty() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
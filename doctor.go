@@ -0,0 +1,432 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	
+	"gopkg.in/yaml.v3"
+)
+
+// OktaClientSettings holds the parts of okta.yaml that decide how
+// okta-cli-client authenticates
+type OktaClientSettings struct {
+	OrgUrl            string   `yaml:"orgUrl"`
+	AuthorizationMode string   `yaml:"authorizationMode"`
+	Token             string   `yaml:"token"`
+	ClientId          string   `yaml:"clientId"`
+	Scopes            []string `yaml:"scopes"`
+	PrivateKey        string   `yaml:"privateKey"`
+}
+
+// DoctorCheck is the outcome of probing one resource type
+type DoctorCheck struct {
+	Resource string
+	Command  string
+	// Status is one of "ok", "unauthorized", "forbidden", "not found" or "error"
+	Status string
+	Detail string
+}
+
+// ReadOktaClientSettings reads the okta.client section of an okta.yaml file
+func ReadOktaClientSettings(configPath string) (*OktaClientSettings, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %w", err)
+	}
+	
+	var file struct {
+		Okta struct {
+			Client OktaClientSettings `yaml:"client"`
+		} `yaml:"okta"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("could not parse config file: %w", err)
+	}
+	
+	settings := file.Okta.Client
+	if settings.AuthorizationMode == "" {
+		settings.AuthorizationMode = "SSWS"
+	}
+	
+	return &settings, nil
+}
+
+// getReadScopeForResource returns the OAuth scope needed to read a resource type
+func getReadScopeForResource(resourceName string) string {
+	scopeMap := map[string]string{
+		"user":                        "okta.users.read",
+		"userType":                    "okta.userTypes.read",
+		"userFactor":                  "okta.users.read",
+		"group":                       "okta.groups.read",
+		"groupOwner":                  "okta.groups.read",
+		"application":                 "okta.apps.read",
+		"applicationGroups":           "okta.apps.read",
+		"applicationUsers":            "okta.apps.read",
+		"applicationCredentials":      "okta.apps.read",
+		"applicationFeatures":         "okta.apps.read",
+		"applicationConnections":      "okta.apps.read",
+		"authorizationServer":         "okta.authorizationServers.read",
+		"authorizationServerClaims":   "okta.authorizationServers.read",
+		"authorizationServerScopes":   "okta.authorizationServers.read",
+		"authorizationServerPolicies": "okta.authorizationServers.read",
+		"authorizationServerClients":  "okta.authorizationServers.read",
+		"authorizationServerRules":    "okta.authorizationServers.read",
+		"identityProvider":            "okta.idps.read",
+		"networkZone":                 "okta.networkZones.read",
+		"trustedOrigin":               "okta.trustedOrigins.read",
+		"apiToken":                    "okta.apiTokens.read",
+		"customDomain":                "okta.domains.read",
+		"customization":               "okta.brands.read",
+		"eventHook":                   "okta.eventHooks.read",
+		"inlineHook":                  "okta.inlineHooks.read",
+		"hookKey":                     "okta.inlineHooks.read",
+		"policy":                      "okta.policies.read",
+		"role":                        "okta.roles.read",
+		"roleAssignment":              "okta.roles.read",
+		"feature":                     "okta.features.read",
+		"schema":                      "okta.schemas.read",
+		"emailDomain":                 "okta.emailDomains.read",
+		"template":                    "okta.templates.read",
+		"orgSetting":                  "okta.orgs.read",
+		"attackProtection":            "okta.userLockoutSettings.read",
+		"threatInsight":               "okta.threatInsights.read",
+		"rateLimitSettings":           "okta.orgs.read",
+	}
+	
+	return scopeMap[resourceName]
+}
+
+// getManageScopeForResource returns the OAuth scope needed to restore a resource type
+func getManageScopeForResource(resourceName string) string {
+	scope := getReadScopeForResource(resourceName)
+	if scope == "" {
+		return ""
+	}
+	return strings.TrimSuffix(scope, ".read") + ".manage"
+}
+
+// httpStatusPattern finds the HTTP status an okta-cli-client error reports,
+// as in "status code 403" or "404 Not Found", and not digits that happen to
+// be part of an ID or org name
+var httpStatusPattern = regexp.MustCompile(`(?i)\b(?:status(?:\s+code)?[:=\s]+(40[134])|(40[134])\s+(?:unauthorized|forbidden|not found))\b`)
+
+// classifyOktaCliError maps an okta-cli-client failure to a doctor status
+func classifyOktaCliError(err error) string {
+	matches := httpStatusPattern.FindStringSubmatch(err.Error())
+	if matches == nil {
+		return "error"
+	}
+	switch matches[1] + matches[2] {
+	case "401":
+		return "unauthorized"
+	case "403":
+		return "forbidden"
+	case "404":
+		return "not found"
+	}
+	return "error"
+}
+
+// PerformDoctor validates the configuration and credentials and probes one
+// read endpoint per resource type, reporting what backup and restore will skip
+func PerformDoctor(cfg *Config) error {
+	problems := 0
+	
+	fmt.Println("Checking configuration...")
+	fmt.Printf("  Org: %s (%s)\n", cfg.OrgName, cfg.OktaDomain)
+	
+	settings, err := ReadOktaClientSettings(cfg.ConfigFilePath)
+	if err != nil {
+		return err
+	}
+	
+	if settings.OrgUrl == "" {
+		fmt.Println("  Problem: okta.client.orgUrl is not set")
+		problems++
+	} else if !strings.Contains(settings.OrgUrl, cfg.OrgName) {
+		fmt.Printf("  Problem: orgUrl %s does not point at %s\n", settings.OrgUrl, cfg.OrgName)
+		problems++
+	}
+	
+	fmt.Printf("  Authorization mode: %s\n", settings.AuthorizationMode)
+	switch settings.AuthorizationMode {
+	case "SSWS":
+		if settings.Token == "" {
+			fmt.Println("  Problem: okta.client.token is required for SSWS authorization")
+			problems++
+		}
+	case "PrivateKey":
+		if settings.ClientId == "" {
+			fmt.Println("  Problem: okta.client.clientId is required for PrivateKey authorization")
+			problems++
+		}
+		if settings.PrivateKey == "" {
+			fmt.Println("  Problem: okta.client.privateKey is required for PrivateKey authorization")
+			problems++
+		}
+		if len(settings.Scopes) == 0 {
+			fmt.Println("  Problem: okta.client.scopes is empty, every request will be rejected")
+			problems++
+		}
+	default:
+		fmt.Printf("  Problem: unsupported authorization mode %s\n", settings.AuthorizationMode)
+		problems++
+	}
+	
+	if _, err := exec.LookPath("okta-cli-client"); err != nil {
+		fmt.Println("  Problem: okta-cli-client was not found on PATH, see the README for setup")
+		return fmt.Errorf("doctor found %d problem(s)", problems+1)
+	}
+	
+	fmt.Println("Checking credentials...")
+	if _, err := RunOktaCli(cfg, "orgSetting", "gets"); err != nil {
+		status := classifyOktaCliError(err)
+		if status == "unauthorized" {
+			fmt.Printf("  Problem: the org rejected the credentials (%v)\n", err)
+			fmt.Println("  The token may be expired or revoked, or the service app may be inactive.")
+			return fmt.Errorf("doctor found %d problem(s)", problems+1)
+		}
+		fmt.Printf("  Warning: could not read org settings: %v\n", err)
+	} else {
+		fmt.Println("  Credentials accepted")
+	}
+	
+	if settings.AuthorizationMode == "SSWS" {
+		problems += checkAdminRoles(cfg)
+	}
+	
+	fmt.Println("Probing resource types...")
+	checks := probeResourceTypes(cfg)
+	// failed holds the resource types whose objects could not be listed, so
+	// nothing that needs their IDs can be read either
+	failed := make(map[string]bool)
+	backupSkips := make(map[string]bool)
+	for _, check := range checks {
+		if check.Status == "ok" {
+			fmt.Printf("  ok        %s %s\n", check.Resource, check.Command)
+			continue
+		}
+		fmt.Printf("  %-9s %s %s: %s\n", check.Status, check.Resource, check.Command, check.Detail)
+		backupSkips[check.Resource+"/"+check.Command] = true
+		if check.Command == "lists" {
+			failed[check.Resource] = true
+		}
+		problems++
+	}
+	
+	granted := make(map[string]bool)
+	for _, scope := range settings.Scopes {
+		granted[scope] = true
+	}
+	
+	backupConfig := GetBackupConfig()
+	var missingRead, missingManage []string
+	restoreSkips := make(map[string]bool)
+	if settings.AuthorizationMode == "PrivateKey" {
+		seen := make(map[string]bool)
+		for _, name := range registryResourceNames(backupConfig) {
+			if scope := getReadScopeForResource(name); scope != "" && !granted[scope] && !seen[scope] {
+				missingRead = append(missingRead, scope)
+				seen[scope] = true
+			}
+			if scope := getManageScopeForResource(name); scope != "" && !granted[scope] && !seen[scope] {
+				missingManage = append(missingManage, scope)
+				seen[scope] = true
+			}
+		}
+		for _, group := range [][]BackupConfigResource{backupConfig.FirstPassResources, backupConfig.SecondPassResources, backupConfig.SingletonResources} {
+			for _, resource := range group {
+				if scope := getManageScopeForResource(resource.Name); scope != "" && !granted[scope] {
+					restoreSkips[resource.entryName()] = true
+				}
+			}
+		}
+		
+		if len(missingRead) > 0 {
+			fmt.Printf("Missing read scopes (needed for backup): %s\n", strings.Join(missingRead, ", "))
+			problems++
+		}
+		if len(missingManage) > 0 {
+			fmt.Printf("Missing manage scopes (needed for restore): %s\n", strings.Join(missingManage, ", "))
+		}
+	}
+	
+	for _, resource := range backupConfig.SecondPassResources {
+		if failed[resource.SourceIDDir] {
+			backupSkips[resource.entryName()] = true
+		}
+	}
+	for name := range backupSkips {
+		restoreSkips[name] = true
+	}
+	
+	if len(backupSkips) > 0 {
+		fmt.Printf("Backup will skip: %s\n", strings.Join(sortedKeys(backupSkips), ", "))
+	}
+	if len(restoreSkips) > 0 {
+		fmt.Printf("Restore will skip: %s\n", strings.Join(sortedKeys(restoreSkips), ", "))
+	}
+	
+	if problems > 0 {
+		return fmt.Errorf("doctor found %d problem(s)", problems)
+	}
+	
+	fmt.Println("No problems found!")
+	return nil
+}
+
+// checkAdminRoles reports the admin roles held by the API token's owner.
+// Tokens inherit the permissions of the admin who created them, so anything
+// short of a super admin will 403 on some resource types.
+func checkAdminRoles(cfg *Config) int {
+	fmt.Println("Checking admin roles...")
+	
+	data, err := RunOktaCli(cfg, "user", "get", "--userId", "me")
+	if err != nil {
+		fmt.Printf("  Warning: could not look up the token owner: %v\n", err)
+		return 0
+	}
+	
+	var user map[string]interface{}
+	if err := json.Unmarshal(data, &user); err != nil {
+		fmt.Printf("  Warning: error parsing current user: %v\n", err)
+		return 0
+	}
+	
+	userID, _ := user["id"].(string)
+	data, err = RunOktaCli(cfg, "roleAssignment", "listAssignedRolesForUser", "--userId", userID)
+	if err != nil {
+		fmt.Printf("  Warning: could not list admin roles for %s: %v\n", userID, err)
+		return 0
+	}
+	
+	var roles []map[string]interface{}
+	if err := json.Unmarshal(data, &roles); err != nil {
+		fmt.Printf("  Warning: error parsing admin roles: %v\n", err)
+		return 0
+	}
+	
+	var roleTypes []string
+	for _, role := range roles {
+		if roleType, ok := role["type"].(string); ok {
+			roleTypes = append(roleTypes, roleType)
+		}
+	}
+	fmt.Printf("  Token owner %s holds: %s\n", userID, strings.Join(roleTypes, ", "))
+	
+	for _, roleType := range roleTypes {
+		if roleType == "SUPER_ADMIN" {
+			return 0
+		}
+	}
+	
+	fmt.Println("  Problem: the token owner is not a SUPER_ADMIN, some resource types will be forbidden")
+	return 1
+}
+
+// probeResourceTypes reads one page of every resource type in the backup
+// registry. Second pass types are read for the first parent object found,
+// and are left out when the org has none.
+func probeResourceTypes(cfg *Config) []DoctorCheck {
+	backupConfig := GetBackupConfig()
+	seen := make(map[string]bool)
+	parentIDs := make(map[string]string)
+	var checks []DoctorCheck
+	
+	probe := func(resource BackupConfigResource, parentID string) {
+		command := resource.ListCommand
+		if resource.IsSingleton && resource.GetCommand != "" {
+			command = resource.GetCommand
+		}
+		if command == "" || seen[resource.Name+"/"+command] {
+			return
+		}
+		seen[resource.Name+"/"+command] = true
+		
+		args := []string{resource.Name, command}
+		if parentID != "" {
+			args = append(args, fmt.Sprintf("--%s", getParameterFlagForResource(resource.Name)), parentID)
+		}
+		if len(resource.ListTypes) > 0 {
+			args = append(args, "--type", resource.ListTypes[0])
+		}
+		
+		check := DoctorCheck{Resource: resource.Name, Command: command, Status: "ok"}
+		output, err := probeOnePage(cfg, args, resource.IsSingleton)
+		if err != nil {
+			check.Status = classifyOktaCliError(err)
+			check.Detail = err.Error()
+			if scope := getReadScopeForResource(resource.Name); scope != "" && check.Status != "error" {
+				check.Detail = fmt.Sprintf("requires %s", scope)
+			}
+		} else if resource.objectType() == resource.Name && parentIDs[resource.Name] == "" {
+			var items []map[string]interface{}
+			if json.Unmarshal(output, &items) == nil && len(items) > 0 {
+				parentIDs[resource.Name], _ = items[0]["id"].(string)
+			}
+		}
+		checks = append(checks, check)
+	}
+	
+	for _, resource := range backupConfig.FirstPassResources {
+		probe(resource, "")
+	}
+	for _, resource := range backupConfig.SingletonResources {
+		probe(resource, "")
+	}
+	for _, resource := range backupConfig.SecondPassResources {
+		if parentID := parentIDs[resource.SourceIDDir]; parentID != "" {
+			probe(resource, parentID)
+		}
+	}
+	
+	return checks
+}
+
+// probeOnePage runs a read command asking for a single item, for list
+// commands that take a limit
+func probeOnePage(cfg *Config, args []string, singleton bool) ([]byte, error) {
+	if singleton {
+		return RunOktaCli(cfg, args...)
+	}
+	output, err := RunOktaCli(cfg, append(args, "--limit", "1")...)
+	if err != nil && strings.Contains(err.Error(), "unknown flag") {
+		return RunOktaCli(cfg, args...)
+	}
+	return output, err
+}
+
+// registryResourceNames returns every distinct resource name in the backup registry
+func registryResourceNames(backupConfig *BackupConfig) []string {
+	seen := make(map[string]bool)
+	var names []string
+	
+	for _, group := range [][]BackupConfigResource{
+		backupConfig.FirstPassResources,
+		backupConfig.SingletonResources,
+		backupConfig.SecondPassResources,
+	} {
+		for _, resource := range group {
+			if !seen[resource.Name] {
+				seen[resource.Name] = true
+				names = append(names, resource.Name)
+			}
+		}
+	}
+	
+	return names
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassifyOktaCliError(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want string
+	}{
+		{"exit status 1: 401 Unauthorized", "unauthorized"},
+		{"exit status 1: the API returned status code 403", "forbidden"},
+		{"exit status 1: 404 Not Found: Resource not found: 00u1404xyz", "not found"},
+		{"exit status 1: status: 404", "not found"},
+		{"exit status 1: could not reach dev-1401234.okta.com", "error"},
+		{"exit status 1: no such user 00g4034040403abcdef", "error"},
+		{"exit status 1: 429 Too Many Requests", "error"},
+		{"exit status 2", "error"},
+	}
+
+	for _, test := range tests {
+		if got := classifyOktaCliError(errors.New(test.msg)); got != test.want {
+			t.Errorf("classifyOktaCliError(%q) = %q, want %q", test.msg, got, test.want)
+		}
+	}
+}
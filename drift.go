@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FetchLiveResources reads the current state of every resource type in the
+// registry from an org, keyed the same way as loadSnapshotResources. Types
+// that cannot be read are reported and left out.
+func FetchLiveResources(cfg *Config, config *BackupConfig) map[string]ResourceSet {
+	resources := make(map[string]ResourceSet)
+
+	for _, resource := range config.FirstPassResources {
+		items, err := listResourceObjects(cfg, resource)
+		if err != nil {
+			fmt.Printf("Warning: could not read %s %s from %s: %v\n", resource.Name, resource.ListCommand, cfg.OrgName, err)
+			continue
+		}
+		resources[resource.Name+"/"+resource.ListCommand] = resourceSetFromList(resource, items)
+	}
+
+	for _, resource := range config.SingletonResources {
+		data, err := RunOktaCli(cfg, resource.Name, resource.GetCommand)
+		if err != nil {
+			fmt.Printf("Warning: could not read %s %s from %s: %v\n", resource.Name, resource.GetCommand, cfg.OrgName, err)
+			continue
+		}
+
+		var object map[string]interface{}
+		if err := json.Unmarshal(data, &object); err != nil {
+			fmt.Printf("Warning: error parsing %s %s: %v\n", resource.Name, resource.GetCommand, err)
+			continue
+		}
+		resources[resource.Name+"/"+resource.GetCommand] = ResourceSet{resource.GetCommand: object}
+	}
+
+	for _, resource := range config.SecondPassResources {
+		if resource.SourceListCommand != "" {
+			resources[resource.Name+"/"+resource.ListCommand] = readNestedChildObjects(cfg, resource, resources)
+			continue
+		}
+
+		parents, ok := resources[resource.SourceIDDir+"/lists"]
+		if !ok {
+			continue
+		}
+
+		set := make(ResourceSet)
+		for parentID, parent := range parents {
+			if !resource.appliesTo(parent) {
+				continue
+			}
+			children, err := listChildObjects(cfg, resource, parentID)
+			if err != nil {
+				fmt.Printf("Warning: could not read %s %s for %s: %v\n", resource.Name, resource.ListCommand, parentID, err)
+				continue
+			}
+			for id, object := range children {
+				set[parentID+"/"+id] = object
+			}
+		}
+		resources[resource.Name+"/"+resource.ListCommand] = set
+	}
+
+	return resources
+}
+
+// readNestedChildObjects reads the children of second pass objects already
+// read into resources, keyed like the backup stores them: parent ID/child ID
+func readNestedChildObjects(cfg *Config, resource BackupConfigResource, resources map[string]ResourceSet) ResourceSet {
+	set := make(ResourceSet)
+	for key := range resources[resource.SourceIDDir+"/"+resource.SourceListCommand] {
+		grandparentID, parentID, ok := strings.Cut(key, "/")
+		if !ok {
+			continue
+		}
+		children, err := listNestedChildObjects(cfg, resource, grandparentID, parentID)
+		if err != nil {
+			fmt.Printf("Warning: could not read %s %s for %s: %v\n", resource.Name, resource.ListCommand, parentID, err)
+			continue
+		}
+		for id, object := range children {
+			set[parentID+"/"+id] = object
+		}
+	}
+	return set
+}
+
+// resourceSetFromList keys one entry's list results by ID
+func resourceSetFromList(resource BackupConfigResource, items []map[string]interface{}) ResourceSet {
+	set := make(ResourceSet)
+	for _, item := range items {
+		if id, ok := listedObjectID(resource, item); ok {
+			set[id] = item
+		}
+	}
+	return set
+}
+
+// alignSingletons rekeys live singleton objects to the file name the snapshot
+// stored them under, so the two are compared rather than reported as
+// one removed and one added
+func alignSingletons(config *BackupConfig, snapshot, live map[string]ResourceSet) {
+	for _, resource := range config.SingletonResources {
+		name := resource.Name + "/" + resource.GetCommand
+		if len(snapshot[name]) != 1 || len(live[name]) != 1 {
+			continue
+		}
+		for snapshotKey := range snapshot[name] {
+			for _, object := range live[name] {
+				live[name] = ResourceSet{snapshotKey: object}
+			}
+		}
+	}
+}
+
+// DetectDrift compares a snapshot with the live org it was taken from
+func DetectDrift(cfg *Config, snapshotDir string, filter *ResourceFilter, opts *DiffOptions) (*Diff, error) {
+	if _, err := os.Stat(snapshotDir); err != nil {
+		return nil, fmt.Errorf("cannot read snapshot %s: %w", snapshotDir, err)
+	}
+
+	if manifest, err := ReadManifest(snapshotDir); err == nil {
+		if manifest.OrgName != cfg.OrgName {
+			return nil, fmt.Errorf("snapshot %s is of %s, not %s", snapshotDir, manifest.OrgName, cfg.OrgName)
+		}
+		if len(manifest.ListFilters) > 0 {
+			fmt.Println("Warning: the snapshot was filtered, objects outside the filter will show up as added")
+		}
+	}
+
+	config := GetBackupConfig().Filter(filter)
+	snapshot := loadSnapshotResources(snapshotDir, config)
+
+	// Only resource types the snapshot actually covers can drift
+	covered := &BackupConfig{}
+	for _, resource := range config.FirstPassResources {
+		if _, ok := snapshot[resource.Name+"/"+resource.ListCommand]; ok {
+			covered.FirstPassResources = append(covered.FirstPassResources, resource)
+		}
+	}
+	for _, resource := range config.SingletonResources {
+		if _, ok := snapshot[resource.Name+"/"+resource.GetCommand]; ok {
+			covered.SingletonResources = append(covered.SingletonResources, resource)
+		}
+	}
+	for _, resource := range config.SecondPassResources {
+		if _, ok := snapshot[resource.Name+"/"+resource.ListCommand]; ok {
+			covered.SecondPassResources = append(covered.SecondPassResources, resource)
+		}
+	}
+
+	fmt.Printf("Fetching current state of %s...\n", cfg.OrgName)
+	live := FetchLiveResources(cfg, covered)
+	alignSingletons(covered, snapshot, live)
+
+	// A type that could not be read is not drift
+	for name := range snapshot {
+		if _, ok := live[name]; !ok {
+			delete(snapshot, name)
+		}
+	}
+
+	return diffResources(snapshotDir, cfg.OrgName, snapshot, live, opts), nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectDrift(t *testing.T) {
+	group := func(id, name, description string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "type": "OKTA_GROUP", "lastUpdated": "2026-10-01T00:00:00.000Z",
+			"profile": map[string]interface{}{"name": name, "description": description}}
+	}
+
+	snapshotDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"manifest":         {"org": "dev-111"},
+		"group/lists/00g1": group("00g1", "Engineering", "builds things"),
+		"group/lists/00g2": group("00g2", "Sales", "sells things"),
+	})
+	cfg := &Config{OrgName: "dev-111"}
+	filter := &ResourceFilter{Include: []string{"group/lists"}}
+
+	tests := []struct {
+		name       string
+		live       interface{}
+		added      []string
+		removed    []string
+		changed    []string
+		duplicates []string
+	}{
+		{
+			name: "no drift",
+			live: []interface{}{group("00g1", "Engineering", "builds things"), group("00g2", "Sales", "sells things")},
+		},
+		{
+			name: "volatile fields are not drift",
+			live: []interface{}{
+				map[string]interface{}{"id": "00g1", "type": "OKTA_GROUP", "lastUpdated": "2026-10-18T00:00:00.000Z",
+					"profile": map[string]interface{}{"name": "Engineering", "description": "builds things"}},
+				group("00g2", "Sales", "sells things"),
+			},
+		},
+		{
+			name:    "changed, added and removed",
+			live:    []interface{}{group("00g1", "Engineering", "ships things"), group("00g3", "Support", "")},
+			added:   []string{"00g3"},
+			removed: []string{"00g2"},
+			changed: []string{"00g1"},
+		},
+		{
+			name:       "recreated twice under the same name",
+			live:       []interface{}{group("00g1", "Engineering", "builds things"), group("00g8", "Sales", "sells things"), group("00g9", "Sales", "sells things")},
+			added:      []string{"00g8", "00g9"},
+			removed:    []string{"00g2"},
+			duplicates: []string{"00g2", "00g8", "00g9"},
+		},
+		{
+			name: "type that cannot be read",
+		},
+	}
+
+	keys := func(objects []ObjectDiff) []string {
+		var keys []string
+		for _, object := range objects {
+			keys = append(keys, object.Key)
+		}
+		return keys
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := map[string]interface{}{}
+			if test.live != nil {
+				responses["group lists"] = test.live
+			}
+			fakeOktaCli(t, responses)
+
+			diff, err := DetectDrift(cfg, snapshotDir, filter, &DiffOptions{})
+			if err != nil {
+				t.Fatalf("DetectDrift() returned %v", err)
+			}
+
+			var got ResourceDiff
+			for _, resource := range diff.Resources {
+				if resource.Resource == "group/lists" {
+					got = resource
+				}
+			}
+			if k := keys(got.Added); !reflect.DeepEqual(k, test.added) {
+				t.Errorf("added = %v, want %v", k, test.added)
+			}
+			if k := keys(got.Removed); !reflect.DeepEqual(k, test.removed) {
+				t.Errorf("removed = %v, want %v", k, test.removed)
+			}
+			if k := keys(got.Changed); !reflect.DeepEqual(k, test.changed) {
+				t.Errorf("changed = %v, want %v", k, test.changed)
+			}
+			if k := keys(got.Duplicates); !reflect.DeepEqual(k, test.duplicates) {
+				t.Errorf("duplicates = %v, want %v", k, test.duplicates)
+			}
+			wantEmpty := test.added == nil && test.removed == nil && test.changed == nil && test.duplicates == nil
+			if diff.Empty() != wantEmpty {
+				t.Errorf("Empty() = %v, want %v", diff.Empty(), wantEmpty)
+			}
+		})
+	}
+}
+
+func TestDetectDriftRefusesOtherOrg(t *testing.T) {
+	snapshotDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"manifest": {"org": "dev-111"},
+	})
+	fakeOktaCli(t, map[string]interface{}{})
+
+	if _, err := DetectDrift(&Config{OrgName: "dev-222"}, snapshotDir, &ResourceFilter{}, &DiffOptions{}); err == nil {
+		t.Error("DetectDrift() against another org returned no error")
+	}
+}
+
+func TestAlignSingletons(t *testing.T) {
+	config := &BackupConfig{SingletonResources: []BackupConfigResource{{Name: "orgSetting", GetCommand: "gets", IsSingleton: true}}}
+	settings := map[string]interface{}{"companyName": "Example"}
+
+	snapshot := map[string]ResourceSet{"orgSetting/gets": {"orgsetting": settings}}
+	live := map[string]ResourceSet{"orgSetting/gets": {"gets": settings}}
+	alignSingletons(config, snapshot, live)
+
+	if want := (ResourceSet{"orgsetting": settings}); !reflect.DeepEqual(live["orgSetting/gets"], want) {
+		t.Errorf("alignSingletons() live = %v, want %v", live["orgSetting/gets"], want)
+	}
+}
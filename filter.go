@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ListFilter narrows the objects a first pass list command backs up.
+// Filters are written as resource:key=value, for example
+//
+//	user:search=profile.department eq "Engineering"
+//	group:q=Engineering
+//	application:where=signOnMode==SAML_2_0
+//	user:memberOf=Engineering
+//
+// search, filter and q are passed to the Okta list endpoint as query
+// parameters. where, memberOf and assignedTo are checked locally.
+type ListFilter struct {
+	Resource string
+	Key      string
+	Value    string
+	// pattern is the compiled regexp of a where ~= predicate
+	pattern *regexp.Regexp
+}
+
+// queryFilterKeys are the list endpoint query parameters passed through to okta-cli-client
+var queryFilterKeys = map[string]bool{
+	"search": true,
+	"filter": true,
+	"q":      true,
+}
+
+// localFilterKeys are the predicates envsync evaluates itself
+var localFilterKeys = map[string]bool{
+	// where compares a dotted JSON field with ==, != or ~= (regexp)
+	"where": true,
+	// memberOf keeps users that belong to the named group
+	"memberOf": true,
+	// assignedTo keeps applications assigned to the named group
+	"assignedTo": true,
+}
+
+var wherePattern = regexp.MustCompile(`^([A-Za-z0-9_.]+)\s*(==|!=|~=)\s*(.*)$`)
+
+// ParseListFilters parses --filter expressions into filters keyed by resource name
+func ParseListFilters(exprs []string) (map[string][]ListFilter, error) {
+	// Filters narrow the lists of the first pass, which are keyed by object type
+	known := make(map[string]bool)
+	for _, resource := range GetBackupConfig().FirstPassResources {
+		known[resource.objectType()] = true
+	}
+
+	filters := make(map[string][]ListFilter)
+	for _, expr := range exprs {
+		resource, rest, ok := strings.Cut(expr, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid filter %q, expected resource:key=value", expr)
+		}
+		if !known[resource] {
+			return nil, fmt.Errorf("unknown resource %q in filter %q", resource, expr)
+		}
+
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid filter %q, expected resource:key=value", expr)
+		}
+
+		if !queryFilterKeys[key] && !localFilterKeys[key] {
+			return nil, fmt.Errorf("unknown filter %q in %q", key, expr)
+		}
+
+		filter := ListFilter{Resource: resource, Key: key, Value: value}
+		if key == "where" {
+			matches := wherePattern.FindStringSubmatch(value)
+			if matches == nil {
+				return nil, fmt.Errorf("invalid where predicate %q, expected field==value, field!=value or field~=regexp", value)
+			}
+			if matches[2] == "~=" {
+				pattern, err := regexp.Compile(strings.Trim(matches[3], `"`))
+				if err != nil {
+					return nil, fmt.Errorf("invalid regexp in where predicate %q: %w", value, err)
+				}
+				filter.pattern = pattern
+			}
+		}
+		if key == "memberOf" && resource != "user" {
+			return nil, fmt.Errorf("memberOf only applies to user, not %s", resource)
+		}
+		if key == "assignedTo" && resource != "application" {
+			return nil, fmt.Errorf("assignedTo only applies to application, not %s", resource)
+		}
+
+		filters[resource] = append(filters[resource], filter)
+	}
+
+	return filters, nil
+}
+
+// lookupJSONPath follows a dotted path such as profile.login through a decoded JSON object
+func lookupJSONPath(object map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = object
+
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// matchesWhere evaluates the predicate of a where filter against an object
+func matchesWhere(object map[string]interface{}, filter ListFilter) bool {
+	matches := wherePattern.FindStringSubmatch(filter.Value)
+	field, op, expected := matches[1], matches[2], strings.Trim(matches[3], `"`)
+
+	value, ok := lookupJSONPath(object, field)
+	actual := ""
+	if ok {
+		actual = fmt.Sprint(value)
+	}
+
+	switch op {
+	case "==":
+		return ok && actual == expected
+	case "!=":
+		return !ok || actual != expected
+	case "~=":
+		return ok && filter.pattern.MatchString(actual)
+	}
+
+	return false
+}
+
+// findGroupIDByName looks a group up by its exact profile name
+func findGroupIDByName(cfg *Config, name string) (string, error) {
+	groups, err := RunOktaCliList(cfg, "group", "lists", "--q", name)
+	if err != nil {
+		return "", fmt.Errorf("error looking up group %s: %w", name, err)
+	}
+
+	for _, group := range groups {
+		if profile, ok := group["profile"].(map[string]interface{}); ok && profile["name"] == name {
+			id, _ := group["id"].(string)
+			return id, nil
+		}
+	}
+
+	return "", fmt.Errorf("no group named %s", name)
+}
+
+// groupLinkedIDs returns the IDs a group links to through one of its list
+// commands, e.g. its members or its assigned applications
+func groupLinkedIDs(cfg *Config, groupName, listCommand string) (map[string]bool, error) {
+	groupID, err := findGroupIDByName(cfg, groupName)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := RunOktaCliList(cfg, "group", listCommand, "--groupId", groupID)
+	if err != nil {
+		return nil, fmt.Errorf("error running group %s for %s: %w", listCommand, groupName, err)
+	}
+
+	ids := make(map[string]bool)
+	for _, item := range items {
+		if id, ok := item["id"].(string); ok {
+			ids[id] = true
+		}
+	}
+
+	return ids, nil
+}
+
+// checkFilteredOutputDir makes sure a filtered backup has a directory of its
+// own, either new or holding an earlier filtered backup of the org, so it
+// never replaces the objects of a full snapshot with a subset
+func checkFilteredOutputDir(cfg *Config, outputDir string) error {
+	entries, err := os.ReadDir(outputDir)
+	if os.IsNotExist(err) || (err == nil && len(entries) == 0) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read output directory %s: %w", outputDir, err)
+	}
+
+	if manifest, err := ReadManifest(outputDir); err == nil && manifest.OrgName == cfg.OrgName && len(manifest.ListFilters) > 0 {
+		return nil
+	}
+	return fmt.Errorf("%s holds a backup that is not filtered; write filtered backups to a new directory with --output", outputDir)
+}
+
+// backupFilteredResource lists one first pass resource with its filters
+// applied and writes the surviving objects where the batch backup would have,
+// replacing anything an earlier filtered backup left there. Second pass
+// resources read their IDs from that directory, so they only cover the
+// survivors.
+func backupFilteredResource(cfg *Config, resource BackupConfigResource, filters []ListFilter, outputDir string) error {
+	var args []string
+	for _, filter := range filters {
+		if queryFilterKeys[filter.Key] {
+			args = append(args, "--"+filter.Key, filter.Value)
+		}
+	}
+
+	items, err := listResourceObjects(cfg, resource, args...)
+	if err != nil {
+		return err
+	}
+
+	linked := make(map[string]map[string]bool)
+	for _, filter := range filters {
+		var listCommand string
+		switch filter.Key {
+		case "memberOf":
+			listCommand = "listUsers"
+		case "assignedTo":
+			listCommand = "listAssignedApplicationsFor"
+		default:
+			continue
+		}
+
+		ids, err := groupLinkedIDs(cfg, filter.Value, listCommand)
+		if err != nil {
+			return err
+		}
+		linked[filter.Key+"="+filter.Value] = ids
+	}
+
+	resourceDir := filepath.Join(outputDir, strings.ToLower(resource.Name), resource.ListCommand)
+	if err := os.MkdirAll(resourceDir, 0755); err != nil {
+		return fmt.Errorf("could not create directory %s: %w", resourceDir, err)
+	}
+
+	stale, err := getResourceIDsFromDirectory(resourceDir)
+	if err != nil {
+		return err
+	}
+	for _, id := range stale {
+		os.Remove(filepath.Join(resourceDir, id+".json"))
+	}
+
+	kept := 0
+	for _, item := range items {
+		id, _ := item["id"].(string)
+		if id == "" {
+			continue
+		}
+
+		keep := true
+		for _, filter := range filters {
+			switch filter.Key {
+			case "where":
+				keep = keep && matchesWhere(item, filter)
+			case "memberOf", "assignedTo":
+				keep = keep && linked[filter.Key+"="+filter.Value][id]
+			}
+		}
+		if !keep {
+			continue
+		}
+
+		if err := writeBackupObject(resourceDir, id, item); err != nil {
+			return fmt.Errorf("error backing up %s: %w", resource.Name, err)
+		}
+		kept++
+	}
+
+	fmt.Printf("Kept %d of %d %s objects after filtering\n", kept, len(items), resource.Name)
+	return nil
+}
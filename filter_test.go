@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func TestParseListFilters(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{`user:search=profile.department eq "Engineering"`, false},
+		{"group:q=Engineering", false},
+		{"groupRule:where=status==ACTIVE", false},
+		{"application:where=signOnMode==SAML_2_0", false},
+		{"application:where=label~=^(Sales|HR) ", false},
+		{"user:memberOf=Engineering", false},
+		{"application:assignedTo=Engineering", false},
+		{"user", true},
+		{"user:q", true},
+		{"user:q=", true},
+		{"usr:q=x", true},
+		{"user/listGroups:q=x", true},
+		{"user:sort=x", true},
+		{"user:where=profile.login", true},
+		{"user:where=profile.login~=(", true},
+		{"group:memberOf=Engineering", true},
+		{"user:assignedTo=Engineering", true},
+	}
+
+	for _, test := range tests {
+		filters, err := ParseListFilters([]string{test.expr})
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseListFilters(%q) = %v, want an error", test.expr, filters)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseListFilters(%q) returned %v", test.expr, err)
+		}
+	}
+}
+
+func TestMatchesWhere(t *testing.T) {
+	user := map[string]interface{}{
+		"status": "ACTIVE",
+		"profile": map[string]interface{}{
+			"login":      "ada@example.com",
+			"department": "Engineering",
+			"level":      float64(3),
+		},
+	}
+
+	tests := []struct {
+		predicate string
+		want      bool
+	}{
+		{"status==ACTIVE", true},
+		{`status=="ACTIVE"`, true},
+		{"status==SUSPENDED", false},
+		{"status!=SUSPENDED", true},
+		{"profile.department==Engineering", true},
+		{"profile.level==3", true},
+		{"profile.login~=@example\\.com$", true},
+		{"profile.login~=^bob", false},
+		{"profile.missing==x", false},
+		{"profile.missing!=x", true},
+		{"profile.missing~=.*", false},
+		{"profile.login.first==ada", false},
+	}
+
+	for _, test := range tests {
+		filters, err := ParseListFilters([]string{"user:where=" + test.predicate})
+		if err != nil {
+			t.Fatalf("ParseListFilters(%q) returned %v", test.predicate, err)
+		}
+		if got := matchesWhere(user, filters["user"][0]); got != test.want {
+			t.Errorf("matchesWhere(%q) = %v, want %v", test.predicate, got, test.want)
+		}
+	}
+}
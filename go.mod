@@ -5,6 +5,7 @@ go 1.23.3
 require (
 	github.com/okta/okta-sdk-golang/v5 v5.0.4
 	github.com/spf13/cobra v1.9.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -30,7 +31,6 @@ require (
 	golang.org/x/oauth2 v0.0.0-20210323180902-22b0adad7558 // indirect
 	google.golang.org/appengine v1.6.6 // indirect
 	google.golang.org/protobuf v1.25.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
 replace github.com/okta/okta-cli-client => github.com/edunham/okta-cli-client v0.0.0-20250127201447-388c1aa70166
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// expressionIDPattern matches the quoted IDs an Okta Expression Language
+// condition names groups by, as in isMemberOfAnyGroup("00g...")
+var expressionIDPattern = regexp.MustCompile(`"(00[gu][0-9A-Za-z]{17})"`)
+
+// GroupRuleRestorer restores group rules once the groups and users they name
+// exist. Rules are created inactive, so the ones that were active are
+// activated again afterwards.
+type GroupRuleRestorer struct{}
+
+// translateExpression rewrites the IDs quoted in an expression and returns
+// the ones it has no new ID for
+func translateExpression(expression string, references map[string]string) (string, []string) {
+	var unmapped []string
+	translated := expressionIDPattern.ReplaceAllStringFunc(expression, func(quoted string) string {
+		id := expressionIDPattern.FindStringSubmatch(quoted)[1]
+		newID, ok := references[id]
+		if !ok {
+			unmapped = append(unmapped, id)
+			return quoted
+		}
+		return fmt.Sprintf("%q", newID)
+	})
+	return translated, unmapped
+}
+
+// translateGroupRule rewrites the group and user IDs a rule refers to, in its
+// actions, exclusions and expression, and returns the IDs it could not map
+func translateGroupRule(rule map[string]interface{}, references map[string]string) (map[string]interface{}, []string) {
+	var unmapped []string
+	if groupIDs, ok := lookupJSONPath(rule, "actions.assignUserToGroups.groupIds"); ok {
+		ids, _ := groupIDs.([]interface{})
+		for _, id := range ids {
+			if s, ok := id.(string); ok && references[s] == "" {
+				unmapped = append(unmapped, s)
+			}
+		}
+	}
+
+	translated := translateIDs(rule, references).(map[string]interface{})
+
+	if value, ok := lookupJSONPath(translated, "conditions.expression.value"); ok {
+		if expression, ok := value.(string); ok {
+			expression, missing := translateExpression(expression, references)
+			setJSONPath(translated, "conditions.expression.value", expression)
+			unmapped = append(unmapped, missing...)
+		}
+	}
+
+	return translated, unmapped
+}
+
+func (r *GroupRuleRestorer) Restore(cfg *Config, idMapping *IDMapping, journal *RestoreJournal, inputDir string, opts *RestoreOptions) error {
+	rulesDir := filepath.Join(inputDir, "group", "listRules")
+	if _, err := os.Stat(rulesDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	rules, err := readResourceObjects(rulesDir)
+	if err != nil {
+		return fmt.Errorf("error reading group rules: %w", err)
+	}
+
+	existing := make(map[string]string)
+	if opts.UpdateExisting {
+		items, err := RunOktaCliList(cfg, "group", "listRules")
+		if err != nil {
+			return fmt.Errorf("could not list group rules in %s: %w", cfg.OrgName, err)
+		}
+		for _, item := range items {
+			if id, ok := item["id"].(string); ok {
+				existing[objectLabel(item)] = id
+			}
+		}
+	}
+
+	oldIDs := make([]string, 0, len(rules))
+	for id := range rules {
+		oldIDs = append(oldIDs, id)
+	}
+	sort.Strings(oldIDs)
+
+	references := idReferences(idMapping)
+	for _, oldID := range oldIDs {
+		if !opts.selects("groupRule", oldID) {
+			continue
+		}
+		if newID, ok := idMapping.GetNewID("groupRule", oldID); ok {
+			fmt.Printf("group rule %s was already restored as %s, skipping...\n", oldID, newID)
+			continue
+		}
+
+		rule, unmapped := translateGroupRule(rules[oldID], references)
+		label := objectLabel(rule)
+		for _, id := range unmapped {
+			fmt.Printf("Warning: group rule %s refers to %s, which was not restored\n", label, id)
+		}
+
+		filePath, err := writeTempObject(rule)
+		if err != nil {
+			return err
+		}
+
+		newID := existing[label]
+		if newID != "" {
+			// Okta only lets inactive rules change
+			fmt.Printf("Updating group rule %s (%s) in place...\n", newID, label)
+			_, err = RunOktaCli(cfg, "group", "deactivateRule", "--groupRuleId", newID)
+			if err == nil {
+				_, err = RunOktaCli(cfg, "group", "replaceRule", "--groupRuleId", newID, "--restore-from", filePath)
+			}
+			if err == nil {
+				journal.Record("updateInPlace", map[string]string{"resource": "groupRule", "id": newID})
+			}
+		} else {
+			fmt.Printf("Restoring group rule %s from previous ID %s...\n", label, oldID)
+			newID, err = createGroupRule(cfg, filePath)
+		}
+		os.Remove(filePath)
+
+		if err != nil {
+			fmt.Printf("Warning: error restoring group rule %s: %v\n", oldID, err)
+			continue
+		}
+
+		idMapping.AddMapping("groupRule", oldID, newID)
+
+		if rule["status"] == "ACTIVE" {
+			if _, err := RunOktaCli(cfg, "group", "activateRule", "--groupRuleId", newID); err != nil {
+				fmt.Printf("Warning: failed to activate group rule %s: %v\n", newID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// createGroupRule creates a group rule from a file and returns its new ID
+func createGroupRule(cfg *Config, filePath string) (string, error) {
+	output, err := RunOktaCli(cfg, "group", "createRule", "--restore-from", filePath)
+	if err != nil {
+		return "", err
+	}
+
+	var created map[string]interface{}
+	if err := json.Unmarshal(output, &created); err != nil {
+		return "", fmt.Errorf("error parsing response: %w", err)
+	}
+
+	id, ok := created["id"].(string)
+	if !ok {
+		return "", fmt.Errorf("response does not contain ID field")
+	}
+	return id, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTranslateExpression(t *testing.T) {
+	references := map[string]string{
+		"00g1a2b3c4d5e6f7g8h9": "00gZZZZZZZZZZZZZZZZZ",
+		"00u1a2b3c4d5e6f7g8h9": "00uZZZZZZZZZZZZZZZZZ",
+	}
+
+	tests := []struct {
+		name       string
+		expression string
+		want       string
+		unmapped   []string
+	}{
+		{
+			name:       "group ID",
+			expression: `isMemberOfAnyGroup("00g1a2b3c4d5e6f7g8h9")`,
+			want:       `isMemberOfAnyGroup("00gZZZZZZZZZZZZZZZZZ")`,
+		},
+		{
+			name:       "several IDs, one unmapped",
+			expression: `isMemberOfAnyGroup("00g1a2b3c4d5e6f7g8h9", "00g9z8y7x6w5v4u3t2s1") && user.id != "00u1a2b3c4d5e6f7g8h9"`,
+			want:       `isMemberOfAnyGroup("00gZZZZZZZZZZZZZZZZZ", "00g9z8y7x6w5v4u3t2s1") && user.id != "00uZZZZZZZZZZZZZZZZZ"`,
+			unmapped:   []string{"00g9z8y7x6w5v4u3t2s1"},
+		},
+		{
+			name:       "no IDs",
+			expression: `user.department == "Engineering"`,
+			want:       `user.department == "Engineering"`,
+		},
+		{
+			name:       "unquoted and other IDs are left alone",
+			expression: `user.login == "0oa1a2b3c4d5e6f7g8h9" || 00g1a2b3c4d5e6f7g8h9`,
+			want:       `user.login == "0oa1a2b3c4d5e6f7g8h9" || 00g1a2b3c4d5e6f7g8h9`,
+		},
+		{
+			name:       "strings shorter than an ID",
+			expression: `user.title == "00gshort"`,
+			want:       `user.title == "00gshort"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, unmapped := translateExpression(test.expression, references)
+			if got != test.want {
+				t.Errorf("translateExpression() = %s, want %s", got, test.want)
+			}
+			if !reflect.DeepEqual(unmapped, test.unmapped) {
+				t.Errorf("translateExpression() unmapped = %v, want %v", unmapped, test.unmapped)
+			}
+		})
+	}
+}
+
+func TestTranslateGroupRule(t *testing.T) {
+	references := map[string]string{
+		"00g1a2b3c4d5e6f7g8h9": "00gZZZZZZZZZZZZZZZZZ",
+		"00u1a2b3c4d5e6f7g8h9": "00uZZZZZZZZZZZZZZZZZ",
+	}
+	rule := map[string]interface{}{
+		"name": "Engineers",
+		"conditions": map[string]interface{}{
+			"people":     map[string]interface{}{"users": map[string]interface{}{"exclude": []interface{}{"00u1a2b3c4d5e6f7g8h9"}}},
+			"expression": map[string]interface{}{"value": `isMemberOfAnyGroup("00g1a2b3c4d5e6f7g8h9")`},
+		},
+		"actions": map[string]interface{}{
+			"assignUserToGroups": map[string]interface{}{"groupIds": []interface{}{"00g1a2b3c4d5e6f7g8h9", "00g9z8y7x6w5v4u3t2s1"}},
+		},
+	}
+	want := map[string]interface{}{
+		"name": "Engineers",
+		"conditions": map[string]interface{}{
+			"people":     map[string]interface{}{"users": map[string]interface{}{"exclude": []interface{}{"00uZZZZZZZZZZZZZZZZZ"}}},
+			"expression": map[string]interface{}{"value": `isMemberOfAnyGroup("00gZZZZZZZZZZZZZZZZZ")`},
+		},
+		"actions": map[string]interface{}{
+			"assignUserToGroups": map[string]interface{}{"groupIds": []interface{}{"00gZZZZZZZZZZZZZZZZZ", "00g9z8y7x6w5v4u3t2s1"}},
+		},
+	}
+
+	got, unmapped := translateGroupRule(rule, references)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("translateGroupRule() = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(unmapped, []string{"00g9z8y7x6w5v4u3t2s1"}) {
+		t.Errorf("translateGroupRule() unmapped = %v, want [00g9z8y7x6w5v4u3t2s1]", unmapped)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// incrementalResources are the first pass resource types an incremental
+// backup refetches by lastUpdated. They are listed once, which tells both
+// which objects still exist and when each one last changed; only the changed
+// ones are written. Every other type is fetched in full.
+var incrementalResources = map[string]bool{
+	"user":        true,
+	"group":       true,
+	"application": true,
+}
+
+// relationshipEntries are the second pass entries that record links between
+// objects: memberships, assignments, owners and admin roles. Adding or
+// removing a link leaves the lastUpdated of both objects alone, so these are
+// refetched for every parent rather than only for changed ones.
+var relationshipEntries = map[string]bool{
+	"user/listGroups":                                   true,
+	"user/listAppLinks":                                 true,
+	"group/listUsers":                                   true,
+	"group/listAssignedApplicationsFor":                 true,
+	"groupOwner/lists":                                  true,
+	"roleAssignment/listAssignedRolesForUser":           true,
+	"applicationUsers/list":                             true,
+	"applicationGroups/listApplicationGroupAssignments": true,
+}
+
+// incrementalBackup tracks an incremental backup layered on a base snapshot.
+// The base is copied into the new snapshot first, so the result is a complete
+// snapshot that can be restored or diffed on its own.
+type incrementalBackup struct {
+	base  *Manifest
+	since time.Time
+	// changed holds the IDs of incremental resource types that were refetched
+	changed ObjectSelection
+	deleted map[string][]string
+}
+
+// prepareIncrementalBackup finds the base snapshot and copies it into the
+// output directory, returning the output directory to use
+func prepareIncrementalBackup(cfg *Config, opts *BackupOptions, outputDir string) (*incrementalBackup, string, error) {
+	var base *Manifest
+	if opts.Base != "" {
+		manifest, err := ReadManifest(opts.Base)
+		if err != nil {
+			return nil, "", err
+		}
+		base = manifest
+	} else {
+		parentDir := filepath.Dir(DefaultConfigPath())
+		if outputDir != "" {
+			parentDir = filepath.Dir(filepath.Clean(outputDir))
+		}
+		base = latestSnapshotBefore(parentDir, cfg.OrgName, outputDir)
+		if base == nil {
+			return nil, "", fmt.Errorf("no previous snapshot of %s found in %s; run a full backup first or pass --base", cfg.OrgName, parentDir)
+		}
+	}
+
+	if base.OrgName != cfg.OrgName {
+		return nil, "", fmt.Errorf("base snapshot %s is of %s, not %s", base.Dir, base.OrgName, cfg.OrgName)
+	}
+	if len(base.ListFilters) > 0 {
+		return nil, "", fmt.Errorf("base snapshot %s is filtered; build incremental backups on a full one", base.Dir)
+	}
+
+	if outputDir == "" {
+		outputDir = filepath.Join(filepath.Dir(filepath.Clean(base.Dir)),
+			fmt.Sprintf("%s-%s", cfg.OrgName, time.Now().UTC().Format("20060102T150405")))
+	}
+	if filepath.Clean(outputDir) == filepath.Clean(base.Dir) {
+		return nil, "", fmt.Errorf("an incremental backup cannot be written over its base %s", base.Dir)
+	}
+
+	fmt.Printf("Building incremental backup on %s (taken %s)...\n", base.Dir, base.StartedAt.Format(time.RFC3339))
+	if err := copySnapshot(base.Dir, outputDir); err != nil {
+		return nil, "", fmt.Errorf("error copying base snapshot: %w", err)
+	}
+
+	return &incrementalBackup{
+		base:    base,
+		since:   base.StartedAt,
+		changed: make(ObjectSelection),
+		deleted: make(map[string][]string),
+	}, outputDir, nil
+}
+
+// handles reports whether a first pass resource is fetched by lastUpdated
+func (b *incrementalBackup) handles(resource BackupConfigResource) bool {
+	return incrementalResources[resource.objectType()]
+}
+
+// backupChanged writes the objects changed since the base snapshot and
+// removes the ones that no longer exist, from a single list of the resource
+func (b *incrementalBackup) backupChanged(cfg *Config, resource BackupConfigResource, outputDir string) error {
+	// Everything is listed rather than filtered with lastUpdated gt, since the
+	// full list of IDs is needed to find deletions anyway; a filtered call
+	// would only add a second request per type
+	all, err := listResourceObjects(cfg, resource)
+	if err != nil {
+		return err
+	}
+
+	var changed []map[string]interface{}
+	for _, item := range all {
+		lastUpdated, _ := item["lastUpdated"].(string)
+		updated, err := time.Parse(time.RFC3339, lastUpdated)
+		if err != nil || updated.After(b.since) {
+			changed = append(changed, item)
+		}
+	}
+
+	resourceDir := filepath.Join(outputDir, strings.ToLower(resource.Name), resource.ListCommand)
+	if err := os.MkdirAll(resourceDir, 0755); err != nil {
+		return fmt.Errorf("could not create directory %s: %w", resourceDir, err)
+	}
+
+	for _, item := range changed {
+		id, _ := item["id"].(string)
+		if id == "" {
+			continue
+		}
+		if err := writeBackupObject(resourceDir, id, item); err != nil {
+			return fmt.Errorf("error backing up %s: %w", resource.Name, err)
+		}
+		b.changed.Add(resource.Name, id)
+	}
+
+	current := make(map[string]bool)
+	for _, item := range all {
+		if id, ok := item["id"].(string); ok {
+			current[id] = true
+		}
+	}
+	b.removeMissing(resource, resourceDir, current)
+
+	fmt.Printf("%d %s objects changed and %d deleted since the base snapshot\n",
+		len(b.changed[resource.Name]), resource.Name, len(b.deleted[resource.Name]))
+	return nil
+}
+
+// fullFetch refetches a resource type that cannot be filtered by lastUpdated,
+// clearing the copy from the base first so deleted objects do not linger
+func (b *incrementalBackup) fullFetch(resource BackupConfigResource, outputDir string, fetch func() error) error {
+	resourceDir := filepath.Join(outputDir, strings.ToLower(resource.Name), resource.ListCommand)
+
+	baseIDs, _ := getResourceIDsFromDirectory(resourceDir)
+	for _, id := range baseIDs {
+		os.Remove(filepath.Join(resourceDir, id+".json"))
+	}
+
+	if err := fetch(); err != nil {
+		// Put the base objects back rather than record everything as deleted
+		copyResourceDir(filepath.Join(b.base.Dir, strings.ToLower(resource.Name), resource.ListCommand), resourceDir)
+		return err
+	}
+
+	currentIDs, _ := getResourceIDsFromDirectory(resourceDir)
+	current := make(map[string]bool)
+	for _, id := range currentIDs {
+		current[id] = true
+	}
+	for _, id := range baseIDs {
+		if !current[id] {
+			b.deleted[resource.objectType()] = append(b.deleted[resource.objectType()], id)
+		}
+	}
+
+	return nil
+}
+
+// removeMissing deletes the copied objects that are no longer in the org
+func (b *incrementalBackup) removeMissing(resource BackupConfigResource, resourceDir string, current map[string]bool) {
+	baseIDs, _ := getResourceIDsFromDirectory(resourceDir)
+	for _, id := range baseIDs {
+		if current[id] {
+			continue
+		}
+		os.Remove(filepath.Join(resourceDir, id+".json"))
+		b.deleted[resource.Name] = append(b.deleted[resource.Name], id)
+	}
+}
+
+// pruneSecondPass removes second pass data copied from the base that is about
+// to be refetched or belongs to a deleted object
+func (b *incrementalBackup) pruneSecondPass(config *BackupConfig, outputDir string) {
+	for _, resource := range config.SecondPassResources {
+		resourceDir := filepath.Join(outputDir, strings.ToLower(resource.Name), resource.ListCommand)
+
+		if !incrementalResources[resource.SourceIDDir] || relationshipEntries[resource.entryName()] {
+			os.RemoveAll(resourceDir)
+			continue
+		}
+
+		for id := range b.changed[resource.SourceIDDir] {
+			os.RemoveAll(filepath.Join(resourceDir, id))
+		}
+		for _, id := range b.deleted[resource.SourceIDDir] {
+			os.RemoveAll(filepath.Join(resourceDir, id))
+		}
+	}
+}
+
+// needsSecondPass reports whether the second pass must fetch an entry's
+// children of an object
+func (b *incrementalBackup) needsSecondPass(resource BackupConfigResource, id string) bool {
+	if b == nil {
+		return true
+	}
+	if !incrementalResources[resource.SourceIDDir] || relationshipEntries[resource.entryName()] {
+		return true
+	}
+	return b.changed.Has(resource.SourceIDDir, id)
+}
+
+func copyResourceDir(srcDir, dstDir string) {
+	objects, err := readResourceObjects(srcDir)
+	if err != nil {
+		return
+	}
+	for id, object := range objects {
+		writeBackupObject(dstDir, id, object)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newTestIncrementalBackup returns an incremental backup whose base was taken
+// at since, with the given users refetched
+func newTestIncrementalBackup(since time.Time, changedUsers ...string) *incrementalBackup {
+	b := &incrementalBackup{
+		base:    &Manifest{StartedAt: since},
+		since:   since,
+		changed: make(ObjectSelection),
+		deleted: make(map[string][]string),
+	}
+	for _, id := range changedUsers {
+		b.changed.Add("user", id)
+	}
+	return b
+}
+
+func TestNeedsSecondPass(t *testing.T) {
+	listGroups := BackupConfigResource{Name: "user", ListCommand: "listGroups", SourceIDDir: "user"}
+	listFactors := BackupConfigResource{Name: "userFactor", ListCommand: "listFactors", SourceIDDir: "user"}
+	appUsers := BackupConfigResource{Name: "applicationUsers", ListCommand: "list", SourceIDDir: "application"}
+	claims := BackupConfigResource{Name: "authorizationServerClaims", ListCommand: "listOAuth2Claims", SourceIDDir: "authorizationServer"}
+
+	b := newTestIncrementalBackup(time.Now(), "00u1")
+
+	tests := []struct {
+		name        string
+		incremental *incrementalBackup
+		resource    BackupConfigResource
+		id          string
+		want        bool
+	}{
+		{name: "full backup", resource: listFactors, id: "00u2", want: true},
+		{name: "changed user", incremental: b, resource: listFactors, id: "00u1", want: true},
+		{name: "unchanged user", incremental: b, resource: listFactors, id: "00u2", want: false},
+		{name: "memberships of an unchanged user", incremental: b, resource: listGroups, id: "00u2", want: true},
+		{name: "assignments of an unchanged app", incremental: b, resource: appUsers, id: "0oa1", want: true},
+		{name: "parent fetched in full", incremental: b, resource: claims, id: "aus1", want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.incremental.needsSecondPass(test.resource, test.id); got != test.want {
+				t.Errorf("needsSecondPass(%s, %s) = %v, want %v", test.resource.entryName(), test.id, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRelationshipEntriesExist(t *testing.T) {
+	config := GetBackupConfig()
+	for entry := range relationshipEntries {
+		if !config.Has(entry) {
+			t.Errorf("relationship entry %s is not in the registry", entry)
+		}
+	}
+}
+
+func TestPruneSecondPass(t *testing.T) {
+	outputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"userfactor/listFactors/00u1/uft1": {"id": "uft1"},
+		"userfactor/listFactors/00u2/uft2": {"id": "uft2"},
+		"userfactor/listFactors/00u3/uft3": {"id": "uft3"},
+		"user/listGroups/00u1/00g1":        {"id": "00g1"},
+		"user/listGroups/00u2/00g1":        {"id": "00g1"},
+	})
+	config := &BackupConfig{SecondPassResources: []BackupConfigResource{
+		{Name: "userFactor", ListCommand: "listFactors", SourceIDDir: "user"},
+		{Name: "user", ListCommand: "listGroups", SourceIDDir: "user"},
+	}}
+
+	b := newTestIncrementalBackup(time.Now(), "00u1")
+	b.deleted["user"] = []string{"00u3"}
+	b.pruneSecondPass(config, outputDir)
+
+	tests := []struct {
+		dir  string
+		want []string
+	}{
+		{dir: "userfactor/listFactors", want: []string{"00u2"}},
+		{dir: "user/listGroups", want: nil},
+	}
+	for _, test := range tests {
+		entries, _ := os.ReadDir(filepath.Join(outputDir, filepath.FromSlash(test.dir)))
+		var got []string
+		for _, entry := range entries {
+			got = append(got, entry.Name())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("pruneSecondPass() left %s = %v, want %v", test.dir, got, test.want)
+		}
+	}
+}
+
+func TestBackupChanged(t *testing.T) {
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	user := func(id, lastUpdated string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "lastUpdated": lastUpdated}
+	}
+
+	outputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"user/lists/00u1": user("00u1", "2026-09-01T00:00:00.000Z"),
+		"user/lists/00u2": user("00u2", "2026-09-01T00:00:00.000Z"),
+		"user/lists/00u3": user("00u3", "2026-09-01T00:00:00.000Z"),
+	})
+	fakeOktaCli(t, map[string]interface{}{
+		"user lists": []interface{}{
+			user("00u1", "2026-09-01T00:00:00.000Z"),
+			user("00u2", "2026-10-02T00:00:00.000Z"),
+			user("00u4", "2026-10-03T00:00:00.000Z"),
+		},
+	})
+
+	b := newTestIncrementalBackup(since)
+	resource := BackupConfigResource{Name: "user", ListCommand: "lists"}
+	if err := b.backupChanged(&Config{OrgName: "dev-111"}, resource, outputDir); err != nil {
+		t.Fatalf("backupChanged() returned %v", err)
+	}
+
+	var changed []string
+	for id := range b.changed["user"] {
+		changed = append(changed, id)
+	}
+	sort.Strings(changed)
+	if want := []string{"00u2", "00u4"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("backupChanged() changed = %v, want %v", changed, want)
+	}
+	if want := []string{"00u3"}; !reflect.DeepEqual(b.deleted["user"], want) {
+		t.Errorf("backupChanged() deleted = %v, want %v", b.deleted["user"], want)
+	}
+
+	ids, err := getResourceIDsFromDirectory(filepath.Join(outputDir, "user", "lists"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(ids)
+	if want := []string{"00u1", "00u2", "00u4"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("backupChanged() left users %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KeyExpiry is one application signing key in a backup and when it expires
+type KeyExpiry struct {
+	App       string    `json:"app"`
+	AppID     string    `json:"appId"`
+	KeyID     string    `json:"kid"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	DaysLeft  int       `json:"daysLeft"`
+	// InUse is set on the key the app signs with
+	InUse bool `json:"inUse"`
+}
+
+// ReadKeyExpiries lists the signing keys of every app in a snapshot, the
+// soonest to expire first
+func ReadKeyExpiries(snapshotDir string, now time.Time) ([]KeyExpiry, error) {
+	keysDir := filepath.Join(snapshotDir, "applicationcredentials", "listApplicationKeys")
+	appDirs, err := os.ReadDir(keysDir)
+	if err != nil {
+		return nil, fmt.Errorf("no application keys found in %s: %w", snapshotDir, err)
+	}
+
+	apps, err := readResourceObjects(filepath.Join(snapshotDir, "application", "lists"))
+	if err != nil {
+		fmt.Printf("Warning: could not read applications from %s: %v\n", snapshotDir, err)
+	}
+
+	var expiries []KeyExpiry
+	for _, appDir := range appDirs {
+		if !appDir.IsDir() {
+			continue
+		}
+		appID := appDir.Name()
+		keys, err := readResourceObjects(filepath.Join(keysDir, appID))
+		if err != nil {
+			fmt.Printf("Warning: could not read keys of application %s: %v\n", appID, err)
+			continue
+		}
+
+		app := apps[appID]
+		label := appID
+		if app != nil {
+			label = objectLabel(app)
+		}
+		signingKid, _ := lookupJSONPath(app, "credentials.signing.kid")
+
+		for kid, key := range keys {
+			expiresAt, ok := keyExpiresAt(key)
+			if !ok {
+				fmt.Printf("Warning: key %s of application %s has no expiry date\n", kid, label)
+				continue
+			}
+			expiries = append(expiries, KeyExpiry{
+				App:       label,
+				AppID:     appID,
+				KeyID:     kid,
+				ExpiresAt: expiresAt,
+				DaysLeft:  int(expiresAt.Sub(now).Hours() / 24),
+				InUse:     signingKid == kid,
+			})
+		}
+	}
+
+	sort.Slice(expiries, func(i, j int) bool {
+		if !expiries[i].ExpiresAt.Equal(expiries[j].ExpiresAt) {
+			return expiries[i].ExpiresAt.Before(expiries[j].ExpiresAt)
+		}
+		return expiries[i].KeyID < expiries[j].KeyID
+	})
+	return expiries, nil
+}
+
+// keyExpiresAt reads when a JSON Web Key's certificate expires
+func keyExpiresAt(key map[string]interface{}) (time.Time, bool) {
+	value, _ := key["expiresAt"].(string)
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	return expiresAt, err == nil
+}
+
+// ExpiringInUse counts the keys apps sign with that expire within the given
+// number of days
+func ExpiringInUse(expiries []KeyExpiry, within int) int {
+	count := 0
+	for _, expiry := range expiries {
+		if expiry.InUse && expiry.DaysLeft < within {
+			count++
+		}
+	}
+	return count
+}
+
+// RenderKeyExpiries writes a key expiry report as text or json, flagging the
+// keys that expire within the given number of days
+func RenderKeyExpiries(w io.Writer, expiries []KeyExpiry, within int, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(expiries)
+	case "text", "":
+		if len(expiries) == 0 {
+			fmt.Fprintln(w, "No application signing keys")
+			return nil
+		}
+		fmt.Fprintf(w, "%-30s %-44s %-10s %6s  %s\n", "APPLICATION", "KEY", "EXPIRES", "DAYS", "STATUS")
+		for _, expiry := range expiries {
+			var status []string
+			if expiry.InUse {
+				status = append(status, "in use")
+			}
+			switch {
+			case expiry.DaysLeft < 0:
+				status = append(status, "expired")
+			case expiry.DaysLeft < within:
+				status = append(status, "expiring")
+			}
+			fmt.Fprintf(w, "%-30s %-44s %-10s %6s  %s\n", expiry.App, expiry.KeyID,
+				expiry.ExpiresAt.Format("2006-01-02"), strconv.Itoa(expiry.DaysLeft), strings.Join(status, ", "))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, expected text or json", format)
+}
+
+// ApplicationKeysRestorer gives the SAML and WS-Fed apps a restore created a
+// newly generated signing key when asked to, and writes a checklist for
+// rolling the new certificates over at each service provider. The keys and
+// CSRs in the backup themselves cannot be restored, since Okta never exports
+// their private keys.
+type ApplicationKeysRestorer struct{}
+
+func (r *ApplicationKeysRestorer) Restore(cfg *Config, idMapping *IDMapping, journal *RestoreJournal, inputDir string, opts *RestoreOptions) error {
+	if !opts.GenerateKeys {
+		if _, err := os.Stat(filepath.Join(inputDir, "applicationcredentials")); err == nil {
+			fmt.Println("Application signing keys and CSRs are not restored, pass --generate-keys to give restored SAML apps new keys")
+		}
+		return nil
+	}
+
+	apps, err := readResourceObjects(filepath.Join(inputDir, "application", "lists"))
+	if err != nil {
+		return fmt.Errorf("error reading applications: %w", err)
+	}
+
+	for i := range opts.appReport.Apps {
+		entry := &opts.appReport.Apps[i]
+		if !samlSignOnModes[entry.SignOnMode] || entry.UpdatedInPlace || entry.KeyID != "" {
+			continue
+		}
+		if _, ok := apps[entry.OldID]; !ok || !opts.selects("application", entry.OldID) {
+			continue
+		}
+
+		fmt.Printf("Generating a new signing key for application %s (%s)...\n", entry.NewID, entry.Label)
+		if err := rotateSigningKey(cfg, entry, opts.KeyValidityYears, opts.appReport.Dir); err != nil {
+			fmt.Printf("Warning: could not give application %s a new signing key: %v\n", entry.NewID, err)
+			entry.Notes = append(entry.Notes, fmt.Sprintf("could not generate a new signing key: %v", err))
+		}
+	}
+
+	if err := opts.appReport.Save(); err != nil {
+		return fmt.Errorf("could not save app credentials report: %w", err)
+	}
+
+	path, err := writeRolloverChecklist(opts.appReport, inputDir, apps)
+	if err != nil {
+		return err
+	}
+	if path != "" {
+		fmt.Printf("Signing key rollover checklist written to %s\n", path)
+	}
+	return nil
+}
+
+// rotateSigningKey generates a signing key for an app, makes the app sign
+// with it, and exports the metadata and certificate that go with it
+func rotateSigningKey(cfg *Config, entry *AppCredentialsEntry, validityYears int, dir string) error {
+	output, err := RunOktaCli(cfg, "applicationCredentials", "generateApplicationKey",
+		"--appId", entry.NewID, "--validityYears", strconv.Itoa(validityYears))
+	if err != nil {
+		return err
+	}
+	var key map[string]interface{}
+	if err := json.Unmarshal(output, &key); err != nil {
+		return fmt.Errorf("error parsing response: %w", err)
+	}
+	kid, ok := key["kid"].(string)
+	if !ok {
+		return fmt.Errorf("response does not contain kid field")
+	}
+
+	output, err = RunOktaCli(cfg, "application", "get", "--appId", entry.NewID)
+	if err != nil {
+		return fmt.Errorf("could not read application: %w", err)
+	}
+	var app map[string]interface{}
+	if err := json.Unmarshal(output, &app); err != nil {
+		return fmt.Errorf("error parsing application: %w", err)
+	}
+	setJSONPath(app, "credentials.signing.kid", kid)
+
+	tmpPath, err := writeTempObject(app)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	if _, err := RunOktaCli(cfg, "application", "replace", "--appId", entry.NewID, "--restore-from", tmpPath); err != nil {
+		return fmt.Errorf("could not switch the application to key %s: %w", kid, err)
+	}
+
+	entry.KeyID = kid
+	entry.KeyExpiresAt, _ = key["expiresAt"].(string)
+	exportSAMLCredentials(cfg, app, entry, dir)
+	return nil
+}
+
+// serviceProviderDetails returns what identifies an app's service provider:
+// its audience or realm, and where assertions are posted
+func serviceProviderDetails(app map[string]interface{}) (string, string) {
+	paths := [][2]string{
+		{"settings.signOn.audience", "settings.signOn.ssoAcsUrl"},
+		{"settings.app.realm", "settings.app.wReplyURL"},
+	}
+	for _, path := range paths {
+		audience, _ := lookupJSONPath(app, path[0])
+		acsURL, _ := lookupJSONPath(app, path[1])
+		a, _ := audience.(string)
+		u, _ := acsURL.(string)
+		if a != "" || u != "" {
+			return a, u
+		}
+	}
+	return "", ""
+}
+
+// writeRolloverChecklist writes rollover.md next to the credentials report,
+// with the steps to move each service provider onto its app's new key. It
+// returns an empty path when no app got a new key.
+func writeRolloverChecklist(report *AppCredentialsReport, inputDir string, apps map[string]map[string]interface{}) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Signing key rollover for %s\n\n", report.OrgName)
+	fmt.Fprintf(&b, "These applications sign with a newly generated key. Work through each service provider before its users sign in through %s.\n", report.OrgName)
+
+	count := 0
+	for _, entry := range report.Apps {
+		if entry.KeyID == "" {
+			continue
+		}
+		count++
+
+		app := apps[entry.OldID]
+		fmt.Fprintf(&b, "\n## %s\n\n", entry.Label)
+		fmt.Fprintf(&b, "- Application: %s (%s), restored from %s\n", entry.NewID, entry.SignOnMode, entry.OldID)
+		audience, acsURL := serviceProviderDetails(app)
+		if audience != "" {
+			fmt.Fprintf(&b, "- Service provider: %s\n", audience)
+		}
+		if acsURL != "" {
+			fmt.Fprintf(&b, "- Assertions posted to: %s\n", acsURL)
+		}
+		fmt.Fprintf(&b, "- New signing key: %s, valid until %s\n\n", entry.KeyID, entry.KeyExpiresAt)
+
+		if entry.Metadata != "" {
+			fmt.Fprintf(&b, "- [ ] Give the service provider the new IdP metadata (%s)\n", entry.Metadata)
+		}
+		if entry.Certificate != "" {
+			fmt.Fprintf(&b, "- [ ] Make sure the service provider trusts the new signing certificate (%s)\n", entry.Certificate)
+		}
+		fmt.Fprintln(&b, "- [ ] Test sign-in from the service provider and from the Okta dashboard")
+
+		oldKid, _ := lookupJSONPath(app, "credentials.signing.kid")
+		if kid, ok := oldKid.(string); ok {
+			expires := "an unknown date"
+			key, err := readBackupKey(inputDir, entry.OldID, kid)
+			if err == nil {
+				if expiresAt, ok := keyExpiresAt(key); ok {
+					expires = expiresAt.Format("2006-01-02")
+				}
+			}
+			fmt.Fprintf(&b, "- [ ] Once sign-in works, remove the old certificate (key %s, expires %s) from the service provider\n", kid, expires)
+		}
+	}
+
+	if count == 0 {
+		return "", nil
+	}
+
+	path := filepath.Join(report.Dir, "rollover.md")
+	if err := os.MkdirAll(report.Dir, 0700); err != nil {
+		return "", fmt.Errorf("could not create directory %s: %w", report.Dir, err)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		return "", fmt.Errorf("could not write rollover checklist: %w", err)
+	}
+	return path, nil
+}
+
+// readBackupKey reads one of an app's signing keys from a backup
+func readBackupKey(inputDir, appID, kid string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(filepath.Join(inputDir, "applicationcredentials", "listApplicationKeys", appID, kid+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var key map[string]interface{}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
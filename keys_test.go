@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadKeyExpiries(t *testing.T) {
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	inputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"application/lists/0oa1":                                  {"id": "0oa1", "label": "Portal", "credentials": map[string]interface{}{"signing": map[string]interface{}{"kid": "kidNew"}}},
+		"application/lists/0oa2":                                  {"id": "0oa2", "label": "Wiki"},
+		"applicationcredentials/listApplicationKeys/0oa1/kidOld":  {"kid": "kidOld", "expiresAt": "2026-11-17T00:00:00.000Z"},
+		"applicationcredentials/listApplicationKeys/0oa1/kidNew":  {"kid": "kidNew", "expiresAt": "2028-10-18T00:00:00.000Z"},
+		"applicationcredentials/listApplicationKeys/0oa2/kidWiki": {"kid": "kidWiki", "expiresAt": "2026-10-08T00:00:00.000Z"},
+		"applicationcredentials/listApplicationKeys/0oa2/kidNone": {"kid": "kidNone"},
+		"applicationcredentials/listApplicationKeys/0oa9/kidGone": {"kid": "kidGone", "expiresAt": "2027-10-18T00:00:00.000Z"},
+	})
+
+	got, err := ReadKeyExpiries(inputDir, now)
+	if err != nil {
+		t.Fatalf("ReadKeyExpiries() returned %v", err)
+	}
+
+	want := []KeyExpiry{
+		{App: "Wiki", AppID: "0oa2", KeyID: "kidWiki", ExpiresAt: time.Date(2026, 10, 8, 0, 0, 0, 0, time.UTC), DaysLeft: -10},
+		{App: "Portal", AppID: "0oa1", KeyID: "kidOld", ExpiresAt: time.Date(2026, 11, 17, 0, 0, 0, 0, time.UTC), DaysLeft: 30},
+		{App: "0oa9", AppID: "0oa9", KeyID: "kidGone", ExpiresAt: time.Date(2027, 10, 18, 0, 0, 0, 0, time.UTC), DaysLeft: 365},
+		{App: "Portal", AppID: "0oa1", KeyID: "kidNew", ExpiresAt: time.Date(2028, 10, 18, 0, 0, 0, 0, time.UTC), DaysLeft: 731, InUse: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadKeyExpiries() = %+v, want %+v", got, want)
+	}
+
+	if count := ExpiringInUse(got, 30); count != 0 {
+		t.Errorf("ExpiringInUse(30) = %d, want 0", count)
+	}
+	if count := ExpiringInUse(got, 800); count != 1 {
+		t.Errorf("ExpiringInUse(800) = %d, want 1", count)
+	}
+}
+
+func TestReadKeyExpiriesWithoutKeys(t *testing.T) {
+	inputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"application/lists/0oa1": {"id": "0oa1", "label": "Portal"},
+	})
+
+	if _, err := ReadKeyExpiries(inputDir, time.Now()); err == nil {
+		t.Error("ReadKeyExpiries() of a backup without keys returned no error")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// appLogosDir holds the custom app logos of a snapshot, next to the apps
+var appLogosDir = filepath.Join("application", "logos")
+
+// maxLogoSize is larger than the 1 MB Okta accepts, so a logo is never cut short
+const maxLogoSize = 2 << 20
+
+// logoExtensions are the image types Okta accepts for app logos
+var logoExtensions = map[string]string{
+	"image/png":     ".png",
+	"image/jpeg":    ".jpg",
+	"image/gif":     ".gif",
+	"image/svg+xml": ".svg",
+}
+
+// customLogoURL returns the link to an app's logo if an admin uploaded it.
+// Uploaded logos are served from the org's file store, while catalog and
+// default logos come from the CDN and are given to a new app anyway.
+func customLogoURL(app map[string]interface{}) string {
+	links, _ := lookupJSONPath(app, "_links.logo")
+	list, ok := links.([]interface{})
+	if !ok {
+		list = []interface{}{links}
+	}
+	for _, link := range list {
+		l, _ := link.(map[string]interface{})
+		href, _ := l["href"].(string)
+		if strings.Contains(href, "/bc/image/fileStoreRecord") {
+			return href
+		}
+	}
+	return ""
+}
+
+// backupAppLogos downloads the custom logo of every backed up app into the
+// snapshot and returns the files by app ID, relative to the snapshot
+func backupAppLogos(outputDir string) (map[string]string, error) {
+	apps, err := readResourceObjects(filepath.Join(outputDir, "application", "lists"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading applications: %w", err)
+	}
+
+	logosDir := filepath.Join(outputDir, appLogosDir)
+	// Logos copied from a base snapshot may belong to deleted apps
+	os.RemoveAll(logosDir)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	logos := make(map[string]string)
+	appIDs := make([]string, 0, len(apps))
+	for appID := range apps {
+		appIDs = append(appIDs, appID)
+	}
+	sort.Strings(appIDs)
+
+	for _, appID := range appIDs {
+		href := customLogoURL(apps[appID])
+		if href == "" {
+			continue
+		}
+
+		rel, err := downloadAppLogo(client, href, outputDir, appID)
+		if err != nil {
+			fmt.Printf("Warning: could not download the logo of application %s: %v\n", appID, err)
+			continue
+		}
+		logos[appID] = rel
+	}
+
+	return logos, nil
+}
+
+// downloadAppLogo saves one logo, named after its app and image type
+func downloadAppLogo(client *http.Client, href, outputDir, appID string) (string, error) {
+	resp, err := client.Get(href)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", href, resp.Status)
+	}
+
+	contentType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	extension, ok := logoExtensions[strings.TrimSpace(contentType)]
+	if !ok {
+		return "", fmt.Errorf("%s is not a PNG, JPG, GIF or SVG image but %q", href, contentType)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxLogoSize))
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Join(outputDir, appLogosDir), 0755); err != nil {
+		return "", fmt.Errorf("could not create directory %s: %w", appLogosDir, err)
+	}
+	rel := filepath.Join(appLogosDir, appID+extension)
+	if err := os.WriteFile(filepath.Join(outputDir, rel), data, 0644); err != nil {
+		return "", err
+	}
+	return rel, nil
+}
+
+// loadAppLogos returns the logo file of each app a backup holds one for, by
+// the app's ID in the backup
+func loadAppLogos(inputDir string) map[string]string {
+	manifest, err := ReadManifest(inputDir)
+	if err != nil {
+		return nil
+	}
+
+	logos := make(map[string]string)
+	for appID, logo := range manifest.Logos {
+		logos[appID] = filepath.Join(inputDir, logo)
+	}
+	return logos
+}
+
+// uploadAppLogo gives a restored app the logo its backup has, if any, and
+// returns a note for the credentials report when that fails
+func uploadAppLogo(cfg *Config, oldID, newID string, opts *RestoreOptions) string {
+	path, ok := opts.appLogos[oldID]
+	if !ok {
+		return ""
+	}
+
+	fmt.Printf("Uploading the logo of application %s...\n", newID)
+	if _, err := RunOktaCli(cfg, "applicationLogos", "uploadApplicationLogo", "--appId", newID, "--file", path); err != nil {
+		fmt.Printf("Warning: failed to upload the logo of application %s: %v\n", newID, err)
+		return fmt.Sprintf("could not upload its logo (%s), upload it in the Admin Console", path)
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCustomLogoURL(t *testing.T) {
+	uploaded := map[string]interface{}{"name": "medium", "href": "https://dev-111.okta.com/bc/image/fileStoreRecord?id=fs1", "type": "image/png"}
+	catalog := map[string]interface{}{"name": "medium", "href": "https://ok12static.oktacdn.com/assets/img/logos/zendesk.png", "type": "image/png"}
+
+	tests := []struct {
+		name string
+		app  map[string]interface{}
+		want string
+	}{
+		{
+			name: "uploaded logo among others",
+			app:  map[string]interface{}{"_links": map[string]interface{}{"logo": []interface{}{catalog, uploaded}}},
+			want: "https://dev-111.okta.com/bc/image/fileStoreRecord?id=fs1",
+		},
+		{
+			name: "single uploaded logo",
+			app:  map[string]interface{}{"_links": map[string]interface{}{"logo": uploaded}},
+			want: "https://dev-111.okta.com/bc/image/fileStoreRecord?id=fs1",
+		},
+		{
+			name: "catalog logo",
+			app:  map[string]interface{}{"_links": map[string]interface{}{"logo": []interface{}{catalog}}},
+		},
+		{
+			name: "no links",
+			app:  map[string]interface{}{"id": "0oa1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := customLogoURL(test.app); got != test.want {
+				t.Errorf("customLogoURL() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDownloadAppLogo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		case "/logo.svg":
+			w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+			w.Write([]byte("<svg/>"))
+		case "/login":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html/>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		want     string
+		wantData string
+		wantErr  bool
+	}{
+		{name: "PNG", path: "/logo.png", want: filepath.Join(appLogosDir, "0oa1.png"), wantData: "png"},
+		{name: "SVG with a charset", path: "/logo.svg", want: filepath.Join(appLogosDir, "0oa1.svg"), wantData: "<svg/>"},
+		{name: "not an image", path: "/login", wantErr: true},
+		{name: "missing", path: "/gone.png", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outputDir := t.TempDir()
+			got, err := downloadAppLogo(server.Client(), server.URL+test.path, outputDir, "0oa1")
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("downloadAppLogo(%s) = %q, want an error", test.path, got)
+				}
+				if _, err := os.Stat(filepath.Join(outputDir, appLogosDir)); !os.IsNotExist(err) {
+					t.Errorf("downloadAppLogo(%s) created the logos directory after failing", test.path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("downloadAppLogo(%s) returned %v", test.path, err)
+			}
+			if got != test.want {
+				t.Errorf("downloadAppLogo(%s) = %q, want %q", test.path, got, test.want)
+			}
+			data, err := os.ReadFile(filepath.Join(outputDir, got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.wantData {
+				t.Errorf("downloaded logo = %q, want %q", data, test.wantData)
+			}
+		})
+	}
+}
+
+func TestBackupAppLogos(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("id") != "fs1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	}))
+	defer server.Close()
+
+	logo := func(href string) map[string]interface{} {
+		return map[string]interface{}{"logo": []interface{}{map[string]interface{}{"href": href}}}
+	}
+	outputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"application/lists/0oa1": {"id": "0oa1", "_links": logo(server.URL + "/bc/image/fileStoreRecord?id=fs1")},
+		"application/lists/0oa2": {"id": "0oa2", "_links": logo("https://ok12static.oktacdn.com/assets/img/logos/default.png")},
+		"application/lists/0oa3": {"id": "0oa3", "_links": logo(server.URL + "/bc/image/fileStoreRecord?id=fs9")},
+	})
+	// A logo carried over from a base snapshot, of an app since deleted
+	if err := os.MkdirAll(filepath.Join(outputDir, appLogosDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, appLogosDir, "0oa9.png"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	logos, err := backupAppLogos(outputDir)
+	if err != nil {
+		t.Fatalf("backupAppLogos() returned %v", err)
+	}
+	if want := map[string]string{"0oa1": filepath.Join(appLogosDir, "0oa1.png")}; !reflect.DeepEqual(logos, want) {
+		t.Errorf("backupAppLogos() = %v, want %v", logos, want)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, appLogosDir, "0oa9.png")); !os.IsNotExist(err) {
+		t.Error("backupAppLogos() kept the logo of a deleted app")
+	}
+}
@@ -2,10 +2,16 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strings"
+	"time"
 	
 	"github.com/okta/okta-sdk-golang/v5/okta"
 	"github.com/spf13/cobra"
@@ -22,6 +28,25 @@ var (
 	configFile  string
 	outputDir   string
 	inputDir    string
+	targetOrg   string
+	dryRun      bool
+	historyDir  string
+	asOf        string
+	format      string
+	withinDays  int
+	
+	leftOrg     string
+	rightOrg    string
+	orgConfigs  []string
+	fromOrg     string
+	toOrg       string
+	
+	diffOpts    DiffOptions
+	driftFilter ResourceFilter
+	
+	backupOpts  BackupOptions
+	restoreOpts RestoreOptions
+	syncOpts    SyncOptions
 )
 
 var rootCmd = &cobra.Command{
@@ -40,7 +65,7 @@ var backupCmd = &cobra.Command{
 			return err
 		}
 		
-		return PerformBackup(cfg, outputDir)
+		return PerformBackup(cfg, outputDir, &backupOpts)
 	},
 }
 
@@ -53,25 +78,314 @@ var restoreCmd = &cobra.Command{
 			return err
 		}
 		
-		return PerformRestore(cfg, inputDir)
+		return PerformRestore(cfg, inputDir, &restoreOpts)
+	},
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check credentials, scopes and permissions before a backup or restore",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadConfig(configFile)
+		if err != nil {
+			return err
+		}
+		
+		return PerformDoctor(cfg)
+	},
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Delete everything a previous restore created",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadConfig(configFile)
+		if err != nil {
+			return err
+		}
+		
+		return PerformRollback(cfg, inputDir, dryRun)
+	},
+}
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover <resource> <id|login|name>",
+	Short: "Recreate a deleted object from the snapshot history",
+	Example: "  envsync recover user jane@example.com --as-of 2026-10-01",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadConfig(configFile)
+		if err != nil {
+			return err
+		}
+		
+		return PerformRecover(cfg, historyDir, args[0], args[1], asOf, dryRun)
+	},
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <snapshotA> <snapshotB>",
+	Short: "Show what changed between two backup snapshots",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		diff, err := DiffSnapshots(args[0], args[1], &diffOpts)
+		if err != nil {
+			return err
+		}
+		
+		return RenderDiff(os.Stdout, diff, format)
+	},
+}
+
+var driftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "Report changes made to an org since a snapshot, exiting 2 on drift",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadConfig(configFile)
+		if err != nil {
+			return err
+		}
+		
+		diff, err := DetectDrift(cfg, inputDir, &driftFilter, &diffOpts)
+		if err != nil {
+			return err
+		}
+		
+		if err := RenderDiff(os.Stdout, diff, format); err != nil {
+			return err
+		}
+		
+		if !diff.Empty() {
+			return &exitError{code: driftExitCode, err: fmt.Errorf("drift detected in %d resource type(s)", len(diff.Resources))}
+		}
+		return nil
+	},
+}
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Report when the application signing keys in a backup expire, exiting non-zero if one in use expires soon",
+	Example: "  envsync keys --input ~/.okta/dev-111 --within 60",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		expiries, err := ReadKeyExpiries(inputDir, time.Now())
+		if err != nil {
+			return err
+		}
+		
+		if err := RenderKeyExpiries(os.Stdout, expiries, withinDays, format); err != nil {
+			return err
+		}
+		
+		if expiring := ExpiringInUse(expiries, withinDays); expiring > 0 {
+			return fmt.Errorf("%d signing key(s) in use expire within %d days", expiring, withinDays)
+		}
+		return nil
+	},
+}
+
+var compareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "Compare the configuration of two live orgs",
+	Example: "  envsync compare --left dev-111 --right dev-222",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, path := range orgConfigs {
+			if _, org, err := scanConfigForDevDomain(path); err != nil || (org != leftOrg && org != rightOrg) {
+				return fmt.Errorf("config %s points at neither %s nor %s", path, leftOrg, rightOrg)
+			}
+		}
+		
+		left, err := LoadOrgConfig(leftOrg, findOrgConfig(leftOrg, orgConfigs))
+		if err != nil {
+			return err
+		}
+		right, err := LoadOrgConfig(rightOrg, findOrgConfig(rightOrg, orgConfigs))
+		if err != nil {
+			return err
+		}
+		
+		diff, err := CompareOrgs(left, right, &driftFilter, &diffOpts)
+		if err != nil {
+			return err
+		}
+		
+		return RenderDiff(os.Stdout, diff, format)
+	},
+}
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "Copy configuration (not users or memberships) from one org to another",
+	Example: "  envsync promote --from dev-111 --to dev-222",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, err := LoadOrgConfig(fromOrg, "")
+		if err != nil {
+			return err
+		}
+		to, err := LoadOrgConfig(toOrg, "")
+		if err != nil {
+			return err
+		}
+		
+		return PerformPromote(from, to, &restoreOpts, dryRun)
+	},
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Create and update objects, and with --prune delete them, so an org matches a snapshot",
+	Example: "  envsync sync --input ~/.okta/dev-111 --include 'group,application' --dry-run",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadConfig(configFile)
+		if err != nil {
+			return err
+		}
+		
+		return PerformSync(cfg, inputDir, &syncOpts, format)
+	},
+}
+
+var resetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Delete everything but Okta-managed defaults from an org before a restore",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadOrgConfig(targetOrg, configFile)
+		if err != nil {
+			return err
+		}
+		
+		return PerformReset(cfg, dryRun)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(backupCmd)
 	rootCmd.AddCommand(restoreCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(resetCmd)
+	rootCmd.AddCommand(recoverCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(driftCmd)
+	rootCmd.AddCommand(keysCmd)
+	rootCmd.AddCommand(compareCmd)
+	rootCmd.AddCommand(promoteCmd)
+	rootCmd.AddCommand(syncCmd)
+	restoreCmd.AddCommand(rollbackCmd)
 	
 	backupCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to Okta config file")
 	backupCmd.Flags().StringVarP(&outputDir, "output", "o", "", "Directory to store backup files")
+	backupCmd.Flags().StringSliceVar(&backupOpts.Filter.Include, "include", nil, "Only back up these resource types (globs, e.g. group,user/listGroups)")
+	backupCmd.Flags().StringSliceVar(&backupOpts.Filter.Exclude, "exclude", nil, "Skip these resource types (globs)")
+	backupCmd.Flags().BoolVar(&backupOpts.Incremental, "incremental", false, "Only fetch what changed since the previous snapshot")
+	backupCmd.Flags().StringVar(&backupOpts.Base, "base", "", "Snapshot an incremental backup builds on (default: newest snapshot of the org)")
+	backupCmd.Flags().StringArrayVar(&backupOpts.ListFilters, "filter", nil, "Filter listed objects, e.g. 'user:search=profile.department eq \"Engineering\"' or 'user:memberOf=Engineering'")
 	
 	restoreCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to Okta config file")
 	restoreCmd.Flags().StringVarP(&inputDir, "input", "i", "", "Directory containing backup files")
+	restoreCmd.Flags().BoolVar(&restoreOpts.SkipQuotaCheck, "skip-quota-check", false, "Skip the dev-org limits preflight")
+	restoreCmd.Flags().BoolVar(&restoreOpts.QuotaWarnOnly, "quota-warn-only", false, "Warn instead of refusing when the restore would exceed org limits")
+	restoreCmd.Flags().StringToIntVar(&restoreOpts.Limits, "limit", nil, "Override an org limit, e.g. --limit user=1000")
+	restoreCmd.Flags().StringSliceVar(&restoreOpts.Filter.Include, "include", nil, "Only restore these resource types (globs, e.g. group,application)")
+	restoreCmd.Flags().StringSliceVar(&restoreOpts.Filter.Exclude, "exclude", nil, "Skip these resource types (globs)")
+	restoreCmd.Flags().StringSliceVar(&restoreOpts.Only, "only", nil, "Only restore these objects and their dependencies, e.g. user:00u123,group:00g456")
+	restoreCmd.Flags().StringVar(&restoreOpts.TransformFile, "transform", "", "YAML file of replacements and field edits to apply before restoring")
+	restoreCmd.Flags().StringVar(&restoreOpts.AppCredentialsFile, "app-credentials", "", "YAML file of OIDC client credentials to keep, keyed by app label")
+	restoreCmd.Flags().BoolVar(&restoreOpts.GenerateKeys, "generate-keys", false, "Give restored SAML and WS-Fed apps a new signing key and write a rollover checklist")
+	restoreCmd.Flags().IntVar(&restoreOpts.KeyValidityYears, "key-validity", 2, "Years the keys --generate-keys creates are valid for")
 	restoreCmd.MarkFlagRequired("input")
+	
+	doctorCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to Okta config file")
+	
+	rollbackCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to Okta config file")
+	rollbackCmd.Flags().StringVarP(&inputDir, "input", "i", "", "Directory containing the backup that was restored")
+	rollbackCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List what would be undone without changing anything")
+	rollbackCmd.MarkFlagRequired("input")
+	
+	recoverCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to Okta config file")
+	recoverCmd.Flags().StringVar(&historyDir, "history", "", "Directory holding the org's snapshots (default ~/.okta)")
+	recoverCmd.Flags().StringVar(&asOf, "as-of", "", "Use the newest snapshot taken on or before this date (YYYY-MM-DD or RFC 3339)")
+	recoverCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be recreated without changing anything")
+	
+	diffCmd.Flags().StringVarP(&format, "format", "f", "text", "Output format: text, json or markdown")
+	diffCmd.Flags().StringSliceVar(&diffOpts.Ignore, "ignore", nil, "Extra field names to ignore when comparing")
+	
+	driftCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to Okta config file")
+	driftCmd.Flags().StringVarP(&inputDir, "input", "i", "", "Snapshot to compare the org with")
+	driftCmd.Flags().StringVarP(&format, "format", "f", "text", "Output format: text, json or markdown")
+	driftCmd.Flags().StringSliceVar(&driftFilter.Include, "include", nil, "Only check these resource types (globs)")
+	driftCmd.Flags().StringSliceVar(&driftFilter.Exclude, "exclude", nil, "Skip these resource types (globs)")
+	driftCmd.Flags().StringSliceVar(&diffOpts.Ignore, "ignore", nil, "Extra field names to ignore when comparing")
+	driftCmd.MarkFlagRequired("input")
+	
+	keysCmd.Flags().StringVarP(&inputDir, "input", "i", "", "Snapshot to read the keys from")
+	keysCmd.Flags().IntVar(&withinDays, "within", 30, "Flag keys that expire within this many days")
+	keysCmd.Flags().StringVarP(&format, "format", "f", "text", "Output format: text or json")
+	keysCmd.MarkFlagRequired("input")
+	
+	compareCmd.Flags().StringVar(&leftOrg, "left", "", "First org, e.g. dev-111 (config read from ~/.okta/<org>.yaml)")
+	compareCmd.Flags().StringVar(&rightOrg, "right", "", "Second org, e.g. dev-222")
+	compareCmd.Flags().StringSliceVarP(&orgConfigs, "config", "c", nil, "Okta config files of the orgs, matched to --left and --right by org name")
+	compareCmd.Flags().StringVarP(&format, "format", "f", "text", "Output format: text, json or markdown")
+	compareCmd.Flags().StringSliceVar(&driftFilter.Include, "include", nil, "Only compare these resource types (globs)")
+	compareCmd.Flags().StringSliceVar(&driftFilter.Exclude, "exclude", nil, "Skip these resource types (globs)")
+	compareCmd.Flags().StringSliceVar(&diffOpts.Ignore, "ignore", nil, "Extra field names to ignore when comparing")
+	compareCmd.MarkFlagRequired("left")
+	compareCmd.MarkFlagRequired("right")
+	
+	promoteCmd.Flags().StringVar(&fromOrg, "from", "", "Org to copy configuration from, e.g. dev-111")
+	promoteCmd.Flags().StringVar(&toOrg, "to", "", "Org to copy configuration into, e.g. dev-222")
+	promoteCmd.Flags().BoolVar(&restoreOpts.DeleteExtras, "delete-extras", false, "Delete configuration objects the target has but the source does not, after typing the org name to confirm")
+	promoteCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List what --delete-extras would delete without changing the target")
+	promoteCmd.Flags().StringSliceVar(&restoreOpts.Filter.Include, "include", nil, "Only promote these resource types (globs)")
+	promoteCmd.Flags().StringSliceVar(&restoreOpts.Filter.Exclude, "exclude", nil, "Skip these resource types (globs)")
+	promoteCmd.Flags().BoolVar(&restoreOpts.SkipQuotaCheck, "skip-quota-check", false, "Skip the dev-org limits preflight")
+	promoteCmd.Flags().BoolVar(&restoreOpts.QuotaWarnOnly, "quota-warn-only", false, "Warn instead of refusing when the promotion would exceed org limits")
+	promoteCmd.Flags().StringToIntVar(&restoreOpts.Limits, "limit", nil, "Override an org limit, e.g. --limit user=1000")
+	promoteCmd.Flags().StringVar(&restoreOpts.TransformFile, "transform", "", "YAML file of replacements and field edits to apply before promoting")
+	promoteCmd.Flags().StringVar(&restoreOpts.AppCredentialsFile, "app-credentials", "", "YAML file of OIDC client credentials to keep, keyed by app label")
+	promoteCmd.Flags().BoolVar(&restoreOpts.GenerateKeys, "generate-keys", false, "Give promoted SAML and WS-Fed apps a new signing key and write a rollover checklist")
+	promoteCmd.Flags().IntVar(&restoreOpts.KeyValidityYears, "key-validity", 2, "Years the keys --generate-keys creates are valid for")
+	promoteCmd.MarkFlagRequired("from")
+	promoteCmd.MarkFlagRequired("to")
+	
+	syncCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to Okta config file of the target org")
+	syncCmd.Flags().StringVarP(&inputDir, "input", "i", "", "Snapshot the target org should match")
+	syncCmd.Flags().StringSliceVar(&syncOpts.Filter.Include, "include", nil, "Only sync these resource types (globs)")
+	syncCmd.Flags().StringSliceVar(&syncOpts.Filter.Exclude, "exclude", nil, "Skip these resource types (globs)")
+	syncCmd.Flags().BoolVar(&syncOpts.Prune, "prune", false, "Also delete objects of the synced types that the snapshot does not have")
+	syncCmd.Flags().IntVar(&syncOpts.MaxDeletes, "max-deletes", 10, "Refuse to apply a plan that deletes more objects than this")
+	syncCmd.Flags().BoolVar(&syncOpts.DryRun, "dry-run", false, "Print the plan without applying it")
+	syncCmd.Flags().StringVarP(&format, "format", "f", "text", "Plan output format: text or json")
+	syncCmd.MarkFlagRequired("input")
+	
+	resetCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to Okta config file")
+	resetCmd.Flags().StringVarP(&targetOrg, "target", "t", "", "Org to reset, e.g. dev-222")
+	resetCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List what would be deleted without deleting it")
+	resetCmd.MarkFlagRequired("target")
+}
+
+// driftExitCode tells drift found from drift failing, which exits 1
+const driftExitCode = 2
+
+// exitError is an error that ends the program with its own exit code
+type exitError struct {
+	code int
+	err  error
 }
 
+func (e *exitError) Error() string { return e.err.Error() }
+
+func (e *exitError) Unwrap() error { return e.err }
+
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
+		var exit *exitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.code)
+		}
 		os.Exit(1)
 	}
 }
@@ -92,6 +406,46 @@ func PrepareOktaCliArgs(cfg *Config, args ...string) []string {
 	return args
 }
 
+// RunOktaCli runs okta-cli-client and returns its stdout. On failure the
+// returned error includes whatever the command wrote to stderr so callers can
+// tell a 401/403 apart from other failures.
+func RunOktaCli(cfg *Config, args ...string) ([]byte, error) {
+	cmd := exec.Command("okta-cli-client", PrepareOktaCliArgs(cfg, args...)...)
+	
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		if msg != "" {
+			return stdout.Bytes(), fmt.Errorf("%w: %s", err, msg)
+		}
+		return stdout.Bytes(), err
+	}
+	
+	return stdout.Bytes(), nil
+}
+
+// RunOktaCliList runs an okta-cli-client list command and decodes the JSON
+// array it prints
+func RunOktaCliList(cfg *Config, args ...string) ([]map[string]interface{}, error) {
+	data, err := RunOktaCli(cfg, args...)
+	if err != nil {
+		return nil, err
+	}
+	
+	var items []map[string]interface{}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("error parsing response: %w", err)
+	}
+	
+	return items, nil
+}
+
 var devOrgPattern = regexp.MustCompile(`\b((?:dev|trial)-\d+)(?:\.okta\.com)?\b`)
 
 func LoadConfig(configPath string) (*Config, error) {
@@ -123,6 +477,41 @@ func LoadConfig(configPath string) (*Config, error) {
 	return config, nil
 }
 
+// LoadOrgConfig loads the config for a named org such as dev-222. An explicit
+// config path wins; otherwise ~/.okta/<org>.yaml is tried before the default
+// okta.yaml. The loaded config must point at the requested org so that a
+// destructive command can never run against the wrong tenant.
+func LoadOrgConfig(orgName, configPath string) (*Config, error) {
+	if configPath == "" {
+		orgConfigPath := filepath.Join(filepath.Dir(DefaultConfigPath()), orgName+".yaml")
+		if _, err := os.Stat(orgConfigPath); err == nil {
+			configPath = orgConfigPath
+		}
+	}
+	
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	
+	if cfg.OrgName != orgName {
+		return nil, fmt.Errorf("config %s points at %s, not %s", cfg.ConfigFilePath, cfg.OrgName, orgName)
+	}
+	
+	return cfg, nil
+}
+
+// findOrgConfig picks the config file pointing at an org out of several, or
+// returns an empty path to fall back to ~/.okta/<org>.yaml
+func findOrgConfig(orgName string, configPaths []string) string {
+	for _, path := range configPaths {
+		if _, org, err := scanConfigForDevDomain(path); err == nil && org == orgName {
+			return path
+		}
+	}
+	return ""
+}
+
 // scanConfigForDevDomain scans a config file to find an Okta developer domain
 // Returns the full domain and the org name (dev-XXXXX)
 func scanConfigForDevDomain(filePath string) (string, string, error) {
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const manifestFileName = "manifest.json"
+
+// Manifest describes one backup snapshot. It is written last, so a snapshot
+// without one did not finish.
+type Manifest struct {
+	OrgName    string    `json:"org"`
+	OktaDomain string    `json:"domain"`
+	// StartedAt is when the backup began; anything changed after it is not
+	// guaranteed to be in the snapshot
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+	Incremental bool      `json:"incremental,omitempty"`
+	// Base is the snapshot an incremental backup was built on top of
+	Base string `json:"base,omitempty"`
+	// Deleted lists, per resource type, the IDs that were in the base
+	// snapshot but are gone from the org
+	Deleted map[string][]string `json:"deleted,omitempty"`
+	// ListFilters are the --filter expressions a subset backup was taken with
+	ListFilters []string `json:"filters,omitempty"`
+	// Logos are the files holding custom app logos, by app ID, relative to
+	// the snapshot
+	Logos map[string]string `json:"logos,omitempty"`
+
+	Dir string `json:"-"`
+}
+
+// ReadManifest reads the manifest of a snapshot directory
+func ReadManifest(snapshotDir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(snapshotDir, manifestFileName))
+	if err != nil {
+		return nil, fmt.Errorf("could not read manifest in %s: %w", snapshotDir, err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("could not parse manifest in %s: %w", snapshotDir, err)
+	}
+	manifest.Dir = snapshotDir
+
+	return &manifest, nil
+}
+
+// WriteManifest writes the manifest into its snapshot directory
+func WriteManifest(manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal manifest: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(manifest.Dir, manifestFileName), data, 0644)
+}
+
+// FindSnapshots returns the finished snapshots of an org found directly under
+// parentDir, oldest first
+func FindSnapshots(parentDir, orgName string) ([]*Manifest, error) {
+	entries, err := os.ReadDir(parentDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var snapshots []*Manifest
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		manifest, err := ReadManifest(filepath.Join(parentDir, entry.Name()))
+		if err != nil || manifest.OrgName != orgName {
+			continue
+		}
+		snapshots = append(snapshots, manifest)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].StartedAt.Before(snapshots[j].StartedAt)
+	})
+
+	return snapshots, nil
+}
+
+// latestSnapshotBefore returns the newest unfiltered snapshot of an org under parentDir
+// other than exclude, or nil if there is none
+func latestSnapshotBefore(parentDir, orgName, exclude string) *Manifest {
+	snapshots, err := FindSnapshots(parentDir, orgName)
+	if err != nil {
+		return nil
+	}
+
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		// A filtered snapshot holds a subset, so it is nothing to build on
+		if len(snapshots[i].ListFilters) > 0 {
+			continue
+		}
+		if filepath.Clean(snapshots[i].Dir) != filepath.Clean(exclude) {
+			return snapshots[i]
+		}
+	}
+
+	return nil
+}
+
+// copySnapshot copies the backup files of one snapshot into another, leaving
+// out the manifest and the files a restore or sync writes
+func copySnapshot(srcDir, dstDir string) error {
+	skip := map[string]bool{
+		manifestFileName:        true,
+		"id_mapping.json":       true,
+		"restore_journal.json":  true,
+	}
+
+	return filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dstDir, rel)
+
+		if info.IsDir() {
+			// New app credentials hold secrets and belong to the restore
+			if filepath.Dir(rel) == "." && strings.HasPrefix(rel, appCredentialsDirPrefix) {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(target, 0755)
+		}
+		if filepath.Dir(rel) == "." && (skip[rel] || strings.HasPrefix(rel, syncJournalPrefix)) {
+			return nil
+		}
+
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		dst, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		defer dst.Close()
+
+		_, err = io.Copy(dst, src)
+		return err
+	})
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PolicyRestorer restores policies together with their rules. Okta creates a
+// default policy of each type (and a default rule in many policies) in every
+// org, so those are updated in place instead of created, and every policy and
+// rule is created in priority order so the evaluation order survives. Access
+// policies also get the applications that used them mapped back.
+type PolicyRestorer struct{}
+
+// sortByPriority orders backed up objects by type, then priority
+func sortByPriority(objects map[string]map[string]interface{}) []string {
+	ids := make([]string, 0, len(objects))
+	for id := range objects {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := objects[ids[i]], objects[ids[j]]
+		typeA, _ := a["type"].(string)
+		typeB, _ := b["type"].(string)
+		if typeA != typeB {
+			return typeA < typeB
+		}
+		priorityA, _ := a["priority"].(float64)
+		priorityB, _ := b["priority"].(float64)
+		if priorityA != priorityB {
+			return priorityA < priorityB
+		}
+		return ids[i] < ids[j]
+	})
+
+	return ids
+}
+
+// idReferences flattens an ID mapping into old ID -> new ID across every
+// resource type, for rewriting the group, zone, app and IdP IDs policies
+// reference
+func idReferences(idMapping *IDMapping) map[string]string {
+	references := make(map[string]string)
+	for _, mappings := range idMapping.Mappings {
+		for oldID, newID := range mappings {
+			references[oldID] = newID
+		}
+	}
+	return references
+}
+
+// findExistingPolicyObject picks the object in the target org a backed up
+// policy or rule should update: the default one for a default, or one with
+// the same name when updateExisting is set
+func findExistingPolicyObject(object map[string]interface{}, existing []map[string]interface{}, updateExisting bool) string {
+	system, _ := object["system"].(bool)
+	for _, candidate := range existing {
+		if candidate["type"] != object["type"] {
+			continue
+		}
+		candidateSystem, _ := candidate["system"].(bool)
+		if (system && candidateSystem) || (updateExisting && candidate["name"] == object["name"]) {
+			id, _ := candidate["id"].(string)
+			return id
+		}
+	}
+	return ""
+}
+
+func (r *PolicyRestorer) Restore(cfg *Config, idMapping *IDMapping, journal *RestoreJournal, inputDir string, opts *RestoreOptions) error {
+	policiesDir := filepath.Join(inputDir, "policy", "lists")
+	if _, err := os.Stat(policiesDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	policies, err := readResourceObjects(policiesDir)
+	if err != nil {
+		return fmt.Errorf("error reading policies: %w", err)
+	}
+
+	existing := make(map[string][]map[string]interface{})
+	for _, policyType := range policyTypes {
+		items, err := RunOktaCliList(cfg, "policy", "lists", "--type", policyType)
+		if err != nil {
+			fmt.Printf("Warning: could not list %s policies in %s: %v\n", policyType, cfg.OrgName, err)
+			continue
+		}
+		existing[policyType] = items
+	}
+
+	references := idReferences(idMapping)
+	for _, oldID := range sortByPriority(policies) {
+		if !opts.selects("policy", oldID) {
+			continue
+		}
+		if newID, ok := idMapping.GetNewID("policy", oldID); ok {
+			fmt.Printf("policy %s was already restored as %s, skipping...\n", oldID, newID)
+			continue
+		}
+
+		policy := translateIDs(policies[oldID], references).(map[string]interface{})
+		policyType, _ := policy["type"].(string)
+
+		filePath, err := writeTempObject(policy)
+		if err != nil {
+			return err
+		}
+
+		newID := findExistingPolicyObject(policy, existing[policyType], opts.UpdateExisting)
+		updated := newID != ""
+		if updated {
+			fmt.Printf("Updating %s policy %s (%s) in place...\n", policyType, newID, objectLabel(policy))
+			_, err = RunOktaCli(cfg, "policy", "replace", "--policyId", newID, "--restore-from", filePath)
+			if err == nil {
+				journal.Record("updateInPlace", map[string]string{"resource": "policy", "id": newID})
+			}
+		} else {
+			fmt.Printf("Restoring %s policy %s from previous ID %s...\n", policyType, objectLabel(policy), oldID)
+			newID, err = restoreResource(cfg, "policy", filePath)
+		}
+		os.Remove(filePath)
+
+		if err != nil {
+			fmt.Printf("Warning: error restoring policy %s: %v\n", oldID, err)
+			continue
+		}
+
+		idMapping.AddMapping("policy", oldID, newID)
+		references[oldID] = newID
+
+		if err := restorePolicyRules(cfg, journal, inputDir, oldID, newID, updated, references, opts); err != nil {
+			fmt.Printf("Warning: error restoring rules of policy %s: %v\n", newID, err)
+		}
+		restorePolicyMappings(cfg, idMapping, journal, inputDir, oldID, newID)
+	}
+
+	return nil
+}
+
+// restorePolicyRules restores the rules of one policy in priority order,
+// updating the default rule Okta created with the policy. Rules created in a
+// policy that was updated in place are journaled, since rollback keeps that
+// policy and would otherwise leave them behind.
+func restorePolicyRules(cfg *Config, journal *RestoreJournal, inputDir, oldPolicyID, newPolicyID string, updated bool, references map[string]string, opts *RestoreOptions) error {
+	rules, err := readResourceObjects(filepath.Join(inputDir, "policy", "listRules", oldPolicyID))
+	if err != nil {
+		return nil
+	}
+
+	existing, err := RunOktaCliList(cfg, "policy", "listRules", "--policyId", newPolicyID)
+	if err != nil {
+		return fmt.Errorf("could not list existing rules: %w", err)
+	}
+
+	for _, oldRuleID := range sortByPriority(rules) {
+		rule := translateIDs(rules[oldRuleID], references).(map[string]interface{})
+
+		filePath, err := writeTempObject(rule)
+		if err != nil {
+			return err
+		}
+
+		var output []byte
+		ruleID := findExistingPolicyObject(rule, existing, opts.UpdateExisting)
+		if ruleID != "" {
+			fmt.Printf("Updating rule %s (%s) of policy %s in place...\n", ruleID, objectLabel(rule), newPolicyID)
+			_, err = RunOktaCli(cfg, "policy", "replaceRule", "--policyId", newPolicyID, "--ruleId", ruleID, "--restore-from", filePath)
+		} else {
+			fmt.Printf("Restoring rule %s of policy %s...\n", objectLabel(rule), newPolicyID)
+			output, err = RunOktaCli(cfg, "policy", "createRule", "--policyId", newPolicyID, "--restore-from", filePath)
+		}
+		os.Remove(filePath)
+
+		if err != nil {
+			fmt.Printf("Warning: failed to restore rule %s of policy %s: %v\n", oldRuleID, newPolicyID, err)
+			continue
+		}
+		if ruleID != "" || !updated {
+			continue
+		}
+
+		var created map[string]interface{}
+		if err := json.Unmarshal(output, &created); err != nil {
+			fmt.Printf("Warning: error parsing rule %s of policy %s, rollback will not remove it: %v\n", objectLabel(rule), newPolicyID, err)
+			continue
+		}
+		newRuleID, _ := created["id"].(string)
+		journal.Record("createPolicyRule", map[string]string{"policyId": newPolicyID, "ruleId": newRuleID})
+	}
+
+	return nil
+}
+
+// mappedApplicationID reads the application a policy mapping points at from
+// its _links.application.href
+func mappedApplicationID(mapping map[string]interface{}) string {
+	href, _ := lookupJSONPath(mapping, "_links.application.href")
+	s, _ := href.(string)
+	if s == "" {
+		return ""
+	}
+	return path.Base(strings.TrimSuffix(s, "/"))
+}
+
+// restorePolicyMappings maps restored applications to the restored access
+// policy they used, so they do not fall back to the default policy
+func restorePolicyMappings(cfg *Config, idMapping *IDMapping, journal *RestoreJournal, inputDir, oldPolicyID, newPolicyID string) {
+	mappings, err := readResourceObjects(filepath.Join(inputDir, "policy", "listMappings", oldPolicyID))
+	if err != nil {
+		return
+	}
+
+	for mappingID, mapping := range mappings {
+		oldAppID := mappedApplicationID(mapping)
+		if oldAppID == "" {
+			fmt.Printf("Warning: policy mapping %s does not name an application, skipping...\n", mappingID)
+			continue
+		}
+
+		newAppID, ok := idMapping.GetNewID("application", oldAppID)
+		if !ok {
+			fmt.Printf("Warning: application %s was not restored, cannot map it to policy %s\n", oldAppID, newPolicyID)
+			continue
+		}
+
+		fmt.Printf("Mapping application %s to policy %s...\n", newAppID, newPolicyID)
+		output, err := RunOktaCli(cfg, "policy", "mapResourceTo", "--policyId", newPolicyID,
+			"--data", fmt.Sprintf(`{"resourceId":%q,"resourceType":"APP"}`, newAppID))
+		if err != nil {
+			fmt.Printf("Warning: failed to map application %s to policy %s: %v\n", newAppID, newPolicyID, err)
+			continue
+		}
+
+		var mapped map[string]interface{}
+		if err := json.Unmarshal(output, &mapped); err != nil {
+			fmt.Printf("Warning: error parsing mapping of application %s: %v\n", newAppID, err)
+			continue
+		}
+
+		newMappingID, _ := mapped["id"].(string)
+		journal.Record("mapResourceToPolicy", map[string]string{"policyId": newPolicyID, "mappingId": newMappingID, "appId": newAppID})
+	}
+}
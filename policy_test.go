@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortByPriority(t *testing.T) {
+	policy := func(policyType string, priority float64) map[string]interface{} {
+		return map[string]interface{}{"type": policyType, "priority": priority}
+	}
+
+	tests := []struct {
+		name    string
+		objects map[string]map[string]interface{}
+		want    []string
+	}{
+		{
+			name: "by priority",
+			objects: map[string]map[string]interface{}{
+				"00p3": policy("OKTA_SIGN_ON", 3),
+				"00p1": policy("OKTA_SIGN_ON", 1),
+				"00p2": policy("OKTA_SIGN_ON", 2),
+			},
+			want: []string{"00p1", "00p2", "00p3"},
+		},
+		{
+			name: "by type first",
+			objects: map[string]map[string]interface{}{
+				"00p1": policy("PASSWORD", 1),
+				"00p2": policy("OKTA_SIGN_ON", 2),
+				"00p3": policy("ACCESS_POLICY", 3),
+			},
+			want: []string{"00p3", "00p2", "00p1"},
+		},
+		{
+			name: "ties by ID",
+			objects: map[string]map[string]interface{}{
+				"00pb": policy("PASSWORD", 1),
+				"00pa": policy("PASSWORD", 1),
+			},
+			want: []string{"00pa", "00pb"},
+		},
+		{
+			name: "missing priority sorts first",
+			objects: map[string]map[string]interface{}{
+				"0pr2": {"priority": float64(2)},
+				"0pr1": {},
+				"0pr0": {"priority": float64(1)},
+			},
+			want: []string{"0pr1", "0pr0", "0pr2"},
+		},
+		{
+			name:    "empty",
+			objects: map[string]map[string]interface{}{},
+			want:    []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := sortByPriority(test.objects); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("sortByPriority() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPolicyRestorerJournalsRulesOfUpdatedPolicies(t *testing.T) {
+	inputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"policy/lists/00p1":          {"id": "00p1", "type": "OKTA_SIGN_ON", "name": "Default Policy", "system": true, "priority": float64(2)},
+		"policy/lists/00p2":          {"id": "00p2", "type": "OKTA_SIGN_ON", "name": "Contractors", "priority": float64(1)},
+		"policy/listRules/00p1/0pr1": {"id": "0pr1", "type": "SIGN_ON", "name": "Default Rule", "system": true, "priority": float64(99)},
+		"policy/listRules/00p1/0pr2": {"id": "0pr2", "type": "SIGN_ON", "name": "VPN only", "priority": float64(1)},
+		"policy/listRules/00p2/0pr3": {"id": "0pr3", "type": "SIGN_ON", "name": "Contractors only", "priority": float64(1)},
+	})
+	fakeOktaCli(t, map[string]interface{}{
+		"policy lists --type OKTA_SIGN_ON": []interface{}{
+			map[string]interface{}{"id": "00pA", "type": "OKTA_SIGN_ON", "name": "Default Policy", "system": true},
+		},
+		"policy create --restore-from *":                                    map[string]interface{}{"id": "00pB"},
+		"policy replace --policyId 00pA --restore-from *":                   map[string]interface{}{"id": "00pA"},
+		"policy listRules --policyId 00pA":                                  []interface{}{map[string]interface{}{"id": "0prA", "type": "SIGN_ON", "system": true}},
+		"policy listRules --policyId 00pB":                                  []interface{}{},
+		"policy replaceRule --policyId 00pA --ruleId 0prA --restore-from *": map[string]interface{}{"id": "0prA"},
+		"policy createRule --policyId 00pA --restore-from *":                map[string]interface{}{"id": "0prB"},
+		"policy createRule --policyId 00pB --restore-from *":                map[string]interface{}{"id": "0prC"},
+	})
+
+	journal := NewRestoreJournal(inputDir)
+	err := (&PolicyRestorer{}).Restore(&Config{OrgName: "dev-222"}, NewIDMapping(inputDir), journal, inputDir, &RestoreOptions{})
+	if err != nil {
+		t.Fatalf("Restore() returned %v", err)
+	}
+
+	// Rules of the created policy go with it; only the one added to the
+	// default policy, which rollback keeps, needs undoing on its own
+	want := []JournalEntry{
+		{Action: "updateInPlace", Params: map[string]string{"resource": "policy", "id": "00pA"}},
+		{Action: "createPolicyRule", Params: map[string]string{"policyId": "00pA", "ruleId": "0prB"}},
+	}
+	if !reflect.DeepEqual(journal.Entries, want) {
+		t.Fatalf("journal = %+v, want %+v", journal.Entries, want)
+	}
+
+	undo := journalUndoCommands["createPolicyRule"](journal.Entries[1].Params)
+	if want := []string{"policy", "deleteRule", "--policyId", "00pA", "--ruleId", "0prB"}; !reflect.DeepEqual(undo, want) {
+		t.Errorf("undo of createPolicyRule = %v, want %v", undo, want)
+	}
+}
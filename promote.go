@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// promoteKeeps lists the reset resource types a promotion never deletes.
+// Deleting a group drops its memberships, which a promotion leaves alone.
+var promoteKeeps = map[string]bool{
+	"group": true,
+	"user":  true,
+}
+
+// planExtraObjects lists the objects of the promoted resource types that the
+// target org has but the backup does not, dependents first. Objects sharing a
+// natural key with a backup object are left out, since the promotion updates
+// them in place.
+func planExtraObjects(cfg *Config, backupConfig *BackupConfig, inputDir string) ([]ResetTarget, error) {
+	labels := make(map[string]map[string]bool)
+	for _, resource := range backupConfig.FirstPassResources {
+		objects, err := readResourceObjects(filepath.Join(inputDir, strings.ToLower(resource.Name), resource.ListCommand))
+		if err != nil {
+			continue
+		}
+		labels[resource.objectType()] = make(map[string]bool)
+		for _, object := range objects {
+			labels[resource.objectType()][objectLabel(object)] = true
+		}
+	}
+
+	protected, err := protectedObjects(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var targets []ResetTarget
+	for _, resource := range getResetOrder() {
+		if labels[resource.Name] == nil || promoteKeeps[resource.Name] {
+			continue
+		}
+
+		resourceTargets, err := listResetTargets(cfg, resource, protected)
+		if err != nil {
+			return nil, err
+		}
+		for _, target := range resourceTargets {
+			if !labels[resource.Name][target.Label] {
+				targets = append(targets, target)
+			}
+		}
+	}
+
+	return targets, nil
+}
+
+// deleteExtraObjects deletes the planned extra objects. Objects the restore
+// mapped are kept even if they were planned.
+func deleteExtraObjects(cfg *Config, targets []ResetTarget, idMapping *IDMapping) error {
+	kept := make(map[string]bool)
+	for _, mappings := range idMapping.Mappings {
+		for _, newID := range mappings {
+			kept[newID] = true
+		}
+	}
+
+	failures := 0
+	for _, target := range targets {
+		if kept[target.ID] {
+			continue
+		}
+		if err := deleteObject(cfg, target.Resource.Name, target.ID); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+			failures++
+			continue
+		}
+		fmt.Printf("Deleted %s %s (%s)\n", target.Resource.Name, target.ID, target.Label)
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d extra object(s) could not be deleted from %s", failures, cfg.OrgName)
+	}
+	return nil
+}
+
+// PerformPromote copies the configuration resource types of one org into
+// another without touching people data. Objects the target already has are
+// updated in place, missing ones are created, and with opts.DeleteExtras
+// objects only the target has are deleted once the plan is confirmed. The
+// source backup, ID mapping and journal are kept in ~/.okta/promotions so
+// the promotion can be rolled back.
+func PerformPromote(from, to *Config, opts *RestoreOptions, dryRun bool) error {
+	if from.OrgName == to.OrgName {
+		return fmt.Errorf("cannot promote %s into itself", from.OrgName)
+	}
+
+	// A broken transform file would otherwise only show after the backup
+	if opts.TransformFile != "" {
+		if _, err := LoadTransform(opts.TransformFile); err != nil {
+			return err
+		}
+	}
+
+	workDir := filepath.Join(filepath.Dir(DefaultConfigPath()), "promotions",
+		fmt.Sprintf("%s-to-%s-%s", from.OrgName, to.OrgName, time.Now().UTC().Format("20060102T150405")))
+	if dryRun {
+		var err error
+		if workDir, err = os.MkdirTemp("", "envsync-promote-*"); err != nil {
+			return fmt.Errorf("could not create working directory: %w", err)
+		}
+		defer os.RemoveAll(workDir)
+	}
+
+	fmt.Printf("Backing up configuration of %s...\n", from.OrgName)
+	if err := PerformBackup(from, workDir, &BackupOptions{Filter: configurationFilter, NoHistory: true}); err != nil {
+		return fmt.Errorf("error backing up %s: %w", from.OrgName, err)
+	}
+
+	// Extras are planned before anything is written to the target, so
+	// declining the confirmation leaves it untouched
+	var extras []ResetTarget
+	if opts.DeleteExtras {
+		var err error
+		extras, err = planExtraObjects(to, GetBackupConfig().Filter(&opts.Filter), workDir)
+		if err != nil {
+			return err
+		}
+
+		if len(extras) == 0 {
+			fmt.Printf("Nothing to delete from %s\n", to.OrgName)
+		} else {
+			fmt.Printf("The following %d objects will be deleted from %s:\n", len(extras), to.OrgName)
+			for _, target := range extras {
+				fmt.Printf("  %-20s %-22s %s\n", target.Resource.Name, target.ID, target.Label)
+			}
+		}
+	}
+
+	if dryRun {
+		fmt.Println("Dry run, nothing was promoted")
+		return nil
+	}
+
+	if len(extras) > 0 {
+		fmt.Printf("Type the org name (%s) to confirm: ", to.OrgName)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != to.OrgName {
+			os.RemoveAll(workDir)
+			return fmt.Errorf("confirmation did not match %s, nothing was promoted", to.OrgName)
+		}
+	}
+
+	fmt.Printf("Promoting configuration into %s...\n", to.OrgName)
+	opts.UpdateExisting = true
+	if err := PerformRestore(to, workDir, opts); err != nil {
+		return err
+	}
+
+	if len(extras) > 0 {
+		fmt.Println("Deleting objects missing from the source...")
+		idMapping := NewIDMapping(workDir)
+		if err := idMapping.Load(); err != nil {
+			return err
+		}
+		if err := deleteExtraObjects(to, extras, idMapping); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Promotion recorded in %s; undo it with: envsync restore rollback -c %s --input %s\n",
+		workDir, to.ConfigFilePath, workDir)
+	return nil
+}
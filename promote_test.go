@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlanExtraObjects(t *testing.T) {
+	inputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"trustedorigin/lists/tos1": {"id": "tos1", "name": "Portal"},
+		"group/lists/00g1":         {"id": "00g1", "profile": map[string]interface{}{"name": "Engineering"}},
+	})
+	backupConfig := GetBackupConfig().Filter(&ResourceFilter{Include: []string{"trustedOrigin/lists", "group/lists"}})
+
+	// Groups are never listed, and neither are types the backup lacks
+	calls := fakeOktaCli(t, map[string]interface{}{
+		"user get --userId me": map[string]interface{}{"id": "00uAdmin"},
+		"trustedOrigin lists": []interface{}{
+			map[string]interface{}{"id": "tosA", "name": "Portal"},
+			map[string]interface{}{"id": "tosB", "name": "Old portal"},
+		},
+	})
+
+	targets, err := planExtraObjects(&Config{OrgName: "dev-222"}, backupConfig, inputDir)
+	if err != nil {
+		t.Fatalf("planExtraObjects() returned %v", err)
+	}
+
+	var got []string
+	for _, target := range targets {
+		got = append(got, target.Resource.Name+" "+target.ID)
+	}
+	if want := []string{"trustedOrigin tosB"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("planExtraObjects() = %v, want %v", got, want)
+	}
+	if want := []string{"user get --userId me", "trustedOrigin lists"}; !reflect.DeepEqual(fakeOktaCliCalls(t, calls), want) {
+		t.Errorf("planExtraObjects() ran %v, want %v", fakeOktaCliCalls(t, calls), want)
+	}
+}
+
+func TestDeleteExtraObjects(t *testing.T) {
+	trustedOrigin := ResetResource{Name: "trustedOrigin", ListCommand: "lists"}
+	inlineHook := ResetResource{Name: "inlineHook", ListCommand: "lists"}
+	targets := []ResetTarget{
+		{Resource: trustedOrigin, ID: "tosA", Label: "Portal"},
+		{Resource: trustedOrigin, ID: "tosB", Label: "Old portal"},
+		{Resource: inlineHook, ID: "cal1", Label: "Token hook"},
+	}
+
+	// tosA was created by the restore after the plan was made
+	idMapping := NewIDMapping(t.TempDir())
+	idMapping.AddMapping("trustedOrigin", "tos1", "tosA")
+
+	calls := fakeOktaCli(t, map[string]interface{}{
+		"trustedOrigin delete --trustedOriginId tosB": map[string]interface{}{},
+	})
+
+	if err := deleteExtraObjects(&Config{OrgName: "dev-222"}, targets, idMapping); err == nil {
+		t.Error("deleteExtraObjects() with a failed delete returned no error")
+	}
+
+	want := []string{
+		"trustedOrigin delete --trustedOriginId tosB",
+		"inlineHook deactivate --inlineHookId cal1",
+	}
+	if got := fakeOktaCliCalls(t, calls); !reflect.DeepEqual(got, want) {
+		t.Errorf("deleteExtraObjects() ran %v, want %v", got, want)
+	}
+}
+
+func TestPerformPromoteRefusesSameOrg(t *testing.T) {
+	calls := fakeOktaCli(t, map[string]interface{}{})
+	cfg := &Config{OrgName: "dev-111"}
+
+	if err := PerformPromote(cfg, cfg, &RestoreOptions{}, true); err == nil {
+		t.Error("PerformPromote() into the same org returned no error")
+	}
+	if got := fakeOktaCliCalls(t, calls); len(got) != 0 {
+		t.Errorf("PerformPromote() into the same org ran %v", got)
+	}
+}
+
+func TestPerformBackupWithoutHistory(t *testing.T) {
+	// A previous promotion's backup of dev-111, written in place
+	outputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"group/lists/00g1": {"id": "00g1"},
+		"group/lists/00g2": {"id": "00g2"},
+	})
+	startedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	if err := WriteManifest(&Manifest{OrgName: "dev-111", StartedAt: startedAt, CompletedAt: startedAt, Dir: outputDir}); err != nil {
+		t.Fatal(err)
+	}
+
+	fakeOktaCli(t, map[string]interface{}{
+		"group lists": []interface{}{map[string]interface{}{"id": "00g1"}},
+	})
+
+	opts := &BackupOptions{Filter: ResourceFilter{Include: []string{"group/lists"}}, NoHistory: true}
+	if err := PerformBackup(&Config{OrgName: "dev-111"}, outputDir, opts); err != nil {
+		t.Fatalf("PerformBackup() returned %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outputDir, tombstoneDirName)); !os.IsNotExist(err) {
+		t.Errorf("PerformBackup() without history wrote tombstones (stat: %v)", err)
+	}
+	snapshots, err := FindSnapshots(filepath.Dir(outputDir), "dev-111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 {
+		t.Errorf("PerformBackup() without history left %d snapshots, want only its own", len(snapshots))
+	}
+}
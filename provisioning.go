@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	connectionCommand = "getDefaultProvisioningConnectionForApplication"
+	featuresCommand   = "listFeaturesForApplication"
+
+	// disabledConnectionNote tells the operator why an app that had a
+	// connection was not connected; restoring again will not change that
+	disabledConnectionNote = "connection was disabled in the backup, features not restored"
+)
+
+// ApplicationProvisioningRestorer sets up the provisioning connection of each
+// restored app, then its provisioning features, which Okta only lets change
+// once the app is connected. The secrets a connection authenticates with are
+// never returned by Okta, so they come from the app credentials file.
+type ApplicationProvisioningRestorer struct{}
+
+func (r *ApplicationProvisioningRestorer) Restore(cfg *Config, idMapping *IDMapping, journal *RestoreJournal, inputDir string, opts *RestoreOptions) error {
+	connectionsDir := filepath.Join(inputDir, "applicationconnections", connectionCommand)
+	featuresDir := filepath.Join(inputDir, "applicationfeatures", featuresCommand)
+
+	appIDs := make(map[string]bool)
+	for _, dir := range []string{connectionsDir, featuresDir} {
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if entry.IsDir() {
+				appIDs[entry.Name()] = true
+			}
+		}
+	}
+	if len(appIDs) == 0 {
+		return nil
+	}
+
+	apps, err := readResourceObjects(filepath.Join(inputDir, "application", "lists"))
+	if err != nil {
+		return fmt.Errorf("error reading applications: %w", err)
+	}
+
+	restoreFeatures := restorerSelected(&opts.Filter, "applicationFeatures")
+	for _, oldAppID := range sortedKeys(appIDs) {
+		if !opts.selects("application", oldAppID) {
+			continue
+		}
+		newAppID, ok := idMapping.GetNewID("application", oldAppID)
+		if !ok {
+			fmt.Printf("Warning: could not find new ID for application %s, skipping its provisioning...\n", oldAppID)
+			continue
+		}
+
+		label := oldAppID
+		if app, ok := apps[oldAppID]; ok {
+			label = objectLabel(app)
+		}
+		entry := opts.appReport.find(newAppID)
+		updatedInPlace := entry != nil && entry.UpdatedInPlace
+
+		connected, note, err := restoreProvisioningConnection(cfg, connectionsDir, oldAppID, newAppID,
+			opts.appCredentials[label], updatedInPlace)
+		if err != nil {
+			fmt.Printf("Warning: failed to restore the provisioning connection of application %s (%s): %v\n", newAppID, label, err)
+			note = fmt.Sprintf("could not restore the provisioning connection: %v", err)
+		}
+		if note != "" {
+			fmt.Printf("Application %s (%s): %s\n", newAppID, label, note)
+			opts.appReport.Note(newAppID, note)
+		}
+
+		if !restoreFeatures {
+			continue
+		}
+		if !connected {
+			if _, err := os.Stat(filepath.Join(featuresDir, oldAppID)); err == nil && note != "" && note != disabledConnectionNote {
+				opts.appReport.Note(newAppID, "provisioning features not restored, restore again once the connection is set up")
+			}
+			continue
+		}
+		if err := restoreAppFeatures(cfg, featuresDir, oldAppID, newAppID); err != nil {
+			fmt.Printf("Warning: failed to restore the provisioning features of application %s (%s): %v\n", newAppID, label, err)
+			opts.appReport.Note(newAppID, fmt.Sprintf("could not restore the provisioning features: %v", err))
+		}
+	}
+
+	if err := opts.appReport.Save(); err != nil {
+		return fmt.Errorf("could not save app credentials report: %w", err)
+	}
+	return nil
+}
+
+// restoreProvisioningConnection connects a restored app the way the backed up
+// one was, with the secrets the operator supplied. It reports whether the app
+// is connected afterwards, and returns a note when something is left to do.
+func restoreProvisioningConnection(cfg *Config, connectionsDir, oldAppID, newAppID string, supplied SuppliedAppCredentials, updatedInPlace bool) (bool, string, error) {
+	data, err := os.ReadFile(filepath.Join(connectionsDir, oldAppID, connectionCommand+".json"))
+	if os.IsNotExist(err) {
+		// Only the features were backed up, so whatever connection the app has will do
+		return true, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	var connection map[string]interface{}
+	if err := json.Unmarshal(data, &connection); err != nil {
+		return false, "", fmt.Errorf("error parsing provisioning connection: %w", err)
+	}
+
+	authScheme, _ := connection["authScheme"].(string)
+	status, _ := connection["status"].(string)
+	if authScheme == "" {
+		return false, "", nil
+	}
+	if status != "ENABLED" {
+		return false, disabledConnectionNote, nil
+	}
+
+	profile := map[string]interface{}{"authScheme": authScheme}
+	switch authScheme {
+	case "TOKEN":
+		if supplied.ProvisioningToken == "" {
+			if updatedInPlace {
+				return true, "provisioning connection left as it is", nil
+			}
+			return false, "set provisioning_token in the app credentials file to restore the provisioning connection", nil
+		}
+		profile["token"] = supplied.ProvisioningToken
+	case "OAUTH2":
+		if supplied.ProvisioningClientID == "" {
+			if updatedInPlace {
+				return true, "provisioning connection left as it is", nil
+			}
+			return false, "set provisioning_client_id in the app credentials file to restore the provisioning connection", nil
+		}
+		profile["clientId"] = supplied.ProvisioningClientID
+	default:
+		return false, fmt.Sprintf("provisioning connections using %s are not restored, set it up in the Admin Console", authScheme), nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"profile": profile})
+	if err != nil {
+		return false, "", err
+	}
+	if _, err := RunOktaCli(cfg, "applicationConnections", "updateDefaultProvisioningConnectionForApplication",
+		"--appId", newAppID, "--data", string(body)); err != nil {
+		return false, "", err
+	}
+
+	if authScheme == "OAUTH2" {
+		// Okta activates it once an admin grants consent
+		return false, "authorize the provisioning connection in the Admin Console, then restore again for its features", nil
+	}
+
+	if _, err := RunOktaCli(cfg, "applicationConnections", "activateDefaultProvisioningConnectionForApplication",
+		"--appId", newAppID); err != nil {
+		return false, "", fmt.Errorf("could not activate the provisioning connection: %w", err)
+	}
+	return true, "provisioning connection restored", nil
+}
+
+// restoreAppFeatures gives a restored app's provisioning features the
+// settings of the backed up ones
+func restoreAppFeatures(cfg *Config, featuresDir, oldAppID, newAppID string) error {
+	appDir := filepath.Join(featuresDir, oldAppID)
+	if _, err := os.Stat(appDir); os.IsNotExist(err) {
+		return nil
+	}
+	features, err := readResourceObjects(appDir)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failed := 0
+	for _, name := range names {
+		feature := features[name]
+		capabilities, ok := feature["capabilities"]
+		if !ok || feature["status"] != "ENABLED" {
+			continue
+		}
+
+		data, err := json.Marshal(capabilities)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Restoring %s of application %s...\n", name, newAppID)
+		if _, err := RunOktaCli(cfg, "applicationFeatures", "updateFeatureForApplication",
+			"--appId", newAppID, "--featureName", name, "--data", string(data)); err != nil {
+			fmt.Printf("Warning: failed to restore %s of application %s: %v\n", name, newAppID, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d feature(s) could not be updated", failed)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRestoreProvisioningConnection(t *testing.T) {
+	connection := func(authScheme, status string) map[string]interface{} {
+		return map[string]interface{}{"authScheme": authScheme, "status": status}
+	}
+	connectionsDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"0oa1/" + connectionCommand: connection("TOKEN", "ENABLED"),
+		"0oa2/" + connectionCommand: connection("TOKEN", "DISABLED"),
+		"0oa3/" + connectionCommand: connection("OAUTH2", "ENABLED"),
+		"0oa4/" + connectionCommand: connection("BASIC", "ENABLED"),
+	})
+
+	update := func(data string) string {
+		return "applicationConnections updateDefaultProvisioningConnectionForApplication --appId 0oaA --data " + data
+	}
+	activate := "applicationConnections activateDefaultProvisioningConnectionForApplication --appId 0oaA"
+
+	tests := []struct {
+		name           string
+		oldAppID       string
+		supplied       SuppliedAppCredentials
+		updatedInPlace bool
+		wantConnected  bool
+		wantNote       string
+		wantCalls      []string
+	}{
+		{
+			name:          "only features backed up",
+			oldAppID:      "0oa9",
+			wantConnected: true,
+		},
+		{
+			name:          "token supplied",
+			oldAppID:      "0oa1",
+			supplied:      SuppliedAppCredentials{ProvisioningToken: "secret"},
+			wantConnected: true,
+			wantNote:      "provisioning connection restored",
+			wantCalls:     []string{update(`{"profile":{"authScheme":"TOKEN","token":"secret"}}`), activate},
+		},
+		{
+			name:     "token missing",
+			oldAppID: "0oa1",
+			wantNote: "set provisioning_token in the app credentials file to restore the provisioning connection",
+		},
+		{
+			name:           "token missing for an app updated in place",
+			oldAppID:       "0oa1",
+			updatedInPlace: true,
+			wantConnected:  true,
+			wantNote:       "provisioning connection left as it is",
+		},
+		{
+			name:     "disabled in the backup",
+			oldAppID: "0oa2",
+			supplied: SuppliedAppCredentials{ProvisioningToken: "secret"},
+			wantNote: disabledConnectionNote,
+		},
+		{
+			name:      "OAuth client supplied",
+			oldAppID:  "0oa3",
+			supplied:  SuppliedAppCredentials{ProvisioningClientID: "client"},
+			wantNote:  "authorize the provisioning connection in the Admin Console, then restore again for its features",
+			wantCalls: []string{update(`{"profile":{"authScheme":"OAUTH2","clientId":"client"}}`)},
+		},
+		{
+			name:     "unsupported scheme",
+			oldAppID: "0oa4",
+			wantNote: "provisioning connections using BASIC are not restored, set it up in the Admin Console",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := make(map[string]interface{})
+			for _, call := range test.wantCalls {
+				responses[call] = map[string]interface{}{}
+			}
+			calls := fakeOktaCli(t, responses)
+
+			connected, note, err := restoreProvisioningConnection(&Config{OrgName: "dev-222"}, connectionsDir, test.oldAppID, "0oaA",
+				test.supplied, test.updatedInPlace)
+			if err != nil {
+				t.Fatalf("restoreProvisioningConnection() returned %v", err)
+			}
+			if connected != test.wantConnected || note != test.wantNote {
+				t.Errorf("restoreProvisioningConnection() = %v, %q, want %v, %q", connected, note, test.wantConnected, test.wantNote)
+			}
+			if got := fakeOktaCliCalls(t, calls); !reflect.DeepEqual(got, test.wantCalls) {
+				t.Errorf("restoreProvisioningConnection() ran %v, want %v", got, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRestoreAppFeatures(t *testing.T) {
+	featuresDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"0oa1/USER_PROVISIONING": {"name": "USER_PROVISIONING", "status": "ENABLED",
+			"capabilities": map[string]interface{}{"create": map[string]interface{}{"lifecycleCreate": map[string]interface{}{"status": "ENABLED"}}}},
+		"0oa1/INBOUND_PROVISIONING": {"name": "INBOUND_PROVISIONING", "status": "DISABLED",
+			"capabilities": map[string]interface{}{"importSettings": map[string]interface{}{}}},
+	})
+
+	updateFeature := `applicationFeatures updateFeatureForApplication --appId 0oaA --featureName USER_PROVISIONING --data {"create":{"lifecycleCreate":{"status":"ENABLED"}}}`
+
+	tests := []struct {
+		name      string
+		responses map[string]interface{}
+		wantErr   bool
+	}{
+		{name: "updated", responses: map[string]interface{}{updateFeature: map[string]interface{}{}}},
+		{name: "refused", responses: map[string]interface{}{}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := fakeOktaCli(t, test.responses)
+
+			err := restoreAppFeatures(&Config{OrgName: "dev-222"}, featuresDir, "0oa1", "0oaA")
+			if (err != nil) != test.wantErr {
+				t.Errorf("restoreAppFeatures() returned %v, want an error %v", err, test.wantErr)
+			}
+			// Disabled features are left at the target's defaults
+			if got, want := fakeOktaCliCalls(t, calls), []string{updateFeature}; !reflect.DeepEqual(got, want) {
+				t.Errorf("restoreAppFeatures() ran %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestApplicationProvisioningRestorerDisabledConnection(t *testing.T) {
+	inputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"application/lists/0oa1": {"id": "0oa1", "label": "Zendesk"},
+		"applicationconnections/" + connectionCommand + "/0oa1/" + connectionCommand: {"authScheme": "TOKEN", "status": "DISABLED"},
+		"applicationfeatures/" + featuresCommand + "/0oa1/USER_PROVISIONING":         {"name": "USER_PROVISIONING", "status": "ENABLED", "capabilities": map[string]interface{}{}},
+	})
+	idMapping := NewIDMapping(inputDir)
+	idMapping.AddMapping("application", "0oa1", "0oaA")
+	calls := fakeOktaCli(t, map[string]interface{}{})
+
+	opts := &RestoreOptions{appReport: NewAppCredentialsReport(inputDir, "dev-222")}
+	opts.appReport.Add(AppCredentialsEntry{Label: "Zendesk", OldID: "0oa1", NewID: "0oaA"})
+	if err := (&ApplicationProvisioningRestorer{}).Restore(&Config{OrgName: "dev-222"}, idMapping, NewRestoreJournal(inputDir), inputDir, opts); err != nil {
+		t.Fatalf("Restore() returned %v", err)
+	}
+
+	if got := fakeOktaCliCalls(t, calls); len(got) != 0 {
+		t.Errorf("Restore() of a disabled connection ran %v", got)
+	}
+	if got, want := opts.appReport.find("0oaA").Notes, []string{disabledConnectionNote}; !reflect.DeepEqual(got, want) {
+		t.Errorf("report notes = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// defaultDevOrgLimits are assumed caps for free developer orgs. Okta does not
+// publish one table of them and they change with the plan, so they are marked
+// as assumed in the preflight and --limit sets the org's real limit.
+var defaultDevOrgLimits = map[string]int{
+	"user":                100,
+	"application":         10,
+	"authorizationServer": 3,
+	"identityProvider":    5,
+	"customDomain":        1,
+	"feature":             10,
+}
+
+// QuotaUsage is the preflight breakdown for one resource type
+type QuotaUsage struct {
+	Resource string
+	Current  int
+	Planned  int
+	Limit    int
+	// Assumed is set when Limit is the default rather than one given with --limit
+	Assumed bool
+}
+
+// Exceeded reports whether the restore would push the resource type past its limit
+func (u QuotaUsage) Exceeded() bool {
+	return u.Current+u.Planned > u.Limit
+}
+
+// countsTowardLimit reports whether an object occupies a slot in the org's quota
+func countsTowardLimit(resourceName string, object map[string]interface{}) bool {
+	status, _ := object["status"].(string)
+	switch resourceName {
+	case "user":
+		return status != "DEPROVISIONED"
+	case "application":
+		// Okta's own apps come with the org and cannot be restored
+		return !isOktaManagedApp(object)
+	case "feature":
+		// Only enabled features are limited, and a restore enables them in place
+		return status == "ENABLED"
+	}
+	return true
+}
+
+// CheckRestoreQuota compares what the backup will create with current usage in
+// the target org, before restore writes anything
+func CheckRestoreQuota(cfg *Config, backupConfig *BackupConfig, inputDir string, opts *RestoreOptions) error {
+	limits := make(map[string]int)
+	for name, limit := range defaultDevOrgLimits {
+		limits[name] = limit
+	}
+	for name, limit := range opts.Limits {
+		if _, ok := defaultDevOrgLimits[name]; !ok {
+			return fmt.Errorf("--limit %s: no limit is checked for %s, use one of %s", name, name, strings.Join(sortedLimitNames(), ", "))
+		}
+		limits[name] = limit
+	}
+	
+	var usages []QuotaUsage
+	seen := make(map[string]bool)
+	for _, resource := range backupConfig.FirstPassResources {
+		limit, ok := limits[resource.objectType()]
+		if !ok || seen[resource.Name] {
+			continue
+		}
+		seen[resource.Name] = true
+		
+		resourceDir := filepath.Join(inputDir, strings.ToLower(resource.Name), "lists")
+		if _, err := os.Stat(resourceDir); os.IsNotExist(err) {
+			continue
+		}
+		
+		objects, err := readResourceObjects(resourceDir)
+		if err != nil {
+			if err := quotaCountFailed(opts, fmt.Errorf("could not count %s in backup: %w", resource.Name, err)); err != nil {
+				return err
+			}
+			continue
+		}
+		
+		items, err := listResourceObjects(cfg, resource)
+		if err != nil {
+			if err := quotaCountFailed(opts, fmt.Errorf("could not count %s in %s: %w", resource.Name, cfg.OrgName, err)); err != nil {
+				return err
+			}
+			continue
+		}
+		
+		_, given := opts.Limits[resource.objectType()]
+		usage := QuotaUsage{Resource: resource.Name, Limit: limit, Assumed: !given}
+		existing := make(map[string]bool)
+		for _, item := range items {
+			if countsTowardLimit(resource.Name, item) {
+				usage.Current++
+			}
+			existing[objectLabel(item)] = countsTowardLimit(resource.Name, item)
+		}
+		
+		for id, object := range objects {
+			if !opts.selects(resource.Name, id) || !countsTowardLimit(resource.Name, object) {
+				continue
+			}
+			// Objects updated in place take no new slot
+			label := objectLabel(object)
+			if _, ok := existing[label]; ok && opts.UpdateExisting {
+				continue
+			}
+			// Features always exist, so only those not yet enabled take one
+			if resource.Name == "feature" && existing[label] {
+				continue
+			}
+			usage.Planned++
+		}
+		if usage.Planned == 0 {
+			continue
+		}
+		
+		usages = append(usages, usage)
+	}
+	
+	sort.Slice(usages, func(i, j int) bool { return usages[i].Resource < usages[j].Resource })
+	
+	fmt.Printf("%-22s %8s %8s %8s\n", "RESOURCE", "CURRENT", "RESTORE", "LIMIT")
+	var exceeded []string
+	assumed := false
+	for _, usage := range usages {
+		limit := fmt.Sprint(usage.Limit)
+		if usage.Assumed {
+			limit += "*"
+			assumed = true
+		}
+		marker := ""
+		if usage.Exceeded() {
+			marker = "  over limit"
+			exceeded = append(exceeded, usage.Resource)
+		}
+		fmt.Printf("%-22s %8d %8d %8s%s\n", usage.Resource, usage.Current, usage.Planned, limit, marker)
+	}
+	if assumed {
+		fmt.Println("* assumed developer org limit, set the org's own with --limit")
+	}
+	
+	if len(exceeded) == 0 {
+		return nil
+	}
+	
+	if opts.QuotaWarnOnly {
+		fmt.Printf("Warning: restore will exceed %s limits in %s, continuing anyway\n", 
+			strings.Join(exceeded, ", "), cfg.OrgName)
+		return nil
+	}
+	
+	return fmt.Errorf("restore would exceed %s limits in %s; free up space, raise --limit, or pass --quota-warn-only", 
+		strings.Join(exceeded, ", "), cfg.OrgName)
+}
+
+// quotaCountFailed refuses the restore when usage cannot be counted, since
+// the limits could not be checked, unless overruns only warn
+func quotaCountFailed(opts *RestoreOptions, err error) error {
+	if opts.QuotaWarnOnly {
+		fmt.Printf("Warning: %v\n", err)
+		return nil
+	}
+	return fmt.Errorf("%w; pass --quota-warn-only to restore without checking limits", err)
+}
+
+// sortedLimitNames returns the resource types the preflight checks
+func sortedLimitNames() []string {
+	names := make([]string, 0, len(defaultDevOrgLimits))
+	for name := range defaultDevOrgLimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCountsTowardLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource string
+		object   map[string]interface{}
+		want     bool
+	}{
+		{name: "active user", resource: "user", object: map[string]interface{}{"status": "ACTIVE"}, want: true},
+		{name: "deprovisioned user", resource: "user", object: map[string]interface{}{"status": "DEPROVISIONED"}, want: false},
+		{name: "custom app", resource: "application", object: map[string]interface{}{"name": "oidc_client"}, want: true},
+		{name: "Okta admin console", resource: "application", object: map[string]interface{}{"name": "saasure"}, want: false},
+		{name: "Okta dashboard", resource: "application", object: map[string]interface{}{"name": "okta_enduser"}, want: false},
+		{name: "enabled feature", resource: "feature", object: map[string]interface{}{"status": "ENABLED"}, want: true},
+		{name: "disabled feature", resource: "feature", object: map[string]interface{}{"status": "DISABLED"}, want: false},
+		{name: "other resource", resource: "identityProvider", object: map[string]interface{}{"status": "INACTIVE"}, want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := countsTowardLimit(test.resource, test.object); got != test.want {
+				t.Errorf("countsTowardLimit(%s, %v) = %v, want %v", test.resource, test.object, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckRestoreQuota(t *testing.T) {
+	app := func(id, label string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "name": "oidc_client", "label": label}
+	}
+
+	inputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"application/lists/0oa1": app("0oa1", "Portal"),
+		"application/lists/0oa2": app("0oa2", "Billing"),
+		"application/lists/0oa3": app("0oa3", "Reports"),
+	})
+	backupConfig := GetBackupConfig().Filter(&ResourceFilter{Include: []string{"application/lists"}})
+	cfg := &Config{OrgName: "dev-222"}
+
+	tests := []struct {
+		name    string
+		apps    interface{}
+		opts    RestoreOptions
+		wantErr bool
+	}{
+		{
+			name: "under the limit",
+			apps: []interface{}{app("0oaA", "Portal")},
+			opts: RestoreOptions{Limits: map[string]int{"application": 4}},
+		},
+		{
+			name:    "over the limit",
+			apps:    []interface{}{app("0oaA", "Wiki"), app("0oaB", "Chat")},
+			opts:    RestoreOptions{Limits: map[string]int{"application": 4}},
+			wantErr: true,
+		},
+		{
+			name: "over the limit only warns",
+			apps: []interface{}{app("0oaA", "Wiki"), app("0oaB", "Chat")},
+			opts: RestoreOptions{Limits: map[string]int{"application": 4}, QuotaWarnOnly: true},
+		},
+		{
+			name: "apps updated in place take no slot",
+			apps: []interface{}{app("0oaA", "Portal"), app("0oaB", "Billing")},
+			opts: RestoreOptions{Limits: map[string]int{"application": 3}, UpdateExisting: true},
+		},
+		{
+			name: "Okta's own apps take no slot",
+			apps: []interface{}{
+				map[string]interface{}{"id": "0oaA", "name": "saasure", "label": "Okta Admin Console"},
+				map[string]interface{}{"id": "0oaB", "name": "okta_enduser", "label": "Okta Dashboard"},
+			},
+			opts: RestoreOptions{Limits: map[string]int{"application": 3}},
+		},
+		{
+			name:    "limit for a type that is not checked",
+			apps:    []interface{}{},
+			opts:    RestoreOptions{Limits: map[string]int{"group": 10}},
+			wantErr: true,
+		},
+		{
+			name:    "usage that cannot be counted",
+			opts:    RestoreOptions{},
+			wantErr: true,
+		},
+		{
+			name: "usage that cannot be counted only warns",
+			opts: RestoreOptions{QuotaWarnOnly: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := map[string]interface{}{}
+			if test.apps != nil {
+				responses["application lists"] = test.apps
+			}
+			fakeOktaCli(t, responses)
+
+			err := CheckRestoreQuota(cfg, backupConfig, inputDir, &test.opts)
+			if test.wantErr && err == nil {
+				t.Error("CheckRestoreQuota() returned no error")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("CheckRestoreQuota() returned %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RecoveredObject is an object found in the snapshot history, along with the
+// snapshot whose second pass data describes its relationships
+type RecoveredObject struct {
+	ResourceType string
+	ID           string
+	Object       map[string]interface{}
+	Snapshot     *Manifest
+	// Children is the object's second pass data when it was recovered from a
+	// tombstone that carries it, see Tombstone
+	Children map[string]map[string]map[string]interface{}
+}
+
+// matchesObjectKey reports whether an object is the one a user asked for, by
+// ID or by natural key (login, email, name or label)
+func matchesObjectKey(object map[string]interface{}, key string) bool {
+	if id, _ := object["id"].(string); id == key {
+		return true
+	}
+	if strings.EqualFold(objectLabel(object), key) {
+		return true
+	}
+	if email, ok := lookupJSONPath(object, "profile.email"); ok {
+		if s, ok := email.(string); ok && strings.EqualFold(s, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAsOf accepts a date or an RFC 3339 timestamp. A bare date means the
+// end of that day, so snapshots taken during it count.
+func parseAsOf(value string) (time.Time, error) {
+	if value == "" {
+		return time.Now().UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t.Add(24*time.Hour - time.Nanosecond), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --as-of %q, expected YYYY-MM-DD or RFC 3339", value)
+}
+
+// FindInHistory looks for an object in the newest snapshot taken at or before
+// asOf that has it, falling back to the tombstones those snapshots carry
+func FindInHistory(historyDir, orgName, resourceType, key string, asOf time.Time) (*RecoveredObject, error) {
+	snapshots, err := FindSnapshots(historyDir, orgName)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, fmt.Errorf("no snapshots of %s found in %s", orgName, historyDir)
+	}
+
+	var listCommand string
+	for _, resource := range GetBackupConfig().FirstPassResources {
+		if resource.Name == resourceType {
+			listCommand = resource.ListCommand
+			break
+		}
+	}
+	if listCommand == "" {
+		return nil, fmt.Errorf("%s is not a resource type that can be recovered", resourceType)
+	}
+
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		snapshot := snapshots[i]
+		if snapshot.StartedAt.After(asOf) {
+			continue
+		}
+
+		objects, err := readResourceObjects(filepath.Join(snapshot.Dir, strings.ToLower(resourceType), listCommand))
+		if err == nil {
+			for id, object := range objects {
+				if matchesObjectKey(object, key) {
+					return &RecoveredObject{ResourceType: resourceType, ID: id, Object: object, Snapshot: snapshot}, nil
+				}
+			}
+		}
+
+		for id, tombstone := range readTombstones(snapshot.Dir)[resourceType] {
+			if !matchesObjectKey(tombstone.LastKnown, key) {
+				continue
+			}
+			if tombstone.Children != nil {
+				return &RecoveredObject{ResourceType: resourceType, ID: id, Object: tombstone.LastKnown,
+					Snapshot: snapshot, Children: tombstone.Children}, nil
+			}
+			// Older tombstones leave the object's relationships in the snapshot that had it
+			last, err := ReadManifest(tombstone.LastSnapshot)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s was last seen in %s, which is no longer readable: %w",
+					resourceType, key, tombstone.LastSnapshot, err)
+			}
+			return &RecoveredObject{ResourceType: resourceType, ID: id, Object: tombstone.LastKnown, Snapshot: last}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s %s was not found in any snapshot of %s taken before %s",
+		resourceType, key, orgName, asOf.Format(time.RFC3339))
+}
+
+// PerformRecover recreates one deleted object in the live org from the
+// snapshot history and reattaches the relationships that snapshot recorded
+func PerformRecover(cfg *Config, historyDir, resourceType, key, asOfValue string, dryRun bool) error {
+	asOf, err := parseAsOf(asOfValue)
+	if err != nil {
+		return err
+	}
+
+	if historyDir == "" {
+		historyDir = filepath.Dir(DefaultConfigPath())
+	}
+
+	found, err := FindInHistory(historyDir, cfg.OrgName, resourceType, key, asOf)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Found %s %s (%s) in snapshot %s taken %s\n", resourceType, found.ID, objectLabel(found.Object),
+		found.Snapshot.Dir, found.Snapshot.StartedAt.Format(time.RFC3339))
+
+	idFlag := fmt.Sprintf("--%s", getParameterFlagForResource(resourceType))
+	_, err = RunOktaCli(cfg, resourceType, "get", idFlag, found.ID)
+	if err == nil {
+		return fmt.Errorf("%s %s still exists in %s, nothing to recover", resourceType, found.ID, cfg.OrgName)
+	}
+	// Only a 404 says the object is gone; anything else may hide one that exists
+	if classifyOktaCliError(err) != "not found" {
+		return fmt.Errorf("could not check whether %s %s still exists in %s: %w", resourceType, found.ID, cfg.OrgName, err)
+	}
+
+	attachments := recoveryAttachments(found)
+	for _, attachment := range attachments {
+		fmt.Printf("  will %s\n", attachment.Description)
+	}
+
+	if dryRun {
+		fmt.Println("Dry run, nothing was recreated")
+		return nil
+	}
+
+	tmp, err := os.CreateTemp("", "envsync-recover-*.json")
+	if err != nil {
+		return fmt.Errorf("could not create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(found.Object); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write %s to temp file: %w", resourceType, err)
+	}
+	tmp.Close()
+
+	newID, err := restoreResource(cfg, resourceType, tmp.Name())
+	if err != nil {
+		return fmt.Errorf("error recreating %s %s: %w", resourceType, found.ID, err)
+	}
+	fmt.Printf("Recreated %s %s as %s\n", resourceType, found.ID, newID)
+
+	failures := 0
+	for _, attachment := range attachments {
+		if _, err := RunOktaCli(cfg, attachment.Args(newID)...); err != nil {
+			fmt.Printf("Warning: failed to %s: %v\n", attachment.Description, err)
+			failures++
+			continue
+		}
+		fmt.Printf("Done: %s\n", attachment.Description)
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("recovered %s as %s but %d relationship(s) could not be restored", resourceType, newID, failures)
+	}
+
+	fmt.Println("Recover completed successfully!")
+	return nil
+}
+
+// RecoveryAttachment is one relationship to put back once the object exists
+type RecoveryAttachment struct {
+	Description string
+	// Args builds the okta-cli-client arguments given the object's new ID
+	Args func(newID string) []string
+}
+
+// recoveryAttachments reads the relationships the snapshot recorded for an
+// object from its second pass data
+func recoveryAttachments(found *RecoveredObject) []RecoveryAttachment {
+	var attachments []RecoveryAttachment
+	snapshotDir := found.Snapshot.Dir
+
+	readChildren := func(resourceName, listCommand, parentID string) map[string]map[string]interface{} {
+		if parentID == found.ID && found.Children != nil {
+			return found.Children[resourceName+"/"+listCommand]
+		}
+		objects, err := readResourceObjects(filepath.Join(snapshotDir, strings.ToLower(resourceName), listCommand, parentID))
+		if err != nil {
+			return nil
+		}
+		return objects
+	}
+
+	switch found.ResourceType {
+	case "user":
+		viaGroups := make(map[string]bool)
+		for groupID, group := range readChildren("user", "listGroups", found.ID) {
+			if group["type"] != "OKTA_GROUP" {
+				continue
+			}
+			attachments = append(attachments, RecoveryAttachment{
+				Description: fmt.Sprintf("add to group %s (%s)", groupID, objectLabel(group)),
+				Args: func(newID string) []string {
+					return []string{"group", "addUserToGroup", "--groupId", groupID, "--userId", newID}
+				},
+			})
+			for appID := range readChildren("group", "listAssignedApplicationsFor", groupID) {
+				viaGroups[appID] = true
+			}
+		}
+
+		for _, link := range readChildren("user", "listAppLinks", found.ID) {
+			appID, _ := link["appInstanceId"].(string)
+			if appID == "" || viaGroups[appID] {
+				continue
+			}
+			// Keep the app username and profile when the snapshot has them
+			var appUser map[string]interface{}
+			if found.Children != nil {
+				appUser = found.Children["applicationUsers/list"][appID]
+			} else {
+				appUser = readChildren("applicationUsers", "list", appID)[found.ID]
+			}
+			attachments = append(attachments, RecoveryAttachment{
+				Description: fmt.Sprintf("assign to application %s (%s)", appID, link["label"]),
+				Args: func(newID string) []string {
+					data := fmt.Sprintf(`{"id":%q}`, newID)
+					if appUser != nil {
+						if assignment, err := json.Marshal(appUserAssignment(appUser, newID)); err == nil {
+							data = string(assignment)
+						}
+					}
+					return []string{"applicationUsers", "assignUserToApplication", "--appId", appID, "--data", data}
+				},
+			})
+		}
+
+		for _, role := range readChildren("roleAssignment", "listAssignedRolesForUser", found.ID) {
+			roleType, _ := role["type"].(string)
+			if roleType == "" {
+				continue
+			}
+			attachments = append(attachments, RecoveryAttachment{
+				Description: fmt.Sprintf("assign admin role %s", roleType),
+				Args: func(newID string) []string {
+					return []string{"role", "assignRoleToUser", "--userId", newID, "--type", roleType}
+				},
+			})
+		}
+
+	case "group":
+		for userID, user := range readChildren("group", "listUsers", found.ID) {
+			attachments = append(attachments, RecoveryAttachment{
+				Description: fmt.Sprintf("add member %s (%s)", userID, objectLabel(user)),
+				Args: func(newID string) []string {
+					return []string{"group", "addUserToGroup", "--groupId", newID, "--userId", userID}
+				},
+			})
+		}
+
+		for appID, app := range readChildren("group", "listAssignedApplicationsFor", found.ID) {
+			attachments = append(attachments, RecoveryAttachment{
+				Description: fmt.Sprintf("assign to application %s (%s)", appID, objectLabel(app)),
+				Args: func(newID string) []string {
+					return []string{"applicationGroups", "assignGroupToApplication", "--appId", appID, "--groupId", newID}
+				},
+			})
+		}
+	}
+
+	return attachments
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMatchesObjectKey(t *testing.T) {
+	user := map[string]interface{}{"id": "00u1", "profile": map[string]interface{}{"login": "jane.doe", "email": "Jane@Example.com"}}
+	app := map[string]interface{}{"id": "0oa1", "label": "Portal"}
+
+	tests := []struct {
+		name   string
+		object map[string]interface{}
+		key    string
+		want   bool
+	}{
+		{name: "ID", object: user, key: "00u1", want: true},
+		{name: "login", object: user, key: "jane.doe", want: true},
+		{name: "email in another case", object: user, key: "jane@example.com", want: true},
+		{name: "label in another case", object: app, key: "portal", want: true},
+		{name: "ID in another case", object: user, key: "00U1", want: false},
+		{name: "someone else", object: user, key: "john@example.com", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := matchesObjectKey(test.object, test.key); got != test.want {
+				t.Errorf("matchesObjectKey(%q) = %v, want %v", test.key, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseAsOf(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "2026-10-01T12:00:00Z", want: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)},
+		{value: "2026-10-01", want: time.Date(2026, 10, 1, 23, 59, 59, 999999999, time.UTC)},
+		{value: "01/10/2026", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := parseAsOf(test.value)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("parseAsOf(%q) = %v, want an error", test.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAsOf(%q) returned %v", test.value, err)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("parseAsOf(%q) = %v, want %v", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+// writeTestSnapshot writes a finished snapshot of dev-111 named after when it
+// was taken into historyDir
+func writeTestSnapshot(t *testing.T, historyDir string, startedAt time.Time, objects map[string]map[string]interface{}) string {
+	t.Helper()
+	dir := filepath.Join(historyDir, "dev-111-"+startedAt.Format("20060102T150405"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, object := range objects {
+		objectDir := filepath.Join(dir, filepath.Dir(filepath.FromSlash(name)))
+		if err := os.MkdirAll(objectDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeBackupObject(objectDir, filepath.Base(name), object); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WriteManifest(&Manifest{OrgName: "dev-111", StartedAt: startedAt, CompletedAt: startedAt, Dir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestFindInHistory(t *testing.T) {
+	jane := map[string]interface{}{"id": "00u1", "profile": map[string]interface{}{"login": "jane@example.com"}}
+	september := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	october := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	historyDir := t.TempDir()
+	septemberDir := writeTestSnapshot(t, historyDir, september, map[string]map[string]interface{}{
+		"user/lists/00u1": jane,
+	})
+	octoberDir := writeTestSnapshot(t, historyDir, october, map[string]map[string]interface{}{
+		"tombstones/user/00u1": {"resourceType": "user", "id": "00u1", "lastSnapshot": septemberDir, "lastKnown": jane,
+			"children": map[string]interface{}{"user/listGroups": map[string]interface{}{"00g1": map[string]interface{}{"id": "00g1"}}}},
+	})
+
+	tests := []struct {
+		name         string
+		key          string
+		asOf         time.Time
+		wantSnapshot string
+		wantChildren bool
+		wantErr      bool
+	}{
+		{name: "tombstone in the newest snapshot", key: "jane@example.com", asOf: october.Add(time.Hour), wantSnapshot: octoberDir, wantChildren: true},
+		{name: "object in an older snapshot", key: "00u1", asOf: september.Add(time.Hour), wantSnapshot: septemberDir},
+		{name: "before any snapshot", key: "00u1", asOf: september.Add(-time.Hour), wantErr: true},
+		{name: "never backed up", key: "john@example.com", asOf: october.Add(time.Hour), wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			found, err := FindInHistory(historyDir, "dev-111", "user", test.key, test.asOf)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("FindInHistory(%q) found %s in %s, want an error", test.key, found.ID, found.Snapshot.Dir)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindInHistory(%q) returned %v", test.key, err)
+			}
+			if found.ID != "00u1" || found.Snapshot.Dir != test.wantSnapshot {
+				t.Errorf("FindInHistory(%q) = %s in %s, want 00u1 in %s", test.key, found.ID, found.Snapshot.Dir, test.wantSnapshot)
+			}
+			if (found.Children != nil) != test.wantChildren {
+				t.Errorf("FindInHistory(%q) children = %v, want children %v", test.key, found.Children, test.wantChildren)
+			}
+		})
+	}
+
+	if _, err := FindInHistory(historyDir, "dev-111", "groupOwner", "00u1", october); err == nil {
+		t.Error("FindInHistory() of a second pass type returned no error")
+	}
+}
+
+func TestRecoveryAttachments(t *testing.T) {
+	snapshotDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"user/listGroups/00u1/00g1":                        {"id": "00g1", "type": "OKTA_GROUP", "profile": map[string]interface{}{"name": "Engineering"}},
+		"user/listGroups/00u1/00g2":                        {"id": "00g2", "type": "BUILT_IN", "profile": map[string]interface{}{"name": "Everyone"}},
+		"group/listAssignedApplicationsFor/00g1/0oa1":      {"id": "0oa1", "label": "Wiki"},
+		"user/listAppLinks/00u1/link1":                     {"appInstanceId": "0oa1", "label": "Wiki"},
+		"user/listAppLinks/00u1/link2":                     {"appInstanceId": "0oa2", "label": "Portal"},
+		"applicationusers/list/0oa2/00u1":                  {"id": "00u1", "credentials": map[string]interface{}{"userName": "jane"}},
+		"roleassignment/listAssignedRolesForUser/00u1/ra1": {"id": "ra1", "type": "HELP_DESK_ADMIN"},
+		"group/listUsers/00g1/00u1":                        {"id": "00u1", "profile": map[string]interface{}{"login": "jane@example.com"}},
+	})
+	snapshot := &Manifest{Dir: snapshotDir}
+
+	tests := []struct {
+		name  string
+		found *RecoveredObject
+		want  map[string][]string
+	}{
+		{
+			name:  "user",
+			found: &RecoveredObject{ResourceType: "user", ID: "00u1", Snapshot: snapshot},
+			want: map[string][]string{
+				"add to group 00g1 (Engineering)": {"group", "addUserToGroup", "--groupId", "00g1", "--userId", "00uNew"},
+				"assign to application 0oa2 (Portal)": {"applicationUsers", "assignUserToApplication", "--appId", "0oa2", "--data",
+					`{"credentials":{"userName":"jane"},"id":"00uNew","scope":"USER"}`},
+				"assign admin role HELP_DESK_ADMIN": {"role", "assignRoleToUser", "--userId", "00uNew", "--type", "HELP_DESK_ADMIN"},
+			},
+		},
+		{
+			name: "user from a tombstone",
+			found: &RecoveredObject{ResourceType: "user", ID: "00u1", Snapshot: snapshot, Children: map[string]map[string]map[string]interface{}{
+				"user/listAppLinks":     {"link2": {"appInstanceId": "0oa2", "label": "Portal"}},
+				"applicationUsers/list": {"0oa2": {"id": "00u1"}},
+			}},
+			want: map[string][]string{
+				"assign to application 0oa2 (Portal)": {"applicationUsers", "assignUserToApplication", "--appId", "0oa2", "--data",
+					`{"id":"00uNew","scope":"USER"}`},
+			},
+		},
+		{
+			name:  "group",
+			found: &RecoveredObject{ResourceType: "group", ID: "00g1", Snapshot: snapshot},
+			want: map[string][]string{
+				"add member 00u1 (jane@example.com)": {"group", "addUserToGroup", "--groupId", "00uNew", "--userId", "00u1"},
+				"assign to application 0oa1 (Wiki)":  {"applicationGroups", "assignGroupToApplication", "--appId", "0oa1", "--groupId", "00uNew"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := make(map[string][]string)
+			for _, attachment := range recoveryAttachments(test.found) {
+				got[attachment.Description] = attachment.Args("00uNew")
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				var descriptions []string
+				for description := range got {
+					descriptions = append(descriptions, description)
+				}
+				sort.Strings(descriptions)
+				t.Errorf("recoveryAttachments() = %v (%v), want %v", got, descriptions, test.want)
+			}
+		})
+	}
+}
+
+func TestPerformRecoverOnlyRecreatesMissingObjects(t *testing.T) {
+	jane := map[string]interface{}{"id": "00u1", "profile": map[string]interface{}{"login": "jane@example.com"}}
+	historyDir := t.TempDir()
+	writeTestSnapshot(t, historyDir, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), map[string]map[string]interface{}{
+		"user/lists/00u1": jane,
+	})
+
+	tests := []struct {
+		name      string
+		responses map[string]interface{}
+		wantErr   bool
+	}{
+		{name: "object is gone", responses: map[string]interface{}{}},
+		{name: "object still exists", responses: map[string]interface{}{"user get --userId 00u1": jane}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fakeOktaCli(t, test.responses)
+			err := PerformRecover(&Config{OrgName: "dev-111"}, historyDir, "user", "jane@example.com", "", true)
+			if test.wantErr && err == nil {
+				t.Error("PerformRecover() returned no error")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("PerformRecover() returned %v", err)
+			}
+		})
+	}
+}
+
+func TestPerformRecoverRefusesWhenExistenceIsUnknown(t *testing.T) {
+	historyDir := t.TempDir()
+	writeTestSnapshot(t, historyDir, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), map[string]map[string]interface{}{
+		"user/lists/00u1": {"id": "00u1"},
+	})
+
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho 'Error: 403 Forbidden' >&2\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "okta-cli-client"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	if err := PerformRecover(&Config{OrgName: "dev-111"}, historyDir, "user", "00u1", "", true); err == nil {
+		t.Error("PerformRecover() after a 403 returned no error")
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ResetResource describes how to clear one resource type out of an org
+type ResetResource struct {
+	Name        string
+	ListCommand string
+	// Types to pass to the list command when it refuses to list without one
+	ListTypes []string
+	// IsBuiltIn reports whether an object is an Okta-managed default that reset must keep
+	IsBuiltIn func(object map[string]interface{}) bool
+}
+
+// getResetOrder returns the resource types reset clears, dependents first so
+// nothing is deleted while another object still references it
+func getResetOrder() []ResetResource {
+	return []ResetResource{
+		// Apps go before the access policies they are mapped to
+		{Name: "application", ListCommand: "lists", IsBuiltIn: isOktaManagedApp},
+		{Name: "policy", ListCommand: "lists", ListTypes: policyTypes, IsBuiltIn: isSystemObject},
+		{Name: "authorizationServer", ListCommand: "lists", IsBuiltIn: func(object map[string]interface{}) bool {
+			return object["name"] == "default"
+		}},
+		{Name: "inlineHook", ListCommand: "lists"},
+		{Name: "eventHook", ListCommand: "lists"},
+		{Name: "trustedOrigin", ListCommand: "lists"},
+		{Name: "networkZone", ListCommand: "lists", IsBuiltIn: isSystemObject},
+		{Name: "group", ListCommand: "lists", IsBuiltIn: func(object map[string]interface{}) bool {
+			return object["type"] != "OKTA_GROUP"
+		}},
+		{Name: "user", ListCommand: "lists"},
+	}
+}
+
+// requiresDeactivation reports whether objects of a resource type must be
+// deactivated before Okta will delete them
+func requiresDeactivation(resourceName string) bool {
+	switch resourceName {
+	case "user", "application", "authorizationServer", "identityProvider", 
+		"networkZone", "eventHook", "inlineHook", "policy", "groupRule":
+		return true
+	}
+	return false
+}
+
+// objectCommands names the okta-cli-client resource and commands for object
+// types managed through another resource's commands
+var objectCommands = map[string]struct{ Resource, Deactivate, Delete string }{
+	"groupRule": {Resource: "group", Deactivate: "deactivateRule", Delete: "deleteRule"},
+}
+
+func isSystemObject(object map[string]interface{}) bool {
+	system, _ := object["system"].(bool)
+	return system
+}
+
+// isOktaManagedApp reports whether an app is one of the first-party apps
+// every org ships with (dashboard, admin console, browser plugin)
+func isOktaManagedApp(object map[string]interface{}) bool {
+	name, _ := object["name"].(string)
+	return name == "saasure" || strings.HasPrefix(name, "okta_")
+}
+
+// objectLabel returns a human-readable name for an Okta object
+func objectLabel(object map[string]interface{}) string {
+	if profile, ok := object["profile"].(map[string]interface{}); ok {
+		for _, key := range []string{"login", "name"} {
+			if value, ok := profile[key].(string); ok && value != "" {
+				return value
+			}
+		}
+	}
+
+	for _, key := range []string{"label", "name", "origin"} {
+		if value, ok := object[key].(string); ok && value != "" {
+			return value
+		}
+	}
+
+	id, _ := object["id"].(string)
+	return id
+}
+
+// ResetTarget is one object reset will remove
+type ResetTarget struct {
+	Resource ResetResource
+	ID       string
+	Label    string
+}
+
+// protectedObjects returns the IDs no bulk delete may touch: the admin whose
+// token is doing the deleting. It fails when that admin cannot be looked up,
+// since deleting without knowing who they are could lock them out.
+func protectedObjects(cfg *Config) (map[string]bool, error) {
+	data, err := RunOktaCli(cfg, "user", "get", "--userId", "me")
+	if err != nil {
+		return nil, fmt.Errorf("could not look up the admin running the delete, nothing was deleted: %w", err)
+	}
+
+	var me map[string]interface{}
+	if err := json.Unmarshal(data, &me); err != nil {
+		return nil, fmt.Errorf("error parsing the admin running the delete: %w", err)
+	}
+	id, _ := me["id"].(string)
+	if id == "" {
+		return nil, fmt.Errorf("the admin running the delete has no ID, nothing was deleted")
+	}
+
+	return map[string]bool{id: true}, nil
+}
+
+// listResetTargets lists the objects of one resource type that may be
+// deleted, leaving out built-ins and protected IDs
+func listResetTargets(cfg *Config, resource ResetResource, protected map[string]bool) ([]ResetTarget, error) {
+	listTypes := resource.ListTypes
+	if len(listTypes) == 0 {
+		listTypes = []string{""}
+	}
+
+	var targets []ResetTarget
+	for _, listType := range listTypes {
+		args := []string{resource.Name, resource.ListCommand}
+		if listType != "" {
+			args = append(args, "--type", listType)
+		}
+
+		items, err := RunOktaCliList(cfg, args...)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s in %s: %w", resource.Name, cfg.OrgName, err)
+		}
+
+		for _, item := range items {
+			id, _ := item["id"].(string)
+			if id == "" || protected[id] {
+				continue
+			}
+			if resource.IsBuiltIn != nil && resource.IsBuiltIn(item) {
+				continue
+			}
+			targets = append(targets, ResetTarget{Resource: resource, ID: id, Label: objectLabel(item)})
+		}
+	}
+
+	return targets, nil
+}
+
+// PerformReset deletes every non-built-in object of the reset resource types
+// from the target org so a restore starts from a clean slate
+func PerformReset(cfg *Config, dryRun bool) error {
+	protected, err := protectedObjects(cfg)
+	if err != nil {
+		return err
+	}
+
+	var targets []ResetTarget
+	for _, resource := range getResetOrder() {
+		resourceTargets, err := listResetTargets(cfg, resource, protected)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, resourceTargets...)
+	}
+
+	if len(targets) == 0 {
+		fmt.Printf("Nothing to reset in %s\n", cfg.OrgName)
+		return nil
+	}
+
+	fmt.Printf("The following %d objects will be deleted from %s:\n", len(targets), cfg.OrgName)
+	for _, target := range targets {
+		fmt.Printf("  %-20s %-22s %s\n", target.Resource.Name, target.ID, target.Label)
+	}
+
+	if dryRun {
+		fmt.Println("Dry run, nothing was deleted")
+		return nil
+	}
+
+	fmt.Printf("Type the org name (%s) to confirm: ", cfg.OrgName)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(answer) != cfg.OrgName {
+		return fmt.Errorf("confirmation did not match %s, nothing was deleted", cfg.OrgName)
+	}
+
+	failures := 0
+	for _, target := range targets {
+		if err := deleteObject(cfg, target.Resource.Name, target.ID); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+			failures++
+			continue
+		}
+		fmt.Printf("Deleted %s %s (%s)\n", target.Resource.Name, target.ID, target.Label)
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("reset finished with %d failure(s)", failures)
+	}
+
+	fmt.Println("Reset completed successfully!")
+	return nil
+}
+
+// deleteObject deactivates (when required) and deletes one object
+func deleteObject(cfg *Config, resourceName, id string) error {
+	idFlag := fmt.Sprintf("--%s", getParameterFlagForResource(resourceName))
+	resource, deactivate, del := resourceName, "deactivate", "delete"
+	if commands, ok := objectCommands[resourceName]; ok {
+		resource, deactivate, del = commands.Resource, commands.Deactivate, commands.Delete
+	}
+
+	if requiresDeactivation(resourceName) {
+		if _, err := RunOktaCli(cfg, resource, deactivate, idFlag, id); err != nil {
+			return fmt.Errorf("failed to deactivate %s %s: %w", resourceName, id, err)
+		}
+	}
+
+	if _, err := RunOktaCli(cfg, resource, del, idFlag, id); err != nil {
+		return fmt.Errorf("failed to delete %s %s: %w", resourceName, id, err)
+	}
+
+	return nil
+}
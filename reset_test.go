@@ -0,0 +1,151 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetResetOrder(t *testing.T) {
+	position := make(map[string]int)
+	for i, resource := range getResetOrder() {
+		position[resource.Name] = i
+	}
+
+	// Each object type has to be deleted before the ones it references
+	tests := []struct {
+		dependent  string
+		dependency string
+	}{
+		{dependent: "application", dependency: "policy"},
+		{dependent: "application", dependency: "group"},
+		{dependent: "application", dependency: "user"},
+		{dependent: "policy", dependency: "group"},
+		{dependent: "policy", dependency: "networkZone"},
+		{dependent: "authorizationServer", dependency: "inlineHook"},
+		{dependent: "authorizationServer", dependency: "group"},
+		{dependent: "group", dependency: "user"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dependent+" before "+test.dependency, func(t *testing.T) {
+			dependent, ok := position[test.dependent]
+			if !ok {
+				t.Fatalf("%s is not in the reset order", test.dependent)
+			}
+			dependency, ok := position[test.dependency]
+			if !ok {
+				t.Fatalf("%s is not in the reset order", test.dependency)
+			}
+			if dependent > dependency {
+				t.Errorf("%s is deleted after %s, which it references", test.dependent, test.dependency)
+			}
+		})
+	}
+}
+
+func TestProtectedObjects(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses map[string]interface{}
+		want      map[string]bool
+		wantErr   bool
+	}{
+		{
+			name:      "admin running the delete",
+			responses: map[string]interface{}{"user get --userId me": map[string]interface{}{"id": "00uAdmin"}},
+			want:      map[string]bool{"00uAdmin": true},
+		},
+		{
+			name:      "admin without an ID",
+			responses: map[string]interface{}{"user get --userId me": map[string]interface{}{}},
+			wantErr:   true,
+		},
+		{
+			name:      "admin cannot be looked up",
+			responses: map[string]interface{}{},
+			wantErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fakeOktaCli(t, test.responses)
+
+			got, err := protectedObjects(&Config{OrgName: "dev-222"})
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("protectedObjects() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("protectedObjects() returned %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("protectedObjects() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestListResetTargets(t *testing.T) {
+	fakeOktaCli(t, map[string]interface{}{
+		"application lists": []interface{}{
+			map[string]interface{}{"id": "0oa1", "name": "oidc_client", "label": "Portal"},
+			map[string]interface{}{"id": "0oa2", "name": "saasure", "label": "Okta Admin Console"},
+			map[string]interface{}{"id": "0oa3", "name": "okta_enduser", "label": "Okta Dashboard"},
+		},
+		"user lists": []interface{}{
+			map[string]interface{}{"id": "00uAdmin", "profile": map[string]interface{}{"login": "admin@example.com"}},
+			map[string]interface{}{"id": "00u1", "profile": map[string]interface{}{"login": "jane@example.com"}},
+		},
+		"group lists": []interface{}{
+			map[string]interface{}{"id": "00g1", "type": "OKTA_GROUP", "profile": map[string]interface{}{"name": "Engineering"}},
+			map[string]interface{}{"id": "00g2", "type": "BUILT_IN", "profile": map[string]interface{}{"name": "Everyone"}},
+		},
+	})
+	cfg := &Config{OrgName: "dev-222"}
+	protected := map[string]bool{"00uAdmin": true}
+
+	resources := make(map[string]ResetResource)
+	for _, resource := range getResetOrder() {
+		resources[resource.Name] = resource
+	}
+
+	tests := []struct {
+		resource string
+		want     []string
+	}{
+		{resource: "application", want: []string{"0oa1 Portal"}},
+		{resource: "user", want: []string{"00u1 jane@example.com"}},
+		{resource: "group", want: []string{"00g1 Engineering"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.resource, func(t *testing.T) {
+			targets, err := listResetTargets(cfg, resources[test.resource], protected)
+			if err != nil {
+				t.Fatalf("listResetTargets() returned %v", err)
+			}
+			var got []string
+			for _, target := range targets {
+				got = append(got, target.ID+" "+target.Label)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("listResetTargets(%s) = %v, want %v", test.resource, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPerformResetRefusesWithoutAdmin(t *testing.T) {
+	fakeOktaCli(t, map[string]interface{}{
+		"user lists": []interface{}{map[string]interface{}{"id": "00uAdmin"}},
+	})
+
+	err := PerformReset(&Config{OrgName: "dev-222"}, true)
+	if err == nil || !strings.Contains(err.Error(), "nothing was deleted") {
+		t.Errorf("PerformReset() returned %v, want it to refuse", err)
+	}
+}
@@ -66,19 +66,117 @@ func (m *IDMapping) Load() error {
 	return json.Unmarshal(data, &m.Mappings)
 }
 
+// JournalEntry records one assignment restore made, with the parameters
+// needed to undo it
+type JournalEntry struct {
+	Action string            `json:"action"`
+	Params map[string]string `json:"params"`
+}
+
+// RestoreJournal records the assignments restore made, which IDMapping cannot
+// capture because they have no ID of their own
+type RestoreJournal struct {
+	OrgName  string         `json:"org"`
+	Entries  []JournalEntry `json:"entries"`
+	FilePath string         `json:"-"`
+}
+
+func NewRestoreJournal(restoreDir string) *RestoreJournal {
+	return &RestoreJournal{
+		FilePath: filepath.Join(restoreDir, "restore_journal.json"),
+	}
+}
+
+func (j *RestoreJournal) Record(action string, params map[string]string) {
+	j.Entries = append(j.Entries, JournalEntry{Action: action, Params: params})
+	
+	j.Save()
+}
+
+func (j *RestoreJournal) Save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling restore journal: %w", err)
+	}
+	
+	return os.WriteFile(j.FilePath, data, 0644)
+}
+
+func (j *RestoreJournal) Load() error {
+	if _, err := os.Stat(j.FilePath); os.IsNotExist(err) {
+		j.Entries = nil
+		return nil
+	}
+	
+	data, err := os.ReadFile(j.FilePath)
+	if err != nil {
+		return fmt.Errorf("error reading restore journal: %w", err)
+	}
+	
+	return json.Unmarshal(data, j)
+}
+
 type ResourceRestorer interface {
-	Restore(cfg *Config, idMapping *IDMapping, inputDir string) error
+	Restore(cfg *Config, idMapping *IDMapping, journal *RestoreJournal, inputDir string, opts *RestoreOptions) error
+}
+
+// CustomRestorer restores one registry entry its own way instead of the
+// generic second pass
+type CustomRestorer struct {
+	// Type names the restorer in messages and filters
+	Type string
+	// Entry is the registry entry it restores, so filters select a restorer
+	// the way they select the backup it reads
+	Entry string
+	Restorer ResourceRestorer
 }
 
-var customRestorers = map[string]ResourceRestorer{
-	"applicationGroups": &ApplicationGroupsRestorer{},
-	"user":         &UserGroupsRestorer{},
-	"roleAssignment": &RoleAssignmentRestorer{},
+// customRestorers run in this order once the first and second pass are done:
+// memberships, owners and group rules need the restored users and groups,
+// roles and app assignments come next, then what apps need once assigned
+// (keys, provisioning), and policies last so access policies find every app
+var customRestorers = []CustomRestorer{
+	{Type: "user", Entry: "user/listGroups", Restorer: &UserGroupsRestorer{}},
+	{Type: "groupOwner", Entry: "groupOwner/lists", Restorer: &GroupOwnerRestorer{}},
+	{Type: "groupRule", Entry: "group/listRules", Restorer: &GroupRuleRestorer{}},
+	{Type: "roleAssignment", Entry: "roleAssignment/listAssignedRolesForUser", Restorer: &RoleAssignmentRestorer{}},
+	{Type: "applicationGroups", Entry: "applicationGroups/listApplicationGroupAssignments", Restorer: &ApplicationGroupsRestorer{}},
+	{Type: "applicationUsers", Entry: "applicationUsers/list", Restorer: &ApplicationUsersRestorer{}},
+	{Type: "applicationCredentials", Entry: "applicationCredentials/listApplicationKeys", Restorer: &ApplicationKeysRestorer{}},
+	{Type: "applicationConnections", Entry: "applicationConnections/getDefaultProvisioningConnectionForApplication", Restorer: &ApplicationProvisioningRestorer{}},
+	// App features are restored with the provisioning connection they need
+	{Type: "applicationFeatures", Entry: "applicationFeatures/listFeaturesForApplication"},
+	{Type: "policy", Entry: "policy/lists", Restorer: &PolicyRestorer{}},
+}
+
+// findCustomRestorer looks up the custom restorer of a resource type
+func findCustomRestorer(resourceType string) (CustomRestorer, bool) {
+	for _, restorer := range customRestorers {
+		if restorer.Type == resourceType {
+			return restorer, true
+		}
+	}
+	return CustomRestorer{}, false
+}
+
+// restorerSelected reports whether a filter selects the registry entry a
+// custom restorer restores
+func restorerSelected(filter *ResourceFilter, resourceType string) bool {
+	restorer, _ := findCustomRestorer(resourceType)
+	backupConfig := GetBackupConfig()
+	for _, group := range [][]BackupConfigResource{backupConfig.FirstPassResources, backupConfig.SecondPassResources} {
+		for _, resource := range group {
+			if resource.entryName() == restorer.Entry {
+				return filter.Matches(resource)
+			}
+		}
+	}
+	return filter.MatchesName(resourceType)
 }
 
 type UserGroupsRestorer struct{}
 
-func (r *UserGroupsRestorer) Restore(cfg *Config, idMapping *IDMapping, inputDir string) error {
+func (r *UserGroupsRestorer) Restore(cfg *Config, idMapping *IDMapping, journal *RestoreJournal, inputDir string, opts *RestoreOptions) error {
 	userGroupsDir := filepath.Join(inputDir, "user", "listGroups")
 	
 	if _, err := os.Stat(userGroupsDir); os.IsNotExist(err) {
@@ -93,6 +191,9 @@ func (r *UserGroupsRestorer) Restore(cfg *Config, idMapping *IDMapping, inputDir
 	for _, userDir := range userDirs {
 		if userDir.IsDir() {
 			oldUserID := userDir.Name()
+			if !opts.selects("user", oldUserID) {
+				continue
+			}
 			
 			newUserID, ok := idMapping.GetNewID("user", oldUserID)
 			if !ok {
@@ -145,7 +246,10 @@ func (r *UserGroupsRestorer) Restore(cfg *Config, idMapping *IDMapping, inputDir
 					if err := cmd.Run(); err != nil {
 						fmt.Printf("Warning: failed to add user %s to group %s: %v\n", 
 							newUserID, newGroupID, err)
+						continue
 					}
+					
+					journal.Record("addUserToGroup", map[string]string{"groupId": newGroupID, "userId": newUserID})
 				}
 			}
 		}
@@ -156,7 +260,7 @@ func (r *UserGroupsRestorer) Restore(cfg *Config, idMapping *IDMapping, inputDir
 
 type RoleAssignmentRestorer struct{}
 
-func (r *RoleAssignmentRestorer) Restore(cfg *Config, idMapping *IDMapping, inputDir string) error {
+func (r *RoleAssignmentRestorer) Restore(cfg *Config, idMapping *IDMapping, journal *RestoreJournal, inputDir string, opts *RestoreOptions) error {
 	roleAssignmentsDir := filepath.Join(inputDir, "roleassignment", "listAssignedRolesForUser")
 	
 	if _, err := os.Stat(roleAssignmentsDir); os.IsNotExist(err) {
@@ -171,6 +275,9 @@ func (r *RoleAssignmentRestorer) Restore(cfg *Config, idMapping *IDMapping, inpu
 	for _, userDir := range userDirs {
 		if userDir.IsDir() {
 			oldUserID := userDir.Name()
+			if !opts.selects("user", oldUserID) {
+				continue
+			}
 			
 			newUserID, ok := idMapping.GetNewID("user", oldUserID)
 			if !ok {
@@ -209,16 +316,22 @@ func (r *RoleAssignmentRestorer) Restore(cfg *Config, idMapping *IDMapping, inpu
 					
 					fmt.Printf("Assigning role %s to user %s...\n", roleType, newUserID)
 					
-					cmd := exec.Command("okta-cli-client", PrepareOktaCliArgs(cfg, "role", "assignRoleToUser", 
-						"--userId", newUserID, "--type", roleType)...)
-					
-					cmd.Stdout = os.Stdout
-					cmd.Stderr = os.Stderr
-					
-					if err := cmd.Run(); err != nil {
+					output, err := RunOktaCli(cfg, "role", "assignRoleToUser", 
+						"--userId", newUserID, "--type", roleType)
+					if err != nil {
 						fmt.Printf("Warning: failed to assign role %s to user %s: %v\n", 
 							roleType, newUserID, err)
+						continue
 					}
+					
+					var assigned map[string]interface{}
+					if err := json.Unmarshal(output, &assigned); err != nil {
+						fmt.Printf("Warning: error parsing role assignment for user %s: %v\n", newUserID, err)
+						continue
+					}
+					
+					roleID, _ := assigned["id"].(string)
+					journal.Record("assignRoleToUser", map[string]string{"userId": newUserID, "roleId": roleID, "type": roleType})
 				}
 			}
 		}
@@ -227,118 +340,371 @@ func (r *RoleAssignmentRestorer) Restore(cfg *Config, idMapping *IDMapping, inpu
 	return nil
 }
 
-type ApplicationGroupsRestorer struct{}
+// GroupOwnerRestorer makes the restored users and groups owners of the
+// restored groups they owned. Owners managed by an application are left to
+// that application to push again.
+type GroupOwnerRestorer struct{}
 
-func (r *ApplicationGroupsRestorer) Restore(cfg *Config, idMapping *IDMapping, inputDir string) error {
-	assignmentsDir := filepath.Join(inputDir, "applicationgroups", "listApplicationGroupAssignments")
+func (r *GroupOwnerRestorer) Restore(cfg *Config, idMapping *IDMapping, journal *RestoreJournal, inputDir string, opts *RestoreOptions) error {
+	ownersDir := filepath.Join(inputDir, "groupowner", "lists")
 	
-	if _, err := os.Stat(assignmentsDir); os.IsNotExist(err) {
-		return nil
-	}
-	
-	files, err := os.ReadDir(assignmentsDir)
+	groupDirs, err := os.ReadDir(ownersDir)
 	if err != nil {
-		return fmt.Errorf("error reading directory %s: %w", assignmentsDir, err)
+		return nil
 	}
 	
-	fmt.Printf("Found %d application group assignments to restore\n", len(files))
-	
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
-			filePath := filepath.Join(assignmentsDir, file.Name())
-			
-			data, err := os.ReadFile(filePath)
-			if err != nil {
-				fmt.Printf("Warning: error reading file %s: %v\n", filePath, err)
+	for _, groupDir := range groupDirs {
+		oldGroupID := groupDir.Name()
+		if !groupDir.IsDir() || !opts.selects("group", oldGroupID) {
+			continue
+		}
+		
+		owners, err := readResourceObjects(filepath.Join(ownersDir, oldGroupID))
+		if err != nil || len(owners) == 0 {
+			continue
+		}
+		
+		newGroupID, ok := idMapping.GetNewID("group", oldGroupID)
+		if !ok {
+			fmt.Printf("Warning: could not find new ID for group %s, skipping owners...\n", oldGroupID)
+			continue
+		}
+		
+		for oldOwnerID, owner := range owners {
+			if originType, _ := owner["originType"].(string); originType == "APPLICATION" {
+				fmt.Printf("Skipping owner %s of group %s, it is managed by application %v\n", oldOwnerID, newGroupID, owner["originId"])
 				continue
 			}
 			
-			var assignment map[string]interface{}
-			if err := json.Unmarshal(data, &assignment); err != nil {
-				fmt.Printf("Warning: error parsing JSON in %s: %v\n", filePath, err)
+			ownerType, _ := owner["type"].(string)
+			resourceType := map[string]string{"USER": "user", "GROUP": "group"}[ownerType]
+			if resourceType == "" {
+				fmt.Printf("Warning: owner %s of group %s has unknown type %q\n", oldOwnerID, newGroupID, ownerType)
 				continue
 			}
 			
-			oldAppID, ok := assignment["appId"].(string)
+			newOwnerID, ok := idMapping.GetNewID(resourceType, oldOwnerID)
 			if !ok {
-				fmt.Printf("Warning: missing appId in %s\n", filePath)
+				fmt.Printf("Warning: could not find new ID for %s %s, cannot make it owner of group %s\n", resourceType, oldOwnerID, newGroupID)
 				continue
 			}
 			
-			oldGroupID, ok := assignment["id"].(string)
-			if !ok {
-				fmt.Printf("Warning: missing id in %s\n", filePath)
+			fmt.Printf("Making %s %s owner of group %s...\n", resourceType, newOwnerID, newGroupID)
+			_, err := RunOktaCli(cfg, "groupOwner", "assign", "--groupId", newGroupID,
+				"--data", fmt.Sprintf(`{"id":%q,"type":%q}`, newOwnerID, ownerType))
+			if err != nil {
+				fmt.Printf("Warning: failed to make %s %s owner of group %s: %v\n", resourceType, newOwnerID, newGroupID, err)
 				continue
 			}
 			
-			newAppID, ok := idMapping.GetNewID("application", oldAppID)
+			journal.Record("assignGroupOwner", map[string]string{"groupId": newGroupID, "ownerId": newOwnerID})
+		}
+	}
+	
+	return nil
+}
+
+// ApplicationGroupsRestorer assigns the restored groups to the restored
+// applications they were assigned to, with the assignment's priority and
+// profile. An assignment that Okta refuses is reported rather than retried
+// without its profile, and the restore is told how many failed.
+type ApplicationGroupsRestorer struct{}
+
+// appGroupAssignment builds the body that assigns a group to an application
+// from a backed up assignment
+func appGroupAssignment(assignment map[string]interface{}) map[string]interface{} {
+	body := make(map[string]interface{})
+	if priority, ok := assignment["priority"]; ok {
+		body["priority"] = priority
+	}
+	if profile, ok := assignment["profile"].(map[string]interface{}); ok && len(profile) > 0 {
+		body["profile"] = profile
+	}
+	return body
+}
+
+func (r *ApplicationGroupsRestorer) Restore(cfg *Config, idMapping *IDMapping, journal *RestoreJournal, inputDir string, opts *RestoreOptions) error {
+	assignmentsDir := filepath.Join(inputDir, "applicationgroups", "listApplicationGroupAssignments")
+	
+	appDirs, err := os.ReadDir(assignmentsDir)
+	if err != nil {
+		return nil
+	}
+	
+	assigned, skipped, failed := 0, 0, 0
+	for _, appDir := range appDirs {
+		oldAppID := appDir.Name()
+		if !appDir.IsDir() || !opts.selects("application", oldAppID) {
+			continue
+		}
+		
+		assignments, err := readResourceObjects(filepath.Join(assignmentsDir, oldAppID))
+		if err != nil || len(assignments) == 0 {
+			continue
+		}
+		
+		newAppID, ok := idMapping.GetNewID("application", oldAppID)
+		if !ok {
+			fmt.Printf("Warning: could not find new ID for application %s, skipping %d group assignment(s)\n", oldAppID, len(assignments))
+			skipped += len(assignments)
+			continue
+		}
+		
+		// Assign in priority order so each group lands on the priority it had
+		for _, oldGroupID := range sortByPriority(assignments) {
+			newGroupID, ok := idMapping.GetNewID("group", oldGroupID)
 			if !ok {
-				fmt.Printf("Warning: could not find new ID for application %s\n", oldAppID)
+				fmt.Printf("Warning: could not find new ID for group %s, cannot assign it to application %s\n", oldGroupID, newAppID)
+				skipped++
 				continue
 			}
 			
-			newGroupID, ok := idMapping.GetNewID("group", oldGroupID)
-			if !ok {
-				fmt.Printf("Warning: could not find new ID for group %s\n", oldGroupID)
+			data, err := json.Marshal(appGroupAssignment(assignments[oldGroupID]))
+			if err != nil {
+				fmt.Printf("Warning: error preparing assignment of group %s: %v\n", newGroupID, err)
+				failed++
 				continue
 			}
 			
 			fmt.Printf("Assigning group %s to application %s...\n", newGroupID, newAppID)
+			if _, err := RunOktaCli(cfg, "applicationGroups", "assignGroupToApplication", 
+				"--appId", newAppID, "--groupId", newGroupID, "--data", string(data)); err != nil {
+				fmt.Printf("Warning: failed to assign group %s to application %s with priority and profile %s: %v\n", 
+					newGroupID, newAppID, data, err)
+				failed++
+				continue
+			}
+			
+			journal.Record("assignGroupToApplication", map[string]string{"appId": newAppID, "groupId": newGroupID})
+			assigned++
+		}
+	}
+	
+	fmt.Printf("Application group assignments: %d assigned, %d skipped, %d failed\n", assigned, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d application group assignment(s) could not be restored", failed)
+	}
+	return nil
+}
+
+// ApplicationUsersRestorer assigns the restored users to the restored
+// applications they were assigned to directly, with their app username and
+// app profile. Assignments a user got through a group come back with the
+// group's assignment and are skipped.
+type ApplicationUsersRestorer struct{}
+
+// appUserAssignment builds the body that assigns a user to an application
+// from a backed up application user
+func appUserAssignment(appUser map[string]interface{}, newUserID string) map[string]interface{} {
+	assignment := map[string]interface{}{"id": newUserID, "scope": "USER"}
+	if userName, ok := lookupJSONPath(appUser, "credentials.userName"); ok {
+		assignment["credentials"] = map[string]interface{}{"userName": userName}
+	}
+	if profile, ok := appUser["profile"].(map[string]interface{}); ok && len(profile) > 0 {
+		assignment["profile"] = profile
+	}
+	return assignment
+}
+
+func (r *ApplicationUsersRestorer) Restore(cfg *Config, idMapping *IDMapping, journal *RestoreJournal, inputDir string, opts *RestoreOptions) error {
+	appUsersDir := filepath.Join(inputDir, "applicationusers", "list")
+	
+	appDirs, err := os.ReadDir(appUsersDir)
+	if err != nil {
+		return nil
+	}
+	
+	for _, appDir := range appDirs {
+		oldAppID := appDir.Name()
+		if !appDir.IsDir() || !opts.selects("application", oldAppID) {
+			continue
+		}
+		
+		appUsers, err := readResourceObjects(filepath.Join(appUsersDir, oldAppID))
+		if err != nil || len(appUsers) == 0 {
+			continue
+		}
+		
+		newAppID, ok := idMapping.GetNewID("application", oldAppID)
+		if !ok {
+			fmt.Printf("Warning: could not find new ID for application %s, skipping user assignments...\n", oldAppID)
+			continue
+		}
+		
+		for oldUserID, appUser := range appUsers {
+			if appUser["scope"] == "GROUP" {
+				continue
+			}
 			
-			cmd := exec.Command("okta-cli-client", PrepareOktaCliArgs(cfg, "applicationGroups", "assignGroupToApplication", 
-				"--appId", newAppID, "--groupId", newGroupID, "--restore-from", filePath)...)
+			newUserID, ok := idMapping.GetNewID("user", oldUserID)
+			if !ok {
+				fmt.Printf("Warning: could not find new ID for user %s, cannot assign it to application %s\n", oldUserID, newAppID)
+				continue
+			}
 			
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
+			data, err := json.Marshal(appUserAssignment(appUser, newUserID))
+			if err != nil {
+				fmt.Printf("Warning: error preparing assignment of user %s: %v\n", newUserID, err)
+				continue
+			}
 			
-			if err := cmd.Run(); err != nil {
-				fmt.Printf("Trying alternative assignment method...\n")
-				cmd = exec.Command("okta-cli-client", PrepareOktaCliArgs(cfg, "applicationGroups", "assignGroupToApplication", 
-					"--appId", newAppID, "--groupId", newGroupID, "--data", "{}")...)
-				
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-				
-				if err := cmd.Run(); err != nil {
-					fmt.Printf("Warning: failed to assign group %s to application %s: %v\n", 
-						newGroupID, newAppID, err)
-				}
+			fmt.Printf("Assigning user %s to application %s...\n", newUserID, newAppID)
+			if _, err := RunOktaCli(cfg, "applicationUsers", "assignUserToApplication", "--appId", newAppID, "--data", string(data)); err != nil {
+				fmt.Printf("Warning: failed to assign user %s to application %s: %v\n", newUserID, newAppID, err)
+				continue
 			}
+			
+			journal.Record("assignUserToApplication", map[string]string{"appId": newAppID, "userId": newUserID})
 		}
 	}
 	
 	return nil
 }
 
-func PerformRestore(cfg *Config, inputDir string) error {
+// RestoreOptions holds the optional settings for a restore
+type RestoreOptions struct {
+	// SkipQuotaCheck disables the dev-org limits preflight
+	SkipQuotaCheck bool
+	// QuotaWarnOnly reports limit overruns without refusing the restore
+	QuotaWarnOnly bool
+	// Limits overrides the default dev-org limit for a resource type
+	Limits map[string]int
+	// Filter limits the restore to matching resource types
+	Filter ResourceFilter
+	// Only limits the restore to individual objects, given as type:id
+	Only []string
+	// UpdateExisting replaces objects the target org already has, matched by
+	// natural key, instead of creating duplicates next to them
+	UpdateExisting bool
+	// DeleteExtras makes a promotion remove objects of the promoted types that
+	// the target org has but the source does not, see PerformPromote
+	DeleteExtras bool
+	// TransformFile rewrites objects before they are restored, see Transform
+	TransformFile string
+	// AppCredentialsFile supplies the OIDC client credentials apps keep, see
+	// LoadAppCredentials
+	AppCredentialsFile string
+	// GenerateKeys gives restored SAML and WS-Fed apps a newly generated
+	// signing key valid for KeyValidityYears, see ApplicationKeysRestorer
+	GenerateKeys bool
+	KeyValidityYears int
+	
+	selection      ObjectSelection
+	appCredentials map[string]SuppliedAppCredentials
+	appReport      *AppCredentialsReport
+	appLogos       map[string]string
+}
+
+// selects reports whether an object from the backup is part of this restore
+func (o *RestoreOptions) selects(resourceType, oldID string) bool {
+	if o == nil || o.selection == nil {
+		return true
+	}
+	return o.selection.Has(resourceType, oldID)
+}
+
+func PerformRestore(cfg *Config, inputDir string, opts *RestoreOptions) error {
+	// The transform and credentials files are checked before any restore
+	// state is written. The mapping and journal stay with the backup; objects
+	// are read from a transformed copy when a transform file is given.
+	sourceDir := inputDir
+	if opts.TransformFile != "" {
+		transform, err := LoadTransform(opts.TransformFile)
+		if err != nil {
+			return err
+		}
+		
+		fmt.Printf("Applying transform %s...\n", opts.TransformFile)
+		sourceDir, err = transform.ApplyToSnapshot(inputDir)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(sourceDir)
+	}
+	
+	if opts.AppCredentialsFile != "" {
+		credentials, err := LoadAppCredentials(opts.AppCredentialsFile)
+		if err != nil {
+			return err
+		}
+		opts.appCredentials = credentials
+	}
+	
 	idMapping := NewIDMapping(inputDir)
 	
 	if err := idMapping.Load(); err != nil {
 		fmt.Println("Creating new ID mapping")
 	}
 	
-	backupConfig := GetBackupConfig()
+	journal := NewRestoreJournal(inputDir)
+	if err := journal.Load(); err != nil {
+		return err
+	}
+	if journal.OrgName != "" && journal.OrgName != cfg.OrgName {
+		return fmt.Errorf("%s was already restored into %s; roll that back before restoring into %s", 
+			inputDir, journal.OrgName, cfg.OrgName)
+	}
+	journal.OrgName = cfg.OrgName
+	journal.Save()
 	
-	fmt.Println("Restoring singleton resources...")
-	if err := restoreSingletonResources(cfg, backupConfig, inputDir); err != nil {
-		fmt.Printf("Warning: Error during singleton resources restore: %v\n", err)
+	// The credentials report stays with the backup too, next to the mapping
+	if opts.appReport == nil {
+		opts.appReport = NewAppCredentialsReport(inputDir, cfg.OrgName)
+	}
+	if err := opts.appReport.Load(); err != nil {
+		return err
+	}
+	
+	// Logos are binary files, so they are read from the backup itself
+	opts.appLogos = loadAppLogos(inputDir)
+	
+	backupConfig := GetBackupConfig().Filter(&opts.Filter)
+	
+	if len(opts.Only) > 0 {
+		selection, err := ResolveOnlySelection(sourceDir, opts.Only)
+		if err != nil {
+			return err
+		}
+		opts.selection = selection
+	}
+	
+	if !opts.SkipQuotaCheck {
+		fmt.Println("Checking target org limits...")
+		if err := CheckRestoreQuota(cfg, backupConfig, sourceDir, opts); err != nil {
+			return err
+		}
+	}
+	
+	if opts.selection == nil {
+		fmt.Println("Restoring singleton resources...")
+		if err := restoreSingletonResources(cfg, backupConfig, sourceDir); err != nil {
+			fmt.Printf("Warning: Error during singleton resources restore: %v\n", err)
+		}
 	}
 	
 	fmt.Println("Restoring first pass resources...")
-	if err := restoreFirstPassResources(cfg, backupConfig, inputDir, idMapping); err != nil {
+	if err := restoreFirstPassResources(cfg, backupConfig, sourceDir, idMapping, journal, opts); err != nil {
 		fmt.Printf("Warning: Error during first pass resources restore: %v\n", err)
 	}
+	if err := opts.appReport.Save(); err != nil {
+		fmt.Printf("Warning: could not save app credentials report: %v\n", err)
+	}
+	opts.appReport.Print()
 	
 	fmt.Println("Restoring second pass resources...")
-	if err := restoreSecondPassResources(cfg, backupConfig, inputDir, idMapping); err != nil {
+	if err := restoreSecondPassResources(cfg, backupConfig, sourceDir, idMapping, opts); err != nil {
 		fmt.Printf("Warning: Error during second pass resources restore: %v\n", err)
 	}
 	
 	fmt.Println("Handling special resource types...")
-	for resourceType, restorer := range customRestorers {
-		fmt.Printf("Restoring %s...\n", resourceType)
-		if err := restorer.Restore(cfg, idMapping, inputDir); err != nil {
-			fmt.Printf("Warning: error restoring %s: %v\n", resourceType, err)
+	for _, restorer := range customRestorers {
+		if restorer.Restorer == nil || !restorerSelected(&opts.Filter, restorer.Type) {
+			continue
+		}
+		
+		fmt.Printf("Restoring %s...\n", restorer.Type)
+		if err := restorer.Restorer.Restore(cfg, idMapping, journal, sourceDir, opts); err != nil {
+			fmt.Printf("Warning: error restoring %s: %v\n", restorer.Type, err)
 		}
 	}
 	
@@ -385,12 +751,18 @@ func restoreSingletonResources(cfg *Config, backupConfig *BackupConfig, inputDir
 	return nil
 }
 
-func restoreFirstPassResources(cfg *Config, backupConfig *BackupConfig, inputDir string, idMapping *IDMapping) error {
+func restoreFirstPassResources(cfg *Config, backupConfig *BackupConfig, inputDir string, idMapping *IDMapping, journal *RestoreJournal, opts *RestoreOptions) error {
 	for _, resource := range backupConfig.FirstPassResources {
 		if resource.ListCommand == "" {
 			continue
 		}
 		
+		// Policies are restored together with their rules by PolicyRestorer,
+		// group rules by GroupRuleRestorer once the groups they use exist
+		if resource.Name == "policy" || resource.ObjectType == "groupRule" {
+			continue
+		}
+		
 		resourceDir := filepath.Join(inputDir, strings.ToLower(resource.Name), "lists")
 		
 		if _, err := os.Stat(resourceDir); os.IsNotExist(err) {
@@ -406,15 +778,57 @@ func restoreFirstPassResources(cfg *Config, backupConfig *BackupConfig, inputDir
 			continue
 		}
 		
+		var existing map[string]string
+		if opts.UpdateExisting {
+			existing, err = liveObjectsByLabel(cfg, resource.Name, resource.ListCommand)
+			if err != nil {
+				fmt.Printf("Warning: could not list existing %s, creating all of them: %v\n", resource.Name, err)
+			}
+		}
+		
 		for _, file := range files {
 			if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
 				filePath := filepath.Join(resourceDir, file.Name())
 				
 				oldID := strings.TrimSuffix(file.Name(), ".json")
+				if !opts.selects(resource.Name, oldID) {
+					continue
+				}
+				
+				if opts.selection != nil {
+					if newID, ok := idMapping.GetNewID(resource.Name, oldID); ok {
+						fmt.Printf("%s %s was already restored as %s, skipping...\n", resource.Name, oldID, newID)
+						continue
+					}
+				}
+				
+				if liveID, ok := existing[backupObjectLabel(filePath)]; ok {
+					fmt.Printf("Updating %s %s in place from previous ID %s...\n", resource.Name, liveID, oldID)
+					
+					if resource.Name == "application" {
+						err = updateApplication(cfg, liveID, filePath, oldID, opts)
+					} else {
+						idFlag := fmt.Sprintf("--%s", getParameterFlagForResource(resource.Name))
+						_, err = RunOktaCli(cfg, resource.Name, "replace", idFlag, liveID, "--restore-from", filePath)
+					}
+					if err != nil {
+						fmt.Printf("Warning: error updating %s %s: %v\n", resource.Name, liveID, err)
+						continue
+					}
+					
+					idMapping.AddMapping(resource.Name, oldID, liveID)
+					journal.Record("updateInPlace", map[string]string{"resource": resource.Name, "id": liveID})
+					continue
+				}
 				
 				fmt.Printf("Restoring %s from previous ID %s...\n", resource.Name, oldID)
 				
-				newID, err := restoreResource(cfg, resource.Name, filePath)
+				var newID string
+				if resource.Name == "application" {
+					newID, err = restoreApplication(cfg, filePath, oldID, opts)
+				} else {
+					newID, err = restoreResource(cfg, resource.Name, filePath)
+				}
 				if err != nil {
 					fmt.Printf("Warning: error restoring %s from %s: %v\n", 
 						resource.Name, oldID, err)
@@ -430,9 +844,19 @@ func restoreFirstPassResources(cfg *Config, backupConfig *BackupConfig, inputDir
 	return nil
 }
 
-func restoreSecondPassResources(cfg *Config, backupConfig *BackupConfig, inputDir string, idMapping *IDMapping) error {
+func restoreSecondPassResources(cfg *Config, backupConfig *BackupConfig, inputDir string, idMapping *IDMapping, opts *RestoreOptions) error {
 	for _, resource := range backupConfig.SecondPassResources {
-		if _, hasCustomHandler := customRestorers[resource.Name]; hasCustomHandler {
+		if _, hasCustomHandler := findCustomRestorer(resource.Name); hasCustomHandler {
+			continue
+		}
+		
+		// The parents of nested entries are second pass objects, whose new
+		// IDs restore does not track, so their children cannot be placed
+		if resource.SourceListCommand != "" {
+			if _, err := os.Stat(filepath.Join(inputDir, strings.ToLower(resource.Name), resource.ListCommand)); err == nil {
+				fmt.Printf("Warning: %s/%s are kept in the backup but cannot be restored, since the new IDs of their %s are not tracked\n", 
+					resource.Name, resource.ListCommand, resource.SourceIDDir)
+			}
 			continue
 		}
 		
@@ -457,6 +881,9 @@ func restoreSecondPassResources(cfg *Config, backupConfig *BackupConfig, inputDi
 		for _, subdir := range subdirs {
 			if subdir.IsDir() {
 				oldSourceID := subdir.Name()
+				if !opts.selects(resource.SourceIDDir, oldSourceID) {
+					continue
+				}
 				
 				newSourceID, ok := idMapping.GetNewID(resource.SourceIDDir, oldSourceID)
 				if !ok {
@@ -472,10 +899,39 @@ func restoreSecondPassResources(cfg *Config, backupConfig *BackupConfig, inputDi
 					continue
 				}
 				
+				var existing map[string]string
+				if opts.UpdateExisting && !isAssignmentResource(resource.Name, resource.ListCommand) {
+					existing, err = liveObjectsByLabel(cfg, resource.Name, resource.ListCommand, 
+						fmt.Sprintf("--%s", sourceIDParam), newSourceID)
+					if err != nil {
+						fmt.Printf("Warning: could not list existing %s for %s %s: %v\n", 
+							resource.Name, resource.SourceIDDir, newSourceID, err)
+					}
+				}
+				
 				for _, file := range files {
 					if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
 						filePath := filepath.Join(subPath, file.Name())
 						
+						if liveID, ok := existing[backupObjectLabel(filePath)]; ok {
+							childFlag := getChildIDFlagForResource(resource.Name, resource.ListCommand)
+							if childFlag == "" {
+								fmt.Printf("%s %s already exists for %s %s, leaving it as is\n", 
+									resource.Name, liveID, resource.SourceIDDir, newSourceID)
+								continue
+							}
+							
+							fmt.Printf("Updating %s %s for %s %s in place...\n", resource.Name, liveID, resource.SourceIDDir, newSourceID)
+							if _, err := RunOktaCli(cfg, resource.Name, "replace", 
+								fmt.Sprintf("--%s", sourceIDParam), newSourceID, 
+								fmt.Sprintf("--%s", childFlag), liveID, 
+								"--restore-from", filePath); err != nil {
+								fmt.Printf("Warning: Failed to update %s %s for %s %s: %v\n", 
+									resource.Name, liveID, resource.SourceIDDir, newSourceID, err)
+							}
+							continue
+						}
+						
 						var cmd *exec.Cmd
 						
 						if isAssignmentResource(resource.Name, resource.ListCommand) {
@@ -508,6 +964,40 @@ func restoreSecondPassResources(cfg *Config, backupConfig *BackupConfig, inputDi
 	return nil
 }
 
+// liveObjectsByLabel lists objects in the target org keyed by natural key, so
+// backup objects can be matched to ones that already exist
+func liveObjectsByLabel(cfg *Config, args ...string) (map[string]string, error) {
+	items, err := RunOktaCliList(cfg, args...)
+	if err != nil {
+		return nil, err
+	}
+	
+	byLabel := make(map[string]string)
+	for _, item := range items {
+		if id, ok := item["id"].(string); ok {
+			byLabel[objectLabel(item)] = id
+		}
+	}
+	
+	return byLabel, nil
+}
+
+// backupObjectLabel returns the natural key of a backed up object, or "" if
+// the file cannot be read
+func backupObjectLabel(filePath string) string {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return ""
+	}
+	
+	var object map[string]interface{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return ""
+	}
+	
+	return objectLabel(object)
+}
+
 func isAssignmentResource(resourceName, listCommand string) bool {
 	assignmentResources := map[string]map[string]bool{
 		"user": {
@@ -546,38 +1036,66 @@ func buildAssignmentCommand(cfg *Config, resourceName, sourceIDParam, sourceID,
 	return nil
 }
 
+// writeTempObject writes an object to a temp file for --restore-from. The
+// caller removes the file.
+func writeTempObject(object interface{}) (string, error) {
+	tmp, err := os.CreateTemp("", "envsync-*.json")
+	if err != nil {
+		return "", fmt.Errorf("could not create temp file: %w", err)
+	}
+	defer tmp.Close()
+	
+	if err := json.NewEncoder(tmp).Encode(object); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("could not write temp file: %w", err)
+	}
+	
+	return tmp.Name(), nil
+}
+
 func restoreResource(cfg *Config, resourceType string, filePath string) (string, error) {
+	response, err := createResource(cfg, resourceType, filePath)
+	if err != nil {
+		return "", err
+	}
+	
+	id, ok := response["id"].(string)
+	if !ok {
+		return "", fmt.Errorf("response does not contain ID field")
+	}
+	
+	return id, nil
+}
+
+// createResource creates an object from a file and returns the object Okta
+// created, for callers that need more of it than the ID
+func createResource(cfg *Config, resourceType string, filePath string) (map[string]interface{}, error) {
 	cmd := exec.Command("okta-cli-client", PrepareOktaCliArgs(cfg, resourceType, "create", "--restore-from", filePath)...)
 	
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return "", fmt.Errorf("error creating stdout pipe: %w", err)
+		return nil, fmt.Errorf("error creating stdout pipe: %w", err)
 	}
 	
 	cmd.Stderr = os.Stderr
 	
 	if err := cmd.Start(); err != nil {
-		return "", fmt.Errorf("error starting command: %w", err)
+		return nil, fmt.Errorf("error starting command: %w", err)
 	}
 	
 	responseData, err := io.ReadAll(stdout)
 	if err != nil {
-		return "", fmt.Errorf("error reading command output: %w", err)
+		return nil, fmt.Errorf("error reading command output: %w", err)
 	}
 	
 	if err := cmd.Wait(); err != nil {
-		return "", fmt.Errorf("command failed: %w", err)
+		return nil, fmt.Errorf("command failed: %w", err)
 	}
 	
 	var response map[string]interface{}
 	if err := json.Unmarshal(responseData, &response); err != nil {
-		return "", fmt.Errorf("error parsing response: %w", err)
-	}
-	
-	id, ok := response["id"].(string)
-	if !ok {
-		return "", fmt.Errorf("response does not contain ID field")
+		return nil, fmt.Errorf("error parsing response: %w", err)
 	}
 	
-	return id, nil
+	return response, nil
 }
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCustomRestorerEntries(t *testing.T) {
+	entries := make(map[string]bool)
+	backupConfig := GetBackupConfig()
+	for _, group := range [][]BackupConfigResource{backupConfig.FirstPassResources, backupConfig.SecondPassResources} {
+		for _, resource := range group {
+			entries[resource.entryName()] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, restorer := range customRestorers {
+		if seen[restorer.Type] {
+			t.Errorf("custom restorer %s is registered twice", restorer.Type)
+		}
+		seen[restorer.Type] = true
+		if !entries[restorer.Entry] {
+			t.Errorf("custom restorer %s restores %s, which is not a registry entry", restorer.Type, restorer.Entry)
+		}
+	}
+}
+
+func TestGroupOwnerRestorer(t *testing.T) {
+	inputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"groupowner/lists/00g1/00u1": {"id": "00u1", "type": "USER", "originType": "OKTA_DIRECTORY"},
+		"groupowner/lists/00g1/00g2": {"id": "00g2", "type": "GROUP", "originType": "OKTA_DIRECTORY"},
+		"groupowner/lists/00g1/00u2": {"id": "00u2", "type": "USER", "originType": "APPLICATION", "originId": "0oa1"},
+		"groupowner/lists/00g1/00u3": {"id": "00u3", "type": "USER"},
+		"groupowner/lists/00g1/00u4": {"id": "00u4", "type": "APP"},
+		"groupowner/lists/00g9/00u1": {"id": "00u1", "type": "USER"},
+	})
+
+	idMapping := NewIDMapping(inputDir)
+	idMapping.AddMapping("group", "00g1", "00gA")
+	idMapping.AddMapping("group", "00g2", "00gB")
+	idMapping.AddMapping("user", "00u1", "00uA")
+	idMapping.AddMapping("user", "00u2", "00uB")
+	idMapping.AddMapping("user", "00u4", "00uD")
+
+	calls := fakeOktaCli(t, map[string]interface{}{
+		`groupOwner assign --groupId 00gA --data {"id":"00uA","type":"USER"}`:  map[string]interface{}{},
+		`groupOwner assign --groupId 00gA --data {"id":"00gB","type":"GROUP"}`: map[string]interface{}{},
+	})
+
+	journal := NewRestoreJournal(inputDir)
+	if err := (&GroupOwnerRestorer{}).Restore(&Config{OrgName: "dev-222"}, idMapping, journal, inputDir, &RestoreOptions{}); err != nil {
+		t.Fatalf("Restore() returned %v", err)
+	}
+
+	// Owners managed by an app, of an unknown type, or never restored are
+	// skipped, and so are the owners of groups that were not restored
+	got := fakeOktaCliCalls(t, calls)
+	sort.Strings(got)
+	want := []string{
+		`groupOwner assign --groupId 00gA --data {"id":"00gB","type":"GROUP"}`,
+		`groupOwner assign --groupId 00gA --data {"id":"00uA","type":"USER"}`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Restore() ran %v, want %v", got, want)
+	}
+
+	var owners []string
+	for _, entry := range journal.Entries {
+		if entry.Action != "assignGroupOwner" || entry.Params["groupId"] != "00gA" {
+			t.Errorf("unexpected journal entry %+v", entry)
+		}
+		owners = append(owners, entry.Params["ownerId"])
+	}
+	sort.Strings(owners)
+	if want := []string{"00gB", "00uA"}; !reflect.DeepEqual(owners, want) {
+		t.Errorf("journaled owners %v, want %v", owners, want)
+	}
+}
+
+func TestApplicationUsersRestorer(t *testing.T) {
+	inputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"applicationusers/list/0oa1/00u1": {"id": "00u1", "scope": "USER", "credentials": map[string]interface{}{"userName": "jane"},
+			"profile": map[string]interface{}{"title": "Engineer"}, "status": "PROVISIONED"},
+		"applicationusers/list/0oa1/00u2": {"id": "00u2", "scope": "USER"},
+		"applicationusers/list/0oa1/00u3": {"id": "00u3", "scope": "GROUP"},
+		"applicationusers/list/0oa1/00u4": {"id": "00u4", "scope": "USER"},
+		"applicationusers/list/0oa9/00u1": {"id": "00u1", "scope": "USER"},
+	})
+
+	idMapping := NewIDMapping(inputDir)
+	idMapping.AddMapping("application", "0oa1", "0oaA")
+	idMapping.AddMapping("user", "00u1", "00uA")
+	idMapping.AddMapping("user", "00u2", "00uB")
+	idMapping.AddMapping("user", "00u3", "00uC")
+
+	calls := fakeOktaCli(t, map[string]interface{}{
+		`applicationUsers assignUserToApplication --appId 0oaA --data {"credentials":{"userName":"jane"},"id":"00uA","profile":{"title":"Engineer"},"scope":"USER"}`: map[string]interface{}{},
+		`applicationUsers assignUserToApplication --appId 0oaA --data {"id":"00uB","scope":"USER"}`:                                                                  map[string]interface{}{},
+	})
+
+	journal := NewRestoreJournal(inputDir)
+	if err := (&ApplicationUsersRestorer{}).Restore(&Config{OrgName: "dev-222"}, idMapping, journal, inputDir, &RestoreOptions{}); err != nil {
+		t.Fatalf("Restore() returned %v", err)
+	}
+
+	// Users assigned through a group, users that were not restored and the
+	// users of apps that were not restored are skipped
+	got := fakeOktaCliCalls(t, calls)
+	sort.Strings(got)
+	want := []string{
+		`applicationUsers assignUserToApplication --appId 0oaA --data {"credentials":{"userName":"jane"},"id":"00uA","profile":{"title":"Engineer"},"scope":"USER"}`,
+		`applicationUsers assignUserToApplication --appId 0oaA --data {"id":"00uB","scope":"USER"}`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Restore() ran %v, want %v", got, want)
+	}
+
+	var users []string
+	for _, entry := range journal.Entries {
+		if entry.Action != "assignUserToApplication" || entry.Params["appId"] != "0oaA" {
+			t.Errorf("unexpected journal entry %+v", entry)
+		}
+		users = append(users, entry.Params["userId"])
+	}
+	sort.Strings(users)
+	if want := []string{"00uA", "00uB"}; !reflect.DeepEqual(users, want) {
+		t.Errorf("journaled users %v, want %v", users, want)
+	}
+}
+
+func TestApplicationGroupsRestorer(t *testing.T) {
+	inputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"applicationgroups/listApplicationGroupAssignments/0oa1/00g1": {"id": "00g1", "priority": float64(1),
+			"profile": map[string]interface{}{"role": "admin", "regions": []interface{}{"eu", "us"}}},
+		"applicationgroups/listApplicationGroupAssignments/0oa1/00g2": {"id": "00g2", "priority": float64(0), "profile": map[string]interface{}{}},
+		"applicationgroups/listApplicationGroupAssignments/0oa1/00g3": {"id": "00g3", "priority": float64(2)},
+		"applicationgroups/listApplicationGroupAssignments/0oa9/00g1": {"id": "00g1", "priority": float64(0)},
+	})
+
+	idMapping := NewIDMapping(inputDir)
+	idMapping.AddMapping("application", "0oa1", "0oaA")
+	idMapping.AddMapping("group", "00g1", "00gA")
+	idMapping.AddMapping("group", "00g2", "00gB")
+
+	assignAdmins := `applicationGroups assignGroupToApplication --appId 0oaA --groupId 00gA --data {"priority":1,"profile":{"regions":["eu","us"],"role":"admin"}}`
+	assignSales := `applicationGroups assignGroupToApplication --appId 0oaA --groupId 00gB --data {"priority":0}`
+
+	tests := []struct {
+		name      string
+		responses map[string]interface{}
+		journaled []string
+		wantErr   string
+	}{
+		{
+			name:      "all assigned",
+			responses: map[string]interface{}{assignAdmins: map[string]interface{}{}, assignSales: map[string]interface{}{}},
+			journaled: []string{"00gB", "00gA"},
+		},
+		{
+			name:      "profile refused",
+			responses: map[string]interface{}{assignSales: map[string]interface{}{}},
+			journaled: []string{"00gB"},
+			wantErr:   "1 application group assignment(s) could not be restored",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := fakeOktaCli(t, test.responses)
+
+			journal := NewRestoreJournal(t.TempDir())
+			err := (&ApplicationGroupsRestorer{}).Restore(&Config{OrgName: "dev-222"}, idMapping, journal, inputDir, &RestoreOptions{})
+			if gotErr := fmt.Sprint(err); (err != nil || test.wantErr != "") && gotErr != test.wantErr {
+				t.Errorf("Restore() returned %v, want %q", err, test.wantErr)
+			}
+
+			// Groups are assigned in priority order, each with its priority
+			// and profile and nothing else, and a refused assignment is not
+			// retried without them; groups and apps not restored are skipped
+			if got, want := fakeOktaCliCalls(t, calls), []string{assignSales, assignAdmins}; !reflect.DeepEqual(got, want) {
+				t.Errorf("Restore() ran %v, want %v", got, want)
+			}
+
+			var journaled []string
+			for _, entry := range journal.Entries {
+				journaled = append(journaled, entry.Params["groupId"])
+			}
+			if !reflect.DeepEqual(journaled, test.journaled) {
+				t.Errorf("journaled groups %v, want %v", journaled, test.journaled)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// journalUndoCommands maps each journaled action to the okta-cli-client
+// command that reverses it
+var journalUndoCommands = map[string]func(params map[string]string) []string{
+	"addUserToGroup": func(params map[string]string) []string {
+		return []string{"group", "unassignUserFromGroup", "--groupId", params["groupId"], "--userId", params["userId"]}
+	},
+	"assignRoleToUser": func(params map[string]string) []string {
+		return []string{"roleAssignment", "unassignRoleFromUser", "--userId", params["userId"], "--roleId", params["roleId"]}
+	},
+	"assignGroupToApplication": func(params map[string]string) []string {
+		return []string{"applicationGroups", "unassignApplicationFromGroup", "--appId", params["appId"], "--groupId", params["groupId"]}
+	},
+	"assignUserToApplication": func(params map[string]string) []string {
+		return []string{"applicationUsers", "unassignUserFromApplication", "--appId", params["appId"], "--userId", params["userId"]}
+	},
+	"assignGroupOwner": func(params map[string]string) []string {
+		return []string{"groupOwner", "delete", "--groupId", params["groupId"], "--ownerId", params["ownerId"]}
+	},
+	"mapResourceToPolicy": func(params map[string]string) []string {
+		return []string{"policy", "deleteResourceMapping", "--policyId", params["policyId"], "--mappingId", params["mappingId"]}
+	},
+	"createPolicyRule": func(params map[string]string) []string {
+		return []string{"policy", "deleteRule", "--policyId", params["policyId"], "--ruleId", params["ruleId"]}
+	},
+}
+
+// rollbackDeleteOrder lists the object types restore creates, dependents
+// first, so rollback never deletes an object another restored one still
+// references: group rules before their groups, apps before the access
+// policies they are mapped to, users before their user types, hooks before
+// their keys and custom domains before their brands
+var rollbackDeleteOrder = []string{
+	"groupRule",
+	"application",
+	"policy",
+	"authorizationServer",
+	"identityProvider",
+	"user",
+	"group",
+	"userType",
+	"inlineHook",
+	"eventHook",
+	"hookKey",
+	"networkZone",
+	"trustedOrigin",
+	"customDomain",
+	"customization",
+	"emailDomain",
+	"template",
+	"feature",
+	"role",
+	"apiToken",
+}
+
+// rollbackOrder sorts the resource types in an ID mapping in
+// rollbackDeleteOrder; types it does not know are deleted last, by name
+func rollbackOrder(idMapping *IDMapping) []string {
+	position := make(map[string]int)
+	for i, resourceType := range rollbackDeleteOrder {
+		position[resourceType] = i
+	}
+	
+	var resourceTypes []string
+	for resourceType := range idMapping.Mappings {
+		resourceTypes = append(resourceTypes, resourceType)
+	}
+	
+	sort.Slice(resourceTypes, func(i, j int) bool {
+		pi, iKnown := position[resourceTypes[i]]
+		pj, jKnown := position[resourceTypes[j]]
+		if iKnown != jKnown {
+			return iKnown
+		}
+		if iKnown && pi != pj {
+			return pi < pj
+		}
+		return resourceTypes[i] < resourceTypes[j]
+	})
+	
+	return resourceTypes
+}
+
+// PerformRollback undoes a restore: it removes the assignments the restore
+// journal recorded, then deletes every object the ID mapping says restore
+// created, and clears the mapping as it goes
+func PerformRollback(cfg *Config, inputDir string, dryRun bool) error {
+	idMapping := NewIDMapping(inputDir)
+	if _, err := os.Stat(idMapping.FilePath); os.IsNotExist(err) {
+		return fmt.Errorf("no ID mapping found in %s, nothing to roll back", inputDir)
+	}
+	if err := idMapping.Load(); err != nil {
+		return err
+	}
+	
+	journal := NewRestoreJournal(inputDir)
+	if err := journal.Load(); err != nil {
+		return err
+	}
+	
+	if journal.OrgName != "" && journal.OrgName != cfg.OrgName {
+		return fmt.Errorf("%s was restored into %s, not %s", inputDir, journal.OrgName, cfg.OrgName)
+	}
+	
+	resourceTypes := rollbackOrder(idMapping)
+	
+	// Objects restore updated in place existed before it and must survive the
+	// rollback; their previous state was not kept, so the update stays
+	updated := make(map[string]map[string]bool)
+	for _, entry := range journal.Entries {
+		if entry.Action != "updateInPlace" {
+			continue
+		}
+		if _, ok := updated[entry.Params["resource"]]; !ok {
+			updated[entry.Params["resource"]] = make(map[string]bool)
+		}
+		updated[entry.Params["resource"]][entry.Params["id"]] = true
+	}
+	
+	fmt.Printf("Rolling back restore of %s in %s...\n", inputDir, cfg.OrgName)
+	for i := len(journal.Entries) - 1; i >= 0; i-- {
+		entry := journal.Entries[i]
+		if entry.Action == "updateInPlace" {
+			fmt.Printf("  keep %s %s (updated in place, not reverted)\n", entry.Params["resource"], entry.Params["id"])
+			continue
+		}
+		fmt.Printf("  undo %s %v\n", entry.Action, entry.Params)
+	}
+	for _, resourceType := range resourceTypes {
+		for oldID, newID := range idMapping.Mappings[resourceType] {
+			if !updated[resourceType][newID] {
+				fmt.Printf("  delete %s %s (restored from %s)\n", resourceType, newID, oldID)
+			}
+		}
+	}
+	
+	if dryRun {
+		fmt.Println("Dry run, nothing was changed")
+		return nil
+	}
+	
+	failures := 0
+	
+	fmt.Println("Removing assignments...")
+	var remaining []JournalEntry
+	for i := len(journal.Entries) - 1; i >= 0; i-- {
+		entry := journal.Entries[i]
+		if entry.Action == "updateInPlace" {
+			// Kept until the rollback succeeds, so a rerun still spares the object
+			remaining = append([]JournalEntry{entry}, remaining...)
+			continue
+		}
+		
+		undo, ok := journalUndoCommands[entry.Action]
+		if !ok {
+			fmt.Printf("Warning: don't know how to undo %s, leaving it in the journal\n", entry.Action)
+			remaining = append([]JournalEntry{entry}, remaining...)
+			continue
+		}
+		
+		if _, err := RunOktaCli(cfg, undo(entry.Params)...); err != nil {
+			fmt.Printf("Warning: failed to undo %s %v: %v\n", entry.Action, entry.Params, err)
+			remaining = append([]JournalEntry{entry}, remaining...)
+			failures++
+		}
+	}
+	journal.Entries = remaining
+	journal.Save()
+	
+	fmt.Println("Deleting restored objects...")
+	for _, resourceType := range resourceTypes {
+		for oldID, newID := range idMapping.Mappings[resourceType] {
+			if updated[resourceType][newID] {
+				delete(idMapping.Mappings[resourceType], oldID)
+				continue
+			}
+			
+			if err := deleteObject(cfg, resourceType, newID); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+				failures++
+				continue
+			}
+			
+			fmt.Printf("Deleted %s %s\n", resourceType, newID)
+			delete(idMapping.Mappings[resourceType], oldID)
+		}
+		
+		if len(idMapping.Mappings[resourceType]) == 0 {
+			delete(idMapping.Mappings, resourceType)
+		}
+		idMapping.Save()
+	}
+	
+	if failures > 0 {
+		return fmt.Errorf("rollback finished with %d failure(s); rerun to retry what is left", failures)
+	}
+	
+	os.Remove(journal.FilePath)
+	
+	fmt.Println("Rollback completed successfully!")
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRollbackOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		types []string
+		want  []string
+	}{
+		{
+			name:  "users before their user types",
+			types: []string{"userType", "user"},
+			want:  []string{"user", "userType"},
+		},
+		{
+			name:  "apps before the policies they are mapped to",
+			types: []string{"policy", "group", "application"},
+			want:  []string{"application", "policy", "group"},
+		},
+		{
+			name:  "group rules before their groups",
+			types: []string{"group", "user", "groupRule"},
+			want:  []string{"groupRule", "user", "group"},
+		},
+		{
+			name:  "authorization servers before their hooks",
+			types: []string{"inlineHook", "hookKey", "authorizationServer"},
+			want:  []string{"authorizationServer", "inlineHook", "hookKey"},
+		},
+		{
+			name:  "unknown types last",
+			types: []string{"zeta", "alpha", "userType"},
+			want:  []string{"userType", "alpha", "zeta"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idMapping := &IDMapping{Mappings: make(map[string]map[string]string)}
+			for _, resourceType := range test.types {
+				idMapping.Mappings[resourceType] = map[string]string{"old": "new"}
+			}
+			if got := rollbackOrder(idMapping); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("rollbackOrder(%v) = %v, want %v", test.types, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRollbackDeleteOrderCoversRegistry(t *testing.T) {
+	known := make(map[string]bool)
+	for _, resourceType := range rollbackDeleteOrder {
+		known[resourceType] = true
+	}
+	for _, resource := range GetBackupConfig().FirstPassResources {
+		if !known[resource.objectType()] {
+			t.Errorf("%s is restored but has no place in rollbackDeleteOrder", resource.objectType())
+		}
+	}
+}
+
+func TestPerformRollback(t *testing.T) {
+	inputDir := t.TempDir()
+	idMapping := NewIDMapping(inputDir)
+	idMapping.AddMapping("userType", "oty1", "otyA")
+	idMapping.AddMapping("user", "00u1", "00uA")
+	idMapping.AddMapping("application", "0oa1", "0oaA")
+	journal := NewRestoreJournal(inputDir)
+	journal.OrgName = "dev-222"
+	journal.Record("assignUserToApplication", map[string]string{"appId": "0oaA", "userId": "00uA"})
+	journal.Record("updateInPlace", map[string]string{"resource": "application", "id": "0oaA"})
+
+	calls := fakeOktaCli(t, map[string]interface{}{
+		"applicationUsers unassignUserFromApplication --appId 0oaA --userId 00uA": map[string]interface{}{},
+		"user deactivate --userId 00uA":                                           map[string]interface{}{},
+		"user delete --userId 00uA":                                               map[string]interface{}{},
+		"userType delete --id otyA":                                               map[string]interface{}{},
+	})
+
+	if err := PerformRollback(&Config{OrgName: "dev-222"}, inputDir, false); err != nil {
+		t.Fatalf("PerformRollback() returned %v", err)
+	}
+
+	want := []string{
+		"applicationUsers unassignUserFromApplication --appId 0oaA --userId 00uA",
+		"user deactivate --userId 00uA",
+		"user delete --userId 00uA",
+		"userType delete --id otyA",
+	}
+	if got := fakeOktaCliCalls(t, calls); !reflect.DeepEqual(got, want) {
+		t.Errorf("PerformRollback() ran %v, want %v", got, want)
+	}
+
+	remaining := NewIDMapping(inputDir)
+	if err := remaining.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining.Mappings) != 0 {
+		t.Errorf("ID mapping after rollback = %v, want it empty", remaining.Mappings)
+	}
+}
+
+func TestPerformRollbackRefusesOtherOrg(t *testing.T) {
+	inputDir := t.TempDir()
+	NewIDMapping(inputDir).AddMapping("user", "00u1", "00uA")
+	journal := NewRestoreJournal(inputDir)
+	journal.OrgName = "dev-222"
+	journal.Save()
+
+	calls := fakeOktaCli(t, map[string]interface{}{})
+	if err := PerformRollback(&Config{OrgName: "dev-333"}, inputDir, false); err == nil {
+		t.Error("PerformRollback() into another org returned no error")
+	}
+	if got := fakeOktaCliCalls(t, calls); len(got) != 0 {
+		t.Errorf("PerformRollback() into another org ran %v", got)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ResourceFilter selects registry entries by resource name or by
+// name/command (e.g. "user/listGroups"), using shell-style globs.
+// An empty include list selects everything that is not excluded.
+type ResourceFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// MatchesName reports whether the filter selects a resource name on its own
+func (f *ResourceFilter) MatchesName(name string) bool {
+	return f.matches([]string{name})
+}
+
+// Matches reports whether the filter selects a registry entry
+func (f *ResourceFilter) Matches(resource BackupConfigResource) bool {
+	return f.matches([]string{resource.Name, resource.entryName()})
+}
+
+func (f *ResourceFilter) matches(keys []string) bool {
+	if f == nil {
+		return true
+	}
+	
+	if len(f.Include) > 0 && !matchesAnyPattern(f.Include, keys) {
+		return false
+	}
+	
+	return !matchesAnyPattern(f.Exclude, keys)
+}
+
+func matchesAnyPattern(patterns, keys []string) bool {
+	for _, pattern := range patterns {
+		for _, key := range keys {
+			if matched, _ := path.Match(pattern, key); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Filter returns a copy of the backup configuration holding only the entries
+// the filter selects
+func (c *BackupConfig) Filter(f *ResourceFilter) *BackupConfig {
+	keep := func(resources []BackupConfigResource) []BackupConfigResource {
+		var kept []BackupConfigResource
+		for _, resource := range resources {
+			if f.Matches(resource) {
+				kept = append(kept, resource)
+			}
+		}
+		return kept
+	}
+	
+	return &BackupConfig{
+		FirstPassResources:  keep(c.FirstPassResources),
+		SecondPassResources: keep(c.SecondPassResources),
+		SingletonResources:  keep(c.SingletonResources),
+	}
+}
+
+// Has reports whether the configuration holds an entry, given as
+// name/command (or name/get command for singletons)
+func (c *BackupConfig) Has(entry string) bool {
+	for _, group := range [][]BackupConfigResource{c.FirstPassResources, c.SecondPassResources, c.SingletonResources} {
+		for _, resource := range group {
+			if resource.entryName() == entry {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ObjectSelection is a set of old IDs per resource type
+type ObjectSelection map[string]map[string]bool
+
+func (s ObjectSelection) Add(resourceType, id string) bool {
+	if _, ok := s[resourceType]; !ok {
+		s[resourceType] = make(map[string]bool)
+	}
+	if s[resourceType][id] {
+		return false
+	}
+	s[resourceType][id] = true
+	return true
+}
+
+func (s ObjectSelection) Has(resourceType, id string) bool {
+	return s[resourceType][id]
+}
+
+// ResolveOnlySelection parses --only references such as user:00u123 and adds
+// the objects each one needs to be restored on its own
+func ResolveOnlySelection(inputDir string, refs []string) (ObjectSelection, error) {
+	known := make(map[string]bool)
+	for _, name := range registryResourceNames(GetBackupConfig()) {
+		known[name] = true
+	}
+	
+	backup := &backupIndex{inputDir: inputDir, dirs: make(map[string]map[string]map[string]interface{})}
+	selection := make(ObjectSelection)
+	for _, ref := range refs {
+		resourceType, id, ok := strings.Cut(ref, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid --only reference %q, expected type:id", ref)
+		}
+		if !known[resourceType] {
+			return nil, fmt.Errorf("unknown resource type %q in --only reference %q", resourceType, ref)
+		}
+		
+		if !backup.has(resourceType, id) {
+			return nil, fmt.Errorf("%s %s is not in the backup at %s", resourceType, id, inputDir)
+		}
+		
+		addWithDependencies(selection, backup, resourceType, id)
+	}
+	
+	return selection, nil
+}
+
+// backupIndex reads the backup directories dependencies are looked up in,
+// each one once
+type backupIndex struct {
+	inputDir string
+	dirs     map[string]map[string]map[string]interface{}
+}
+
+// objects returns the objects in a directory of the backup, by ID
+func (b *backupIndex) objects(elem ...string) map[string]map[string]interface{} {
+	dir := filepath.Join(elem...)
+	if objects, ok := b.dirs[dir]; ok {
+		return objects
+	}
+	
+	objects, _ := readResourceObjects(filepath.Join(b.inputDir, dir))
+	b.dirs[dir] = objects
+	return objects
+}
+
+// has reports whether the backup holds an object of a first pass type
+func (b *backupIndex) has(resourceType, id string) bool {
+	_, ok := b.objects(strings.ToLower(resourceType), "lists")[id]
+	return ok
+}
+
+// addWithDependencies selects an object along with the objects it cannot be
+// restored without: a user's type and groups, a group's owners, and an app's
+// assigned groups and access policy
+func addWithDependencies(selection ObjectSelection, backup *backupIndex, resourceType, id string) {
+	if !selection.Add(resourceType, id) {
+		return
+	}
+	
+	add := func(resourceType, id string) {
+		if id != "" && backup.has(resourceType, id) {
+			addWithDependencies(selection, backup, resourceType, id)
+		}
+	}
+	
+	switch resourceType {
+	case "user":
+		typeID, _ := lookupJSONPath(backup.objects("user", "lists")[id], "type.id")
+		s, _ := typeID.(string)
+		add("userType", s)
+		
+		for groupID, group := range backup.objects("user", "listGroups", id) {
+			if group["type"] == "OKTA_GROUP" {
+				add("group", groupID)
+			}
+		}
+	case "group":
+		for ownerID, owner := range backup.objects("groupowner", "lists", id) {
+			if owner["originType"] == "APPLICATION" {
+				continue
+			}
+			switch owner["type"] {
+			case "USER":
+				add("user", ownerID)
+			case "GROUP":
+				add("group", ownerID)
+			}
+		}
+	case "application":
+		for groupID := range backup.objects("applicationgroups", "listApplicationGroupAssignments", id) {
+			add("group", groupID)
+		}
+		
+		// Okta's default policies are there already and are left alone
+		href, _ := lookupJSONPath(backup.objects("application", "lists")[id], "_links.accessPolicy.href")
+		if s, _ := href.(string); s != "" {
+			policyID := path.Base(strings.TrimSuffix(s, "/"))
+			if system, _ := backup.objects("policy", "lists")[policyID]["system"].(bool); !system {
+				add("policy", policyID)
+			}
+		}
+	}
+}
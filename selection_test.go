@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestBackup lays out objects in a temporary backup directory, keyed by
+// their path relative to it without the .json suffix
+func writeTestBackup(t *testing.T, objects map[string]map[string]interface{}) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, object := range objects {
+		path := filepath.Join(dir, filepath.FromSlash(name)+".json")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestResolveOnlySelection(t *testing.T) {
+	inputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"user/lists/00u1":             {"id": "00u1", "type": map[string]interface{}{"id": "oty1"}},
+		"user/lists/00u2":             {"id": "00u2"},
+		"usertype/lists/oty1":         {"id": "oty1"},
+		"group/lists/00g1":            {"id": "00g1", "type": "OKTA_GROUP"},
+		"group/lists/00g2":            {"id": "00g2", "type": "OKTA_GROUP"},
+		"group/lists/00gapp":          {"id": "00gapp", "type": "APP_GROUP"},
+		"user/listGroups/00u1/00g1":   {"id": "00g1", "type": "OKTA_GROUP"},
+		"user/listGroups/00u1/00gapp": {"id": "00gapp", "type": "APP_GROUP"},
+		"groupowner/lists/00g2/00u2":  {"id": "00u2", "type": "USER"},
+		"groupowner/lists/00g2/0oa9":  {"id": "0oa9", "type": "USER", "originType": "APPLICATION"},
+		"application/lists/0oa1": {"id": "0oa1", "_links": map[string]interface{}{
+			"accessPolicy": map[string]interface{}{"href": "https://dev.okta.com/api/v1/policies/rst1"},
+		}},
+		"application/lists/0oa2": {"id": "0oa2", "_links": map[string]interface{}{
+			"accessPolicy": map[string]interface{}{"href": "https://dev.okta.com/api/v1/policies/rstdefault"},
+		}},
+		"applicationgroups/listApplicationGroupAssignments/0oa1/00g2": {"id": "00g2", "priority": 0},
+		"policy/lists/rst1":       {"id": "rst1", "type": "ACCESS_POLICY"},
+		"policy/lists/rstdefault": {"id": "rstdefault", "type": "ACCESS_POLICY", "system": true},
+	})
+
+	tests := []struct {
+		name    string
+		refs    []string
+		want    ObjectSelection
+		wantErr bool
+	}{
+		{
+			name: "user with its type and okta groups",
+			refs: []string{"user:00u1"},
+			want: ObjectSelection{
+				"user":     {"00u1": true},
+				"userType": {"oty1": true},
+				"group":    {"00g1": true},
+			},
+		},
+		{
+			name: "group with its user owners",
+			refs: []string{"group:00g2"},
+			want: ObjectSelection{
+				"group": {"00g2": true},
+				"user":  {"00u2": true},
+			},
+		},
+		{
+			name: "application with its groups and access policy",
+			refs: []string{"application:0oa1"},
+			want: ObjectSelection{
+				"application": {"0oa1": true},
+				"group":       {"00g2": true},
+				"user":        {"00u2": true},
+				"policy":      {"rst1": true},
+			},
+		},
+		{
+			name: "application on the default policy",
+			refs: []string{"application:0oa2"},
+			want: ObjectSelection{"application": {"0oa2": true}},
+		},
+		{
+			name: "several references",
+			refs: []string{"user:00u2", "group:00g1"},
+			want: ObjectSelection{
+				"user":  {"00u2": true},
+				"group": {"00g1": true},
+			},
+		},
+		{name: "missing id", refs: []string{"user:"}, wantErr: true},
+		{name: "unknown type", refs: []string{"usr:00u1"}, wantErr: true},
+		{name: "not in backup", refs: []string{"user:00u9"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ResolveOnlySelection(inputDir, test.refs)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("ResolveOnlySelection(%v) = %v, want an error", test.refs, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveOnlySelection(%v) returned %v", test.refs, err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ResolveOnlySelection(%v) = %v, want %v", test.refs, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRestorerSelected(t *testing.T) {
+	tests := []struct {
+		filter       ResourceFilter
+		resourceType string
+		want         bool
+	}{
+		{ResourceFilter{}, "user", true},
+		{ResourceFilter{Exclude: []string{"user/listGroups"}}, "user", false},
+		{ResourceFilter{Exclude: []string{"user/lists"}}, "user", true},
+		{ResourceFilter{Include: []string{"user"}}, "user", true},
+		{ResourceFilter{Exclude: []string{"group/listRules"}}, "groupRule", false},
+		{ResourceFilter{Exclude: []string{"roleAssignment"}}, "roleAssignment", false},
+		{ResourceFilter{Include: []string{"application*"}}, "applicationUsers", true},
+		{ResourceFilter{Exclude: []string{"applicationUsers/list"}}, "applicationUsers", false},
+		{ResourceFilter{Exclude: []string{"applicationGroups/*"}}, "applicationGroups", false},
+	}
+
+	for _, test := range tests {
+		if got := restorerSelected(&test.filter, test.resourceType); got != test.want {
+			t.Errorf("restorerSelected(%+v, %q) = %v, want %v", test.filter, test.resourceType, got, test.want)
+		}
+	}
+}
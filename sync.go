@@ -0,0 +1,515 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const syncJournalPrefix = "sync_journal_"
+
+// syncDiffOptions skips the fields Okta assigns itself, which never match
+// between a snapshot and the object it was synced to
+var syncDiffOptions = &DiffOptions{Ignore: []string{"id", "created", "status", "_embedded"}}
+
+// SyncRecord remembers what a snapshot object looked like when it was last
+// synced, and what the target object looked like right after
+type SyncRecord struct {
+	TargetID   string `json:"targetId"`
+	SourceHash string `json:"sourceHash"`
+	TargetHash string `json:"targetHash"`
+}
+
+// SyncJournal records, per target org, which object each snapshot object was
+// synced to, so a repeated sync of an unchanged snapshot does nothing
+type SyncJournal struct {
+	OrgName  string                           `json:"org"`
+	Records  map[string]map[string]SyncRecord `json:"records"`
+	FilePath string                           `json:"-"`
+}
+
+func NewSyncJournal(inputDir, orgName string) *SyncJournal {
+	return &SyncJournal{
+		OrgName:  orgName,
+		Records:  make(map[string]map[string]SyncRecord),
+		FilePath: filepath.Join(inputDir, syncJournalPrefix+orgName+".json"),
+	}
+}
+
+func (j *SyncJournal) Record(resourceType, sourceID string, record SyncRecord) {
+	if _, ok := j.Records[resourceType]; !ok {
+		j.Records[resourceType] = make(map[string]SyncRecord)
+	}
+	j.Records[resourceType][sourceID] = record
+}
+
+// Forget drops every record pointing at a target object, e.g. after deleting it
+func (j *SyncJournal) Forget(resourceType, targetID string) {
+	for sourceID, record := range j.Records[resourceType] {
+		if record.TargetID == targetID {
+			delete(j.Records[resourceType], sourceID)
+		}
+	}
+}
+
+func (j *SyncJournal) Save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling sync journal: %w", err)
+	}
+
+	return os.WriteFile(j.FilePath, data, 0644)
+}
+
+func (j *SyncJournal) Load() error {
+	data, err := os.ReadFile(j.FilePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading sync journal: %w", err)
+	}
+
+	if err := json.Unmarshal(data, j); err != nil {
+		return fmt.Errorf("error parsing sync journal %s: %w", j.FilePath, err)
+	}
+	if j.Records == nil {
+		j.Records = make(map[string]map[string]SyncRecord)
+	}
+	return nil
+}
+
+// SyncOperation is one change sync makes to the target org
+type SyncOperation struct {
+	Action   string `json:"action"`
+	Resource string `json:"resource"`
+	Label    string `json:"label"`
+	SourceID string `json:"sourceId,omitempty"`
+	TargetID string `json:"targetId,omitempty"`
+	// Changes go from the target's current value (Left) to the snapshot's (Right)
+	Changes []FieldChange `json:"changes,omitempty"`
+
+	source map[string]interface{}
+}
+
+// SyncPlan is everything sync would do to make the target match the snapshot
+type SyncPlan struct {
+	Source     string          `json:"source"`
+	Target     string          `json:"target"`
+	Operations []SyncOperation `json:"operations"`
+	Unchanged  int             `json:"unchanged"`
+	// Extra counts the target objects the snapshot does not have, which are
+	// only deleted with SyncOptions.Prune
+	Extra int `json:"extra"`
+
+	// idMap maps snapshot IDs to target IDs across every resource type, to
+	// rewrite references between objects
+	idMap map[string]string
+	// inSync holds matched objects that need no change but are not in the
+	// journal yet
+	inSync []SyncOperation
+}
+
+// Count returns how many operations of one action the plan holds
+func (p *SyncPlan) Count(action string) int {
+	count := 0
+	for _, op := range p.Operations {
+		if op.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// SyncOptions holds the settings for a sync
+type SyncOptions struct {
+	// Filter limits the sync to matching resource types
+	Filter ResourceFilter
+	// Prune deletes the target's objects that the snapshot does not have
+	Prune bool
+	// MaxDeletes refuses any plan that deletes more objects than this
+	MaxDeletes int
+	// DryRun prints the plan without applying it
+	DryRun bool
+}
+
+// hashObject fingerprints an object, leaving out volatile fields
+func hashObject(object map[string]interface{}) string {
+	data, err := json.Marshal(stripIgnored(object, &DiffOptions{}))
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// isReferenceField reports whether a field holds references to other
+// objects: ID fields, and the include and exclude lists of policy and rule
+// conditions
+func isReferenceField(field string) bool {
+	return isIDField(field) || field == "include" || field == "exclude"
+}
+
+// translateIDs rewrites the snapshot IDs in the reference fields of a value
+// to their target IDs. Other strings are left alone even if they happen to
+// equal an ID.
+func translateIDs(value interface{}, idMap map[string]string) interface{} {
+	return translateReferences(value, idMap, false)
+}
+
+func translateReferences(value interface{}, idMap map[string]string, reference bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		if targetID, ok := idMap[v]; ok && reference {
+			return targetID
+		}
+	case []interface{}:
+		translated := make([]interface{}, len(v))
+		for i, item := range v {
+			translated[i] = translateReferences(item, idMap, reference)
+		}
+		return translated
+	case map[string]interface{}:
+		translated := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			translated[key] = translateReferences(item, idMap, isReferenceField(key))
+		}
+		return translated
+	}
+	return value
+}
+
+// PlanSync matches the snapshot's objects with the target org's, by journal,
+// then ID, then natural key, and works out what to create and update. The
+// target's unmatched objects are only planned for deletion with opts.Prune.
+func PlanSync(cfg *Config, inputDir string, journal *SyncJournal, opts *SyncOptions) (*SyncPlan, error) {
+	plan := &SyncPlan{Source: inputDir, Target: cfg.OrgName, idMap: make(map[string]string)}
+	config := GetBackupConfig().Filter(&opts.Filter)
+
+	// A name such as "user" also selects the user's second pass entries, which
+	// are skipped; only an entry asked for by name/command is refused
+	for _, resource := range config.SecondPassResources {
+		if matchesAnyPattern(opts.Filter.Include, []string{resource.entryName()}) {
+			return nil, fmt.Errorf("%s is second pass data, which sync does not handle; use restore for it", resource.entryName())
+		}
+	}
+
+	type pair struct {
+		sourceID string
+		targetID string
+	}
+	type resourceState struct {
+		resource BackupConfigResource
+		source   ResourceSet
+		live     ResourceSet
+		pairs    []pair
+		matched  map[string]bool
+	}
+
+	var states []*resourceState
+	for _, resource := range config.FirstPassResources {
+		// Group rules embed group IDs in expressions and must be inactive to
+		// change, so they are left to restore
+		if resource.ObjectType == "groupRule" {
+			continue
+		}
+
+		source, err := readResourceObjects(filepath.Join(inputDir, strings.ToLower(resource.Name), resource.ListCommand))
+		if err != nil {
+			continue
+		}
+
+		items, err := listResourceObjects(cfg, resource)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s in %s: %w", resource.Name, cfg.OrgName, err)
+		}
+
+		state := &resourceState{resource: resource, source: source, live: resourceSetFromList(resource, items), matched: make(map[string]bool)}
+		liveByLabel := make(map[string]string)
+		for id, object := range state.live {
+			liveByLabel[objectLabel(object)] = id
+		}
+
+		sourceIDs := make([]string, 0, len(source))
+		for id := range source {
+			sourceIDs = append(sourceIDs, id)
+		}
+		sort.Strings(sourceIDs)
+
+		for _, sourceID := range sourceIDs {
+			targetID := ""
+			if record, ok := journal.Records[resource.Name][sourceID]; ok && state.live[record.TargetID] != nil {
+				targetID = record.TargetID
+			} else if state.live[sourceID] != nil {
+				targetID = sourceID
+			} else if id, ok := liveByLabel[objectLabel(source[sourceID])]; ok && !state.matched[id] {
+				targetID = id
+			}
+
+			if targetID != "" {
+				state.matched[targetID] = true
+				plan.idMap[sourceID] = targetID
+			}
+			state.pairs = append(state.pairs, pair{sourceID: sourceID, targetID: targetID})
+		}
+
+		states = append(states, state)
+	}
+
+	deletable := make(map[string]ResetResource)
+	deleteOrder := make(map[string]int)
+	for i, resource := range getResetOrder() {
+		deletable[resource.Name] = resource
+		deleteOrder[resource.Name] = i
+	}
+	// Only a plan that deletes needs to know whose token is running it
+	protected := make(map[string]bool)
+	if opts.Prune {
+		var err error
+		if protected, err = protectedObjects(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	var deletes []SyncOperation
+	for _, state := range states {
+		name := state.resource.Name
+
+		for _, p := range state.pairs {
+			source := state.source[p.sourceID]
+			// Okta's own apps exist in every org and cannot be changed; they
+			// are still matched above so references to them are rewritten
+			if name == "application" && isOktaManagedApp(source) {
+				continue
+			}
+			op := SyncOperation{Resource: name, Label: objectLabel(source), SourceID: p.sourceID, TargetID: p.targetID, source: source}
+
+			if p.targetID == "" {
+				op.Action = "create"
+				plan.Operations = append(plan.Operations, op)
+				continue
+			}
+
+			target := state.live[p.targetID]
+			record, ok := journal.Records[name][p.sourceID]
+			if ok && record.TargetID == p.targetID && record.SourceHash == hashObject(source) && record.TargetHash == hashObject(target) {
+				plan.Unchanged++
+				continue
+			}
+
+			translated := translateIDs(source, plan.idMap)
+			diffValues("", target, translated, syncDiffOptions, &op.Changes)
+			if len(op.Changes) == 0 {
+				plan.Unchanged++
+				plan.inSync = append(plan.inSync, op)
+				continue
+			}
+
+			op.Action = "update"
+			plan.Operations = append(plan.Operations, op)
+		}
+
+		resetResource, ok := deletable[name]
+		if !ok {
+			continue
+		}
+		for id, object := range state.live {
+			if state.matched[id] || protected[id] {
+				continue
+			}
+			if resetResource.IsBuiltIn != nil && resetResource.IsBuiltIn(object) {
+				continue
+			}
+			if !opts.Prune {
+				plan.Extra++
+				continue
+			}
+			deletes = append(deletes, SyncOperation{Action: "delete", Resource: name, Label: objectLabel(object), TargetID: id})
+		}
+	}
+
+	sort.SliceStable(deletes, func(i, j int) bool {
+		if deletes[i].Resource != deletes[j].Resource {
+			return deleteOrder[deletes[i].Resource] < deleteOrder[deletes[j].Resource]
+		}
+		return deletes[i].TargetID < deletes[j].TargetID
+	})
+	plan.Operations = append(plan.Operations, deletes...)
+
+	return plan, nil
+}
+
+// RenderSyncPlan writes a plan as text or json
+func RenderSyncPlan(w io.Writer, plan *SyncPlan, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	case "text", "":
+	default:
+		return fmt.Errorf("unknown output format %q, expected text or json", format)
+	}
+
+	fmt.Fprintf(w, "Sync plan for %s from %s: %d to create, %d to update, %d to delete, %d unchanged\n",
+		plan.Target, plan.Source, plan.Count("create"), plan.Count("update"), plan.Count("delete"), plan.Unchanged)
+
+	symbols := map[string]string{"create": "+", "update": "~", "delete": "-"}
+	for _, op := range plan.Operations {
+		id := op.TargetID
+		if id == "" {
+			id = op.SourceID
+		}
+		fmt.Fprintf(w, "  %s %s %s (%s)\n", symbols[op.Action], op.Resource, op.Label, id)
+		for _, change := range op.Changes {
+			fmt.Fprintf(w, "      %s: %s -> %s\n", change.Path, formatDiffValue(change.Left), formatDiffValue(change.Right))
+		}
+	}
+	if plan.Extra > 0 {
+		fmt.Fprintf(w, "%d object(s) only in %s were left alone, pass --prune to delete them\n", plan.Extra, plan.Target)
+	}
+	return nil
+}
+
+// PerformSync makes the target org's objects of the chosen resource types
+// match a snapshot: creating what is missing, updating what differs and,
+// with opts.Prune, deleting what the snapshot does not have
+func PerformSync(cfg *Config, inputDir string, opts *SyncOptions, format string) error {
+	if _, err := os.Stat(inputDir); err != nil {
+		return fmt.Errorf("cannot read snapshot %s: %w", inputDir, err)
+	}
+
+	journal := NewSyncJournal(inputDir, cfg.OrgName)
+	if err := journal.Load(); err != nil {
+		return err
+	}
+
+	plan, err := PlanSync(cfg, inputDir, journal, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := RenderSyncPlan(os.Stdout, plan, format); err != nil {
+		return err
+	}
+
+	if deletes := plan.Count("delete"); deletes > opts.MaxDeletes {
+		return fmt.Errorf("plan deletes %d objects, more than --max-deletes %d; review it and raise the limit to apply",
+			deletes, opts.MaxDeletes)
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+
+	// Apps are created and updated the way restore does it, so their
+	// credentials and logos are handled and reported the same way
+	apps := &RestoreOptions{appReport: NewAppCredentialsReport(inputDir, cfg.OrgName), appLogos: loadAppLogos(inputDir)}
+	if err := apps.appReport.Load(); err != nil {
+		return err
+	}
+
+	failures := 0
+	for _, op := range plan.Operations {
+		if err := applySyncOperation(cfg, plan, journal, op, apps); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+			failures++
+		}
+		journal.Save()
+	}
+	if err := apps.appReport.Save(); err != nil {
+		fmt.Printf("Warning: could not save app credentials report: %v\n", err)
+	}
+	apps.appReport.Print()
+
+	for _, op := range plan.inSync {
+		journal.Record(op.Resource, op.SourceID, SyncRecord{
+			TargetID:   op.TargetID,
+			SourceHash: hashObject(op.source),
+			TargetHash: fetchTargetHash(cfg, op.Resource, op.TargetID),
+		})
+	}
+	if err := journal.Save(); err != nil {
+		return err
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("sync finished with %d failure(s)", failures)
+	}
+
+	fmt.Println("Sync completed successfully!")
+	return nil
+}
+
+// applySyncOperation carries out one planned operation and journals the result
+func applySyncOperation(cfg *Config, plan *SyncPlan, journal *SyncJournal, op SyncOperation, apps *RestoreOptions) error {
+	if op.Action == "delete" {
+		if err := deleteObject(cfg, op.Resource, op.TargetID); err != nil {
+			return err
+		}
+		journal.Forget(op.Resource, op.TargetID)
+		fmt.Printf("Deleted %s %s (%s)\n", op.Resource, op.TargetID, op.Label)
+		return nil
+	}
+
+	filePath, err := writeTempObject(translateIDs(op.source, plan.idMap))
+	if err != nil {
+		return fmt.Errorf("error preparing %s %s: %w", op.Resource, op.SourceID, err)
+	}
+	defer os.Remove(filePath)
+
+	targetID := op.TargetID
+	switch op.Action {
+	case "create":
+		if op.Resource == "application" {
+			targetID, err = restoreApplication(cfg, filePath, op.SourceID, apps)
+		} else {
+			targetID, err = restoreResource(cfg, op.Resource, filePath)
+		}
+		if err != nil {
+			return fmt.Errorf("error creating %s %s: %w", op.Resource, op.Label, err)
+		}
+		plan.idMap[op.SourceID] = targetID
+		fmt.Printf("Created %s %s (%s)\n", op.Resource, targetID, op.Label)
+	case "update":
+		if op.Resource == "application" {
+			err = updateApplication(cfg, targetID, filePath, op.SourceID, apps)
+		} else {
+			idFlag := fmt.Sprintf("--%s", getParameterFlagForResource(op.Resource))
+			_, err = RunOktaCli(cfg, op.Resource, "replace", idFlag, targetID, "--restore-from", filePath)
+		}
+		if err != nil {
+			return fmt.Errorf("error updating %s %s: %w", op.Resource, targetID, err)
+		}
+		fmt.Printf("Updated %s %s (%s)\n", op.Resource, targetID, op.Label)
+	}
+
+	journal.Record(op.Resource, op.SourceID, SyncRecord{
+		TargetID:   targetID,
+		SourceHash: hashObject(op.source),
+		TargetHash: fetchTargetHash(cfg, op.Resource, targetID),
+	})
+	return nil
+}
+
+// fetchTargetHash reads an object back from the target org and fingerprints
+// it. An empty hash makes the next sync compare the object again.
+func fetchTargetHash(cfg *Config, resourceType, id string) string {
+	idFlag := fmt.Sprintf("--%s", getParameterFlagForResource(resourceType))
+	data, err := RunOktaCli(cfg, resourceType, "get", idFlag, id)
+	if err != nil {
+		return ""
+	}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return ""
+	}
+	return hashObject(object)
+}
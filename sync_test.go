@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeOktaCli puts an okta-cli-client on PATH that prints the JSON given for
+// its arguments (without --config), keyed like "group lists", and fails for
+// anything else. A * in a key matches anything, such as a temporary file.
+// It returns the file each call's arguments are logged to.
+func fakeOktaCli(t *testing.T, responses map[string]interface{}) string {
+	t.Helper()
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls.log")
+
+	script := fmt.Sprintf("#!/bin/sh\nif [ \"$1\" = --config ]; then shift 2; fi\necho \"$*\" >> %q\ncase \"$*\" in\n", calls)
+	i := 0
+	for args, response := range responses {
+		data, err := json.Marshal(response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(dir, fmt.Sprintf("response%d.json", i))
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		var pattern []string
+		for _, part := range strings.Split(args, "*") {
+			pattern = append(pattern, fmt.Sprintf("%q", part))
+		}
+		script += fmt.Sprintf("%s) cat %q ;;\n", strings.Join(pattern, "*"), file)
+		i++
+	}
+	script += "*) echo \"Error: 404 Not Found: $*\" >&2; exit 1 ;;\nesac\n"
+
+	if err := os.WriteFile(filepath.Join(dir, "okta-cli-client"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return calls
+}
+
+// fakeOktaCliCalls returns the arguments of each call logged by fakeOktaCli
+func fakeOktaCliCalls(t *testing.T, calls string) []string {
+	t.Helper()
+	data, err := os.ReadFile(calls)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestPlanSync(t *testing.T) {
+	group := func(id, name, description, groupType string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "type": groupType, "profile": map[string]interface{}{"name": name, "description": description}}
+	}
+
+	inputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"group/lists/00g1": group("00g1", "Engineering", "builds things", "OKTA_GROUP"),
+		"group/lists/00g2": group("00g2", "Sales", "sells things", "OKTA_GROUP"),
+		"group/lists/00g3": group("00g3", "Support", "helps", "OKTA_GROUP"),
+	})
+	fakeOktaCli(t, map[string]interface{}{
+		"group lists": []interface{}{
+			group("00gA", "Engineering", "builds things", "OKTA_GROUP"),
+			group("00gB", "Sales", "sold things", "OKTA_GROUP"),
+			group("00gC", "Marketing", "", "OKTA_GROUP"),
+			group("00gD", "Everyone", "", "BUILT_IN"),
+		},
+		"user get --userId me": map[string]interface{}{"id": "00uAdmin"},
+	})
+	cfg := &Config{OrgName: "dev-222"}
+
+	tests := []struct {
+		name      string
+		prune     bool
+		journal   map[string]SyncRecord
+		want      []SyncOperation
+		unchanged int
+		extra     int
+	}{
+		{
+			name: "create, update and leave extras alone",
+			want: []SyncOperation{
+				{Action: "update", Resource: "group", Label: "Sales", SourceID: "00g2", TargetID: "00gB",
+					Changes: []FieldChange{{Path: "profile.description", Left: "sold things", Right: "sells things"}}},
+				{Action: "create", Resource: "group", Label: "Support", SourceID: "00g3"},
+			},
+			unchanged: 1,
+			extra:     1,
+		},
+		{
+			name:  "prune deletes extras but not built-ins",
+			prune: true,
+			want: []SyncOperation{
+				{Action: "update", Resource: "group", Label: "Sales", SourceID: "00g2", TargetID: "00gB",
+					Changes: []FieldChange{{Path: "profile.description", Left: "sold things", Right: "sells things"}}},
+				{Action: "create", Resource: "group", Label: "Support", SourceID: "00g3"},
+				{Action: "delete", Resource: "group", Label: "Marketing", TargetID: "00gC"},
+			},
+			unchanged: 1,
+		},
+		{
+			name: "journal match wins over label",
+			journal: map[string]SyncRecord{
+				"00g3": {TargetID: "00gC"},
+			},
+			want: []SyncOperation{
+				{Action: "update", Resource: "group", Label: "Sales", SourceID: "00g2", TargetID: "00gB",
+					Changes: []FieldChange{{Path: "profile.description", Left: "sold things", Right: "sells things"}}},
+				{Action: "update", Resource: "group", Label: "Support", SourceID: "00g3", TargetID: "00gC",
+					Changes: []FieldChange{
+						{Path: "profile.description", Left: "", Right: "helps"},
+						{Path: "profile.name", Left: "Marketing", Right: "Support"},
+					}},
+			},
+			unchanged: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			journal := NewSyncJournal(inputDir, cfg.OrgName)
+			if test.journal != nil {
+				journal.Records["group"] = test.journal
+			}
+			opts := &SyncOptions{Filter: ResourceFilter{Include: []string{"group/lists"}}, Prune: test.prune}
+
+			plan, err := PlanSync(cfg, inputDir, journal, opts)
+			if err != nil {
+				t.Fatalf("PlanSync() returned %v", err)
+			}
+			for i := range plan.Operations {
+				plan.Operations[i].source = nil
+			}
+			if !reflect.DeepEqual(plan.Operations, test.want) {
+				t.Errorf("PlanSync() operations = %+v, want %+v", plan.Operations, test.want)
+			}
+			if plan.Unchanged != test.unchanged || plan.Extra != test.extra {
+				t.Errorf("PlanSync() unchanged = %d, extra = %d, want %d, %d", plan.Unchanged, plan.Extra, test.unchanged, test.extra)
+			}
+		})
+	}
+}
+
+func TestTranslateIDs(t *testing.T) {
+	idMap := map[string]string{"00g1": "00gA", "nzo1": "nzoA", "0oa1": "0oaA"}
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{
+			name:  "ID fields",
+			value: map[string]interface{}{"id": "00g1", "groupId": "00g1", "groupIds": []interface{}{"00g1", "00g9"}},
+			want:  map[string]interface{}{"id": "00gA", "groupId": "00gA", "groupIds": []interface{}{"00gA", "00g9"}},
+		},
+		{
+			name: "include and exclude lists",
+			value: map[string]interface{}{"conditions": map[string]interface{}{
+				"people":  map[string]interface{}{"groups": map[string]interface{}{"include": []interface{}{"00g1"}, "exclude": []interface{}{"00g9"}}},
+				"network": map[string]interface{}{"connection": "ZONE", "include": []interface{}{"nzo1"}},
+			}},
+			want: map[string]interface{}{"conditions": map[string]interface{}{
+				"people":  map[string]interface{}{"groups": map[string]interface{}{"include": []interface{}{"00gA"}, "exclude": []interface{}{"00g9"}}},
+				"network": map[string]interface{}{"connection": "ZONE", "include": []interface{}{"nzoA"}},
+			}},
+		},
+		{
+			name:  "objects inside reference lists",
+			value: map[string]interface{}{"include": []interface{}{map[string]interface{}{"type": "APP", "id": "0oa1"}}},
+			want:  map[string]interface{}{"include": []interface{}{map[string]interface{}{"type": "APP", "id": "0oaA"}}},
+		},
+		{
+			name:  "other fields equal to an ID",
+			value: map[string]interface{}{"name": "00g1", "profile": map[string]interface{}{"description": "nzo1"}, "tags": []interface{}{"0oa1"}},
+			want:  map[string]interface{}{"name": "00g1", "profile": map[string]interface{}{"description": "nzo1"}, "tags": []interface{}{"0oa1"}},
+		},
+		{
+			name:  "bare string",
+			value: "00g1",
+			want:  "00g1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := translateIDs(test.value, idMap); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("translateIDs() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRenderSyncPlan(t *testing.T) {
+	plan := &SyncPlan{
+		Source: "snapshot",
+		Target: "dev-222",
+		Operations: []SyncOperation{
+			{Action: "update", Resource: "group", Label: "Sales", TargetID: "00gB",
+				Changes: []FieldChange{{Path: "profile.description", Left: "old", Right: "new"}}},
+		},
+		Extra: 2,
+	}
+
+	var out strings.Builder
+	if err := RenderSyncPlan(&out, plan, "text"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`profile.description: "old" -> "new"`, "2 object(s) only in dev-222 were left alone"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("RenderSyncPlan() = %q, want it to contain %q", out.String(), want)
+		}
+	}
+}
+
+func TestPlanSyncRejectsSecondPassEntries(t *testing.T) {
+	inputDir := writeTestBackup(t, map[string]map[string]interface{}{})
+	fakeOktaCli(t, map[string]interface{}{})
+	cfg := &Config{OrgName: "dev-222"}
+
+	tests := []struct {
+		include []string
+		wantErr bool
+	}{
+		{include: []string{"user/listGroups"}, wantErr: true},
+		{include: []string{"user/*"}, wantErr: true},
+		{include: []string{"user"}, wantErr: false},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.Join(test.include, ","), func(t *testing.T) {
+			opts := &SyncOptions{Filter: ResourceFilter{Include: test.include}}
+			_, err := PlanSync(cfg, inputDir, NewSyncJournal(inputDir, cfg.OrgName), opts)
+			if (err != nil) != test.wantErr {
+				t.Errorf("PlanSync(--include %v) returned %v, want an error %v", test.include, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlanSyncLeavesOktaAppsAlone(t *testing.T) {
+	app := func(id, name, label string, settings map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"id": id, "name": name, "label": label, "settings": settings}
+	}
+
+	inputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"application/lists/0oa1": app("0oa1", "okta_enduser", "Okta Dashboard", map[string]interface{}{"theme": "dark"}),
+		"application/lists/0oa2": app("0oa2", "oidc_client", "Portal", map[string]interface{}{"url": "https://portal.example.com"}),
+	})
+	fakeOktaCli(t, map[string]interface{}{
+		"application lists": []interface{}{
+			app("0oaA", "okta_enduser", "Okta Dashboard", map[string]interface{}{"theme": "light"}),
+			app("0oaB", "oidc_client", "Portal", map[string]interface{}{"url": "https://old.example.com"}),
+		},
+	})
+	cfg := &Config{OrgName: "dev-222"}
+
+	opts := &SyncOptions{Filter: ResourceFilter{Include: []string{"application/lists"}}}
+	plan, err := PlanSync(cfg, inputDir, NewSyncJournal(inputDir, cfg.OrgName), opts)
+	if err != nil {
+		t.Fatalf("PlanSync() returned %v", err)
+	}
+
+	var got []string
+	for _, op := range plan.Operations {
+		got = append(got, op.Action+" "+op.Label)
+	}
+	if want := []string{"update Portal"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PlanSync() operations = %v, want %v", got, want)
+	}
+	if plan.idMap["0oa1"] != "0oaA" {
+		t.Errorf("PlanSync() mapped the Okta app to %q, want 0oaA so references to it are rewritten", plan.idMap["0oa1"])
+	}
+}
+
+func TestPerformSyncApplications(t *testing.T) {
+	inputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"application/lists/0oa1": {"id": "0oa1", "name": "oidc_client", "label": "Portal", "signOnMode": "OPENID_CONNECT",
+			"settings": map[string]interface{}{"url": "https://portal.example.com"}},
+		"application/lists/0oa2": {"id": "0oa2", "name": "bookmark", "label": "Wiki", "signOnMode": "BOOKMARK"},
+	})
+	portal := map[string]interface{}{"id": "0oaA", "name": "oidc_client", "label": "Portal", "signOnMode": "OPENID_CONNECT",
+		"settings":    map[string]interface{}{"url": "https://old.example.com"},
+		"credentials": map[string]interface{}{"oauthClient": map[string]interface{}{"client_id": "target-client"}}}
+	calls := fakeOktaCli(t, map[string]interface{}{
+		"application lists":                                 []interface{}{portal},
+		"application get --appId 0oaA":                      portal,
+		"application replace --appId 0oaA --restore-from *": portal,
+		"application create --restore-from *":               map[string]interface{}{"id": "0oaB", "label": "Wiki", "signOnMode": "BOOKMARK"},
+		"application get --appId 0oaB":                      map[string]interface{}{"id": "0oaB", "label": "Wiki"},
+	})
+	cfg := &Config{OrgName: "dev-222"}
+
+	opts := &SyncOptions{Filter: ResourceFilter{Include: []string{"application/lists"}}}
+	if err := PerformSync(cfg, inputDir, opts, "text"); err != nil {
+		t.Fatalf("PerformSync() returned %v", err)
+	}
+
+	var got []string
+	for _, call := range fakeOktaCliCalls(t, calls) {
+		call, _, _ = strings.Cut(call, " --restore-from")
+		got = append(got, call)
+	}
+	want := []string{
+		"application lists",
+		"application get --appId 0oaA",
+		"application replace --appId 0oaA",
+		"application get --appId 0oaA",
+		"application create",
+		"application get --appId 0oaB",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PerformSync() ran %v, want %v", got, want)
+	}
+
+	report := NewAppCredentialsReport(inputDir, cfg.OrgName)
+	if err := report.Load(); err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string]AppCredentialsEntry)
+	for _, entry := range report.Apps {
+		entries[entry.Label] = entry
+	}
+	if entry := entries["Portal"]; !entry.UpdatedInPlace || entry.NewID != "0oaA" {
+		t.Errorf("report entry for the updated app = %+v, want it updated in place as 0oaA", entry)
+	}
+	if entry := entries["Wiki"]; entry.UpdatedInPlace || entry.OldID != "0oa2" || entry.NewID != "0oaB" {
+		t.Errorf("report entry for the created app = %+v, want 0oa2 created as 0oaB", entry)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const tombstoneDirName = "tombstones"
+
+// Tombstone records an object that was in an earlier snapshot but has since
+// disappeared from the org, so it can be recovered later
+type Tombstone struct {
+	ResourceType     string    `json:"resourceType"`
+	ID               string    `json:"id"`
+	FirstSeenMissing time.Time `json:"firstSeenMissing"`
+	// LastSnapshot is the newest snapshot that still had the object
+	LastSnapshot string                 `json:"lastSnapshot"`
+	LastKnown    map[string]interface{} `json:"lastKnown"`
+	// Children is the second pass data LastSnapshot had for the object
+	// (memberships, role assignments, ...) by registry entry and child ID,
+	// copied since the next backup may be written over that snapshot. A
+	// user's application assignments are under applicationUsers/list by app ID.
+	Children map[string]map[string]map[string]interface{} `json:"children,omitempty"`
+}
+
+// snapshotHistory holds what the previous snapshot of the org contained. It
+// is read before the backup starts because a full backup may be written over
+// the previous snapshot.
+type snapshotHistory struct {
+	previous   *Manifest
+	objects    map[string]map[string]map[string]interface{}
+	tombstones map[string]map[string]*Tombstone
+}
+
+// loadSnapshotHistory reads the previous snapshot of the org: the base of an
+// incremental backup, the snapshot already in the output directory, or the
+// newest snapshot next to it
+func loadSnapshotHistory(cfg *Config, config *BackupConfig, outputDir string, base *Manifest) *snapshotHistory {
+	history := &snapshotHistory{
+		previous:   base,
+		objects:    make(map[string]map[string]map[string]interface{}),
+		tombstones: make(map[string]map[string]*Tombstone),
+	}
+
+	if history.previous == nil {
+		if manifest, err := ReadManifest(outputDir); err == nil && manifest.OrgName == cfg.OrgName {
+			history.previous = manifest
+		} else {
+			history.previous = latestSnapshotBefore(filepath.Dir(filepath.Clean(outputDir)), cfg.OrgName, outputDir)
+		}
+	}
+	if history.previous == nil {
+		return history
+	}
+
+	for _, resource := range config.FirstPassResources {
+		resourceDir := filepath.Join(history.previous.Dir, strings.ToLower(resource.Name), resource.ListCommand)
+		if objects, err := readResourceObjects(resourceDir); err == nil {
+			history.objects[resource.objectType()] = objects
+		}
+	}
+
+	for resourceType, tombstones := range readTombstones(history.previous.Dir) {
+		history.tombstones[resourceType] = tombstones
+	}
+
+	return history
+}
+
+// keepPrevious copies the previous snapshot to <org>-<its start time> next to
+// it when this backup is about to be written over it, so its state stays in
+// the history and the tombstones this backup writes point at a snapshot that
+// still has the deleted objects
+func (h *snapshotHistory) keepPrevious(outputDir string) error {
+	if h.previous == nil || filepath.Clean(h.previous.Dir) != filepath.Clean(outputDir) {
+		return nil
+	}
+
+	kept := *h.previous
+	kept.Dir = filepath.Join(filepath.Dir(filepath.Clean(outputDir)),
+		fmt.Sprintf("%s-%s", kept.OrgName, kept.StartedAt.UTC().Format("20060102T150405")))
+	if _, err := ReadManifest(kept.Dir); err == nil {
+		h.previous = &kept
+		return nil
+	}
+
+	fmt.Printf("Keeping the previous snapshot as %s...\n", kept.Dir)
+	if err := copySnapshot(outputDir, kept.Dir); err != nil {
+		return fmt.Errorf("could not keep the previous snapshot in %s: %w", kept.Dir, err)
+	}
+	if err := WriteManifest(&kept); err != nil {
+		return fmt.Errorf("could not keep the previous snapshot in %s: %w", kept.Dir, err)
+	}
+	h.previous = &kept
+
+	return nil
+}
+
+// readTombstones reads every tombstone in a snapshot, keyed by resource type and ID
+func readTombstones(snapshotDir string) map[string]map[string]*Tombstone {
+	tombstones := make(map[string]map[string]*Tombstone)
+
+	root := filepath.Join(snapshotDir, tombstoneDirName)
+	typeDirs, err := os.ReadDir(root)
+	if err != nil {
+		return tombstones
+	}
+
+	for _, typeDir := range typeDirs {
+		if !typeDir.IsDir() {
+			continue
+		}
+
+		files, err := os.ReadDir(filepath.Join(root, typeDir.Name()))
+		if err != nil {
+			continue
+		}
+
+		for _, file := range files {
+			if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+				continue
+			}
+
+			data, err := os.ReadFile(filepath.Join(root, typeDir.Name(), file.Name()))
+			if err != nil {
+				continue
+			}
+
+			var tombstone Tombstone
+			if err := json.Unmarshal(data, &tombstone); err != nil {
+				continue
+			}
+
+			if _, ok := tombstones[tombstone.ResourceType]; !ok {
+				tombstones[tombstone.ResourceType] = make(map[string]*Tombstone)
+			}
+			tombstones[tombstone.ResourceType][tombstone.ID] = &tombstone
+		}
+	}
+
+	return tombstones
+}
+
+// clearResource removes a resource type's objects from the output directory
+// before it is refetched, so objects deleted from the org do not linger
+func (h *snapshotHistory) clearResource(resource BackupConfigResource, outputDir string) {
+	resourceDir := filepath.Join(outputDir, strings.ToLower(resource.Name), resource.ListCommand)
+
+	ids, _ := getResourceIDsFromDirectory(resourceDir)
+	for _, id := range ids {
+		os.Remove(filepath.Join(resourceDir, id+".json"))
+	}
+}
+
+// restoreResource puts the previous snapshot's objects back after a failed
+// fetch, rather than have the whole resource type look deleted
+func (h *snapshotHistory) restoreResource(resource BackupConfigResource, outputDir string) {
+	resourceDir := filepath.Join(outputDir, strings.ToLower(resource.Name), resource.ListCommand)
+	if err := os.MkdirAll(resourceDir, 0755); err != nil {
+		return
+	}
+
+	for id, object := range h.objects[resource.objectType()] {
+		writeBackupObject(resourceDir, id, object)
+	}
+}
+
+// writeTombstones compares the finished snapshot with the previous one,
+// carrying forward earlier tombstones and adding one for every object that has
+// gone missing since. Only the tombstones of the types this backup covers are
+// replaced; the others are carried forward as they were.
+func (h *snapshotHistory) writeTombstones(config *BackupConfig, outputDir string, now time.Time) (int, error) {
+	root := filepath.Join(outputDir, tombstoneDirName)
+
+	added := 0
+	backedUp := make(map[string]bool)
+	for _, resource := range config.FirstPassResources {
+		resourceType := resource.objectType()
+		backedUp[resourceType] = true
+
+		resourceDir := filepath.Join(outputDir, strings.ToLower(resource.Name), resource.ListCommand)
+		currentIDs, _ := getResourceIDsFromDirectory(resourceDir)
+		current := make(map[string]bool)
+		for _, id := range currentIDs {
+			current[id] = true
+		}
+
+		tombstones := make(map[string]*Tombstone)
+		for id, tombstone := range h.tombstones[resourceType] {
+			if !current[id] {
+				tombstones[id] = tombstone
+			}
+		}
+		for id, object := range h.objects[resourceType] {
+			if current[id] || tombstones[id] != nil {
+				continue
+			}
+			tombstones[id] = &Tombstone{
+				ResourceType:     resourceType,
+				ID:               id,
+				FirstSeenMissing: now,
+				LastSnapshot:     h.previous.Dir,
+				LastKnown:        object,
+				Children:         tombstoneChildren(h.previous.Dir, resourceType, id),
+			}
+			added++
+			fmt.Printf("%s %s (%s) was deleted since the previous snapshot\n", resourceType, id, objectLabel(object))
+		}
+
+		if err := writeTypeTombstones(root, resourceType, tombstones); err != nil {
+			return added, err
+		}
+	}
+
+	for resourceType, tombstones := range h.tombstones {
+		if backedUp[resourceType] {
+			continue
+		}
+		if err := writeTypeTombstones(root, resourceType, tombstones); err != nil {
+			return added, err
+		}
+	}
+
+	return added, nil
+}
+
+// writeTypeTombstones replaces the tombstones of one resource type
+func writeTypeTombstones(root, resourceType string, tombstones map[string]*Tombstone) error {
+	typeDir := filepath.Join(root, strings.ToLower(resourceType))
+	if err := os.RemoveAll(typeDir); err != nil {
+		return fmt.Errorf("could not clear %s: %w", typeDir, err)
+	}
+	if len(tombstones) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(typeDir, 0755); err != nil {
+		return fmt.Errorf("could not create directory %s: %w", typeDir, err)
+	}
+
+	for id, tombstone := range tombstones {
+		data, err := json.MarshalIndent(tombstone, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling tombstone for %s %s: %w", resourceType, id, err)
+		}
+		if err := os.WriteFile(filepath.Join(typeDir, id+".json"), data, 0644); err != nil {
+			return fmt.Errorf("error writing tombstone for %s %s: %w", resourceType, id, err)
+		}
+	}
+
+	return nil
+}
+
+// tombstoneChildren copies the second pass data a snapshot has for a deleted
+// object: its own children, and for a user its assignment to each application
+func tombstoneChildren(snapshotDir, resourceType, id string) map[string]map[string]map[string]interface{} {
+	children := make(map[string]map[string]map[string]interface{})
+
+	for _, resource := range GetBackupConfig().SecondPassResources {
+		if resource.SourceIDDir != resourceType {
+			continue
+		}
+		dir := filepath.Join(snapshotDir, strings.ToLower(resource.Name), resource.ListCommand, id)
+		if objects, err := readResourceObjects(dir); err == nil && len(objects) > 0 {
+			children[resource.entryName()] = objects
+		}
+	}
+
+	if resourceType == "user" {
+		appsDir := filepath.Join(snapshotDir, "applicationusers", "list")
+		appDirs, _ := os.ReadDir(appsDir)
+		for _, appDir := range appDirs {
+			if !appDir.IsDir() {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(appsDir, appDir.Name(), id+".json"))
+			if err != nil {
+				continue
+			}
+			var appUser map[string]interface{}
+			if json.Unmarshal(data, &appUser) != nil {
+				continue
+			}
+			if children["applicationUsers/list"] == nil {
+				children["applicationUsers/list"] = make(map[string]map[string]interface{})
+			}
+			children["applicationUsers/list"][appDir.Name()] = appUser
+		}
+	}
+
+	if len(children) == 0 {
+		return nil
+	}
+	return children
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestWriteTombstones(t *testing.T) {
+	user := func(id, login string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "profile": map[string]interface{}{"login": login}}
+	}
+	earlier := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+
+	previousDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"user/lists/00u1":           user("00u1", "jane@example.com"),
+		"user/lists/00u2":           user("00u2", "john@example.com"),
+		"user/listGroups/00u2/00g1": {"id": "00g1"},
+		// An earlier deletion of a user and of a group
+		"tombstones/user/00u9":  {"resourceType": "user", "id": "00u9", "firstSeenMissing": earlier, "lastKnown": user("00u9", "old@example.com")},
+		"tombstones/group/00g9": {"resourceType": "group", "id": "00g9", "firstSeenMissing": earlier, "lastKnown": map[string]interface{}{"id": "00g9"}},
+		// A user that was deleted and has come back
+		"tombstones/user/00u3": {"resourceType": "user", "id": "00u3", "firstSeenMissing": earlier, "lastKnown": user("00u3", "back@example.com")},
+	})
+	outputDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"user/lists/00u1": user("00u1", "jane@example.com"),
+		"user/lists/00u3": user("00u3", "back@example.com"),
+	})
+
+	config := &BackupConfig{FirstPassResources: []BackupConfigResource{{Name: "user", ListCommand: "lists"}}}
+	history := loadSnapshotHistory(&Config{OrgName: "dev-111"}, config, outputDir, &Manifest{OrgName: "dev-111", Dir: previousDir})
+
+	added, err := history.writeTombstones(config, outputDir, now)
+	if err != nil {
+		t.Fatalf("writeTombstones() returned %v", err)
+	}
+	if added != 1 {
+		t.Errorf("writeTombstones() added %d tombstones, want 1", added)
+	}
+
+	tombstones := readTombstones(outputDir)
+	var got []string
+	for resourceType, byID := range tombstones {
+		for id := range byID {
+			got = append(got, resourceType+"/"+id)
+		}
+	}
+	sort.Strings(got)
+	if want := []string{"group/00g9", "user/00u2", "user/00u9"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("tombstones after the backup = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"new tombstone is seen missing now", tombstones["user"]["00u2"].FirstSeenMissing, now},
+		{"new tombstone points at the previous snapshot", tombstones["user"]["00u2"].LastSnapshot, previousDir},
+		{"new tombstone keeps the memberships", tombstones["user"]["00u2"].Children["user/listGroups"], map[string]map[string]interface{}{"00g1": {"id": "00g1"}}},
+		{"earlier tombstone keeps its date", tombstones["user"]["00u9"].FirstSeenMissing, earlier},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !reflect.DeepEqual(test.got, test.want) {
+				t.Errorf("got %v, want %v", test.got, test.want)
+			}
+		})
+	}
+}
+
+func TestTombstoneChildren(t *testing.T) {
+	snapshotDir := writeTestBackup(t, map[string]map[string]interface{}{
+		"user/listGroups/00u1/00g1":                        {"id": "00g1"},
+		"roleassignment/listAssignedRolesForUser/00u1/ra1": {"id": "ra1", "type": "ORG_ADMIN"},
+		"applicationusers/list/0oa1/00u1":                  {"id": "00u1", "credentials": map[string]interface{}{"userName": "jane"}},
+		"applicationusers/list/0oa2/00u2":                  {"id": "00u2"},
+		"group/listUsers/00g1/00u1":                        {"id": "00u1"},
+	})
+
+	tests := []struct {
+		name         string
+		resourceType string
+		id           string
+		want         []string
+	}{
+		{name: "user", resourceType: "user", id: "00u1", want: []string{"applicationUsers/list", "roleAssignment/listAssignedRolesForUser", "user/listGroups"}},
+		{name: "group", resourceType: "group", id: "00g1", want: []string{"group/listUsers"}},
+		{name: "nothing recorded", resourceType: "user", id: "00u3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			children := tombstoneChildren(snapshotDir, test.resourceType, test.id)
+			var got []string
+			for entry := range children {
+				got = append(got, entry)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("tombstoneChildren(%s %s) has %v, want %v", test.resourceType, test.id, got, test.want)
+			}
+		})
+	}
+
+	if got := tombstoneChildren(snapshotDir, "user", "00u1")["applicationUsers/list"]["0oa1"]["credentials"]; got == nil {
+		t.Error("tombstoneChildren() lost the app username of the user's assignment")
+	}
+}
+
+func TestKeepPrevious(t *testing.T) {
+	startedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		inPlace  bool
+		wantKept bool
+	}{
+		{name: "backup written over the previous snapshot", inPlace: true, wantKept: true},
+		{name: "backup next to the previous snapshot", inPlace: false, wantKept: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parentDir := t.TempDir()
+			previousDir := filepath.Join(parentDir, "dev-111")
+			if err := os.MkdirAll(filepath.Join(previousDir, "user", "lists"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeBackupObject(filepath.Join(previousDir, "user", "lists"), "00u1", map[string]interface{}{"id": "00u1"}); err != nil {
+				t.Fatal(err)
+			}
+			previous := &Manifest{OrgName: "dev-111", StartedAt: startedAt, Dir: previousDir}
+			if err := WriteManifest(previous); err != nil {
+				t.Fatal(err)
+			}
+
+			outputDir := previousDir
+			if !test.inPlace {
+				outputDir = filepath.Join(parentDir, "dev-111-new")
+			}
+			history := &snapshotHistory{previous: previous}
+			if err := history.keepPrevious(outputDir); err != nil {
+				t.Fatalf("keepPrevious() returned %v", err)
+			}
+
+			keptDir := filepath.Join(parentDir, "dev-111-20261001T120000")
+			_, err := os.Stat(filepath.Join(keptDir, "user", "lists", "00u1.json"))
+			if kept := err == nil; kept != test.wantKept {
+				t.Fatalf("keepPrevious() kept a copy = %v, want %v", kept, test.wantKept)
+			}
+			if !test.wantKept {
+				if history.previous.Dir != previousDir {
+					t.Errorf("previous snapshot = %s, want %s", history.previous.Dir, previousDir)
+				}
+				return
+			}
+
+			if history.previous.Dir != keptDir {
+				t.Errorf("previous snapshot = %s, want %s", history.previous.Dir, keptDir)
+			}
+			manifest, err := ReadManifest(keptDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !manifest.StartedAt.Equal(startedAt) {
+				t.Errorf("kept snapshot started at %s, want %s", manifest.StartedAt, startedAt)
+			}
+			snapshots, err := FindSnapshots(parentDir, "dev-111")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(snapshots) != 2 {
+				t.Errorf("FindSnapshots() found %d snapshots, want the kept one and the previous one", len(snapshots))
+			}
+		})
+	}
+}
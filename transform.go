@@ -0,0 +1,424 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envVarPattern matches ${NAME} references in a transform file. Bare $NAME is
+// left alone so regular expressions can still use $ anchors.
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Replacement rewrites every string value containing From, or matching Regex
+type Replacement struct {
+	From  string `yaml:"from"`
+	Regex string `yaml:"regex"`
+	To    string `yaml:"to"`
+
+	re *regexp.Regexp
+}
+
+// TransformRule applies to the resource types its Resource glob matches, by
+// name or name/command as with --include
+type TransformRule struct {
+	Resource string                 `yaml:"resource"`
+	Replace  []Replacement          `yaml:"replace"`
+	Set      map[string]interface{} `yaml:"set"`
+	Delete   []string               `yaml:"delete"`
+}
+
+// Transform rewrites backed up objects before they are restored, so one
+// backup can be restored into environments with different hosts and URLs
+type Transform struct {
+	// Replace applies to every object of every resource type
+	Replace []Replacement   `yaml:"replace"`
+	Rules   []TransformRule `yaml:"rules"`
+}
+
+// LoadTransform reads a transform file (YAML or JSON), substituting ${ENV}
+// references. Every referenced variable must be set.
+func LoadTransform(filePath string) (*Transform, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read transform file: %w", err)
+	}
+
+	var transform Transform
+	if err := yaml.Unmarshal(data, &transform); err != nil {
+		return nil, fmt.Errorf("could not parse transform file %s: %w", filePath, err)
+	}
+
+	missing := make(map[string]bool)
+	expand := func(s string) string {
+		return expandEnvRefs(s, missing)
+	}
+
+	prepare := func(replacements []Replacement) error {
+		for i := range replacements {
+			r := &replacements[i]
+			r.From, r.Regex, r.To = expand(r.From), expand(r.Regex), expand(r.To)
+			switch {
+			case r.Regex != "":
+				re, err := regexp.Compile(r.Regex)
+				if err != nil {
+					return fmt.Errorf("invalid regex %q in %s: %w", r.Regex, filePath, err)
+				}
+				r.re = re
+			case r.From == "":
+				return fmt.Errorf("replacement in %s needs from or regex", filePath)
+			}
+		}
+		return nil
+	}
+
+	if err := prepare(transform.Replace); err != nil {
+		return nil, err
+	}
+	for i := range transform.Rules {
+		rule := &transform.Rules[i]
+		if rule.Resource == "" {
+			return nil, fmt.Errorf("rule %d in %s has no resource", i+1, filePath)
+		}
+		if err := prepare(rule.Replace); err != nil {
+			return nil, err
+		}
+		for path, value := range rule.Set {
+			if _, err := parseJSONPath(path); err != nil {
+				return nil, fmt.Errorf("rule %d in %s: %w", i+1, filePath, err)
+			}
+			rule.Set[path] = expandValue(value, expand)
+		}
+		for _, path := range rule.Delete {
+			segments, err := parseJSONPath(path)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d in %s: %w", i+1, filePath, err)
+			}
+			if isArraySegment(segments[len(segments)-1]) {
+				return nil, fmt.Errorf("rule %d in %s: %s: array elements cannot be deleted, only fields", i+1, filePath, path)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("transform file %s uses unset environment variables: %s",
+			filePath, strings.Join(sortedKeys(missing), ", "))
+	}
+
+	return &transform, nil
+}
+
+// expandEnvRefs replaces ${NAME} references with environment variables,
+// adding the names of unset ones to missing
+func expandEnvRefs(s string, missing map[string]bool) string {
+	return envVarPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envVarPattern.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing[name] = true
+		}
+		return value
+	})
+}
+
+// expandValue applies expand to every string inside a decoded YAML value
+func expandValue(value interface{}, expand func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return expand(v)
+	case []interface{}:
+		for i, item := range v {
+			v[i] = expandValue(item, expand)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = expandValue(item, expand)
+		}
+	}
+	return value
+}
+
+func (r *Replacement) apply(s string) string {
+	if r.re != nil {
+		return r.re.ReplaceAllString(s, r.To)
+	}
+	return strings.ReplaceAll(s, r.From, r.To)
+}
+
+// replaceStrings applies replacements to every string inside a value
+func replaceStrings(value interface{}, replacements []Replacement) interface{} {
+	switch v := value.(type) {
+	case string:
+		for i := range replacements {
+			v = replacements[i].apply(v)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = replaceStrings(item, replacements)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = replaceStrings(item, replacements)
+		}
+	}
+	return value
+}
+
+// jsonPathPartPattern matches one dot-separated part of a path: a field name
+// followed by any number of [n] or [*] array segments
+var jsonPathPartPattern = regexp.MustCompile(`^([^\[\]]*)((?:\[(?:\*|\d+)\])*)$`)
+
+// arraySegmentPattern matches the [n] and [*] segments of one path part
+var arraySegmentPattern = regexp.MustCompile(`\[(?:\*|\d+)\]`)
+
+// parseJSONPath splits a.b[0].c or a.b[*].c (optionally prefixed with $.)
+// into segments. Array segments keep their brackets; a bare numeric segment
+// as in a.b.0.c indexes an array too.
+func parseJSONPath(path string) ([]string, error) {
+	var segments []string
+	for _, part := range strings.Split(strings.TrimPrefix(path, "$."), ".") {
+		match := jsonPathPartPattern.FindStringSubmatch(part)
+		if match == nil || (match[1] == "" && (match[2] == "" || len(segments) == 0)) {
+			return nil, fmt.Errorf("invalid path %q", path)
+		}
+		if match[1] != "" {
+			segments = append(segments, match[1])
+		}
+		segments = append(segments, arraySegmentPattern.FindAllString(match[2], -1)...)
+	}
+	return segments, nil
+}
+
+// arrayIndex returns the element a [n] or bare numeric segment selects
+func arrayIndex(segment string) (int, bool) {
+	index, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(segment, "["), "]"))
+	return index, err == nil
+}
+
+// isArraySegment reports whether a segment can only select array elements
+func isArraySegment(segment string) bool {
+	return strings.HasPrefix(segment, "[")
+}
+
+// setJSONPath sets a value inside an object, creating missing objects along
+// the way. [n] and numeric segments index existing arrays, and [*] sets the
+// value in every element. A path that runs into a missing array, an index
+// past its end or a value that is not an object or array is an error; [*]
+// over a missing or empty array sets nothing.
+func setJSONPath(object map[string]interface{}, path string, value interface{}) error {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return err
+	}
+	return setJSONSegments(object, segments, 0, path, value)
+}
+
+func setJSONSegments(current interface{}, segments []string, i int, path string, value interface{}) error {
+	segment := segments[i]
+	last := i == len(segments)-1
+
+	switch node := current.(type) {
+	case map[string]interface{}:
+		if isArraySegment(segment) {
+			return fmt.Errorf("%s: %s is an object, not an array", path, strings.Join(segments[:i], "."))
+		}
+		if last {
+			node[segment] = value
+			return nil
+		}
+		next, ok := node[segment]
+		if !ok || next == nil {
+			// Objects are only created when no array follows, so a path
+			// that cannot be set leaves the object as it was
+			for _, later := range segments[i+1:] {
+				if later == "[*]" {
+					return nil
+				}
+				if _, ok := arrayIndex(later); ok {
+					return fmt.Errorf("%s: there is no %s array to index", path, strings.Join(segments[:i+1], "."))
+				}
+			}
+			next = make(map[string]interface{})
+			node[segment] = next
+		}
+		return setJSONSegments(next, segments, i+1, path, value)
+	case []interface{}:
+		if segment == "[*]" {
+			for index := range node {
+				if last {
+					node[index] = value
+					continue
+				}
+				if err := setJSONSegments(node[index], segments, i+1, path, value); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		index, ok := arrayIndex(segment)
+		if !ok || index < 0 || index >= len(node) {
+			return fmt.Errorf("%s: no array element %s", path, segment)
+		}
+		if last {
+			node[index] = value
+			return nil
+		}
+		return setJSONSegments(node[index], segments, i+1, path, value)
+	default:
+		return fmt.Errorf("%s: %s is not an object or array", path, strings.Join(segments[:i], "."))
+	}
+}
+
+// deleteJSONPath removes a field from an object, from every element with
+// [*]. Missing fields are ignored; array elements themselves cannot be
+// deleted.
+func deleteJSONPath(object map[string]interface{}, path string) error {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return err
+	}
+	if isArraySegment(segments[len(segments)-1]) {
+		return fmt.Errorf("%s: array elements cannot be deleted, only fields", path)
+	}
+	deleteJSONSegments(object, segments)
+	return nil
+}
+
+func deleteJSONSegments(current interface{}, segments []string) {
+	segment := segments[0]
+
+	switch node := current.(type) {
+	case map[string]interface{}:
+		if len(segments) == 1 {
+			delete(node, segment)
+			return
+		}
+		deleteJSONSegments(node[segment], segments[1:])
+	case []interface{}:
+		if segment == "[*]" {
+			for _, item := range node {
+				deleteJSONSegments(item, segments[1:])
+			}
+			return
+		}
+		if index, ok := arrayIndex(segment); ok && index >= 0 && index < len(node) {
+			deleteJSONSegments(node[index], segments[1:])
+		}
+	}
+}
+
+// Apply rewrites one object of the given registry entry in place
+func (t *Transform) Apply(resource BackupConfigResource, object map[string]interface{}) error {
+	replaceStrings(object, t.Replace)
+
+	for _, rule := range t.Rules {
+		filter := ResourceFilter{Include: []string{rule.Resource}}
+		if !filter.Matches(resource) {
+			continue
+		}
+
+		replaceStrings(object, rule.Replace)
+
+		paths := make([]string, 0, len(rule.Set))
+		for path := range rule.Set {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			if err := setJSONPath(object, path, rule.Set[path]); err != nil {
+				return err
+			}
+		}
+
+		for _, path := range rule.Delete {
+			if err := deleteJSONPath(object, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ApplyToSnapshot copies a backup into a temporary directory with every
+// object transformed, and returns that directory. The caller removes it.
+func (t *Transform) ApplyToSnapshot(inputDir string) (string, error) {
+	workDir, err := os.MkdirTemp("", "envsync-transform-*")
+	if err != nil {
+		return "", fmt.Errorf("could not create working directory: %w", err)
+	}
+
+	if err := copySnapshot(inputDir, workDir); err != nil {
+		os.RemoveAll(workDir)
+		return "", fmt.Errorf("could not copy %s: %w", inputDir, err)
+	}
+
+	config := GetBackupConfig()
+	type entry struct {
+		resource BackupConfigResource
+		nested   bool
+	}
+	var entries []entry
+	for _, resource := range config.FirstPassResources {
+		entries = append(entries, entry{resource: resource})
+	}
+	for _, resource := range config.SingletonResources {
+		entries = append(entries, entry{resource: resource})
+	}
+	for _, resource := range config.SecondPassResources {
+		entries = append(entries, entry{resource: resource, nested: true})
+	}
+
+	transformed := 0
+	for _, e := range entries {
+		command := e.resource.ListCommand
+		if e.resource.IsSingleton {
+			command = e.resource.GetCommand
+		}
+		resourceDir := filepath.Join(workDir, strings.ToLower(e.resource.Name), command)
+
+		dirs := []string{resourceDir}
+		if e.nested {
+			dirs = nil
+			parents, _ := os.ReadDir(resourceDir)
+			for _, parent := range parents {
+				if parent.IsDir() {
+					dirs = append(dirs, filepath.Join(resourceDir, parent.Name()))
+				}
+			}
+		}
+
+		for _, dir := range dirs {
+			objects, err := readResourceObjects(dir)
+			if err != nil {
+				continue
+			}
+			for id, object := range objects {
+				before, _ := json.Marshal(object)
+				if err := t.Apply(e.resource, object); err != nil {
+					os.RemoveAll(workDir)
+					return "", fmt.Errorf("error transforming %s %s: %w", e.resource.Name, id, err)
+				}
+				if after, _ := json.Marshal(object); string(after) == string(before) {
+					continue
+				}
+				if err := writeBackupObject(dir, id, object); err != nil {
+					os.RemoveAll(workDir)
+					return "", err
+				}
+				transformed++
+			}
+		}
+	}
+
+	fmt.Printf("Transformed %d objects\n", transformed)
+	return workDir, nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// decodeJSON decodes a JSON literal the way objects are read from a backup
+func decodeJSON(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &object); err != nil {
+		t.Fatal(err)
+	}
+	return object
+}
+
+func TestSetJSONPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		object  string
+		path    string
+		value   interface{}
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "existing field",
+			object: `{"credentials":{"signing":{"kid":"old"}}}`,
+			path:   "credentials.signing.kid",
+			value:  "new",
+			want:   `{"credentials":{"signing":{"kid":"new"}}}`,
+		},
+		{
+			name:   "missing objects are created",
+			object: `{}`,
+			path:   "$.credentials.signing.kid",
+			value:  "new",
+			want:   `{"credentials":{"signing":{"kid":"new"}}}`,
+		},
+		{
+			name:   "every array element",
+			object: `{"settings":{"oauthClient":{"redirect_uris":["https://a","https://b"]}}}`,
+			path:   "settings.oauthClient.redirect_uris[*]",
+			value:  "https://c",
+			want:   `{"settings":{"oauthClient":{"redirect_uris":["https://c","https://c"]}}}`,
+		},
+		{
+			name:   "field of every array element",
+			object: `{"providers":[{"id":"a"},{"id":"b"}]}`,
+			path:   "providers[*].type",
+			value:  "OKTA",
+			want:   `{"providers":[{"id":"a","type":"OKTA"},{"id":"b","type":"OKTA"}]}`,
+		},
+		{
+			name:   "indexed array element",
+			object: `{"uris":["https://a","https://b"]}`,
+			path:   "uris[1]",
+			value:  "https://c",
+			want:   `{"uris":["https://a","https://c"]}`,
+		},
+		{
+			name:   "numeric segment",
+			object: `{"uris":["https://a","https://b"]}`,
+			path:   "uris.0",
+			value:  "https://c",
+			want:   `{"uris":["https://c","https://b"]}`,
+		},
+		{
+			name:   "wildcard over a missing array",
+			object: `{"settings":{}}`,
+			path:   "settings.oauthClient.redirect_uris[*]",
+			value:  "https://c",
+			want:   `{"settings":{}}`,
+		},
+		{
+			name:    "index into a missing array",
+			object:  `{}`,
+			path:    "uris[0]",
+			value:   "https://c",
+			wantErr: true,
+		},
+		{
+			name:    "numeric segment into a missing array",
+			object:  `{}`,
+			path:    "uris.0",
+			value:   "https://c",
+			wantErr: true,
+		},
+		{
+			name:    "index past the end",
+			object:  `{"uris":["https://a"]}`,
+			path:    "uris[1]",
+			value:   "https://c",
+			wantErr: true,
+		},
+		{
+			name:    "index into an object",
+			object:  `{"settings":{}}`,
+			path:    "settings[0]",
+			value:   "x",
+			wantErr: true,
+		},
+		{
+			name:    "field of a string",
+			object:  `{"label":"Portal"}`,
+			path:    "label.name",
+			value:   "x",
+			wantErr: true,
+		},
+		{
+			name:    "malformed path",
+			object:  `{}`,
+			path:    "uris[x]",
+			value:   "x",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			object := decodeJSON(t, test.object)
+			err := setJSONPath(object, test.path, test.value)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("setJSONPath(%q) = %v, want an error", test.path, object)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setJSONPath(%q) returned %v", test.path, err)
+			}
+			if want := decodeJSON(t, test.want); !reflect.DeepEqual(object, want) {
+				t.Errorf("setJSONPath(%q) = %v, want %v", test.path, object, want)
+			}
+		})
+	}
+}
+
+func TestDeleteJSONPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		object  string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "field",
+			object: `{"credentials":{"oauthClient":{"client_id":"a","client_secret":"b"}}}`,
+			path:   "credentials.oauthClient.client_secret",
+			want:   `{"credentials":{"oauthClient":{"client_id":"a"}}}`,
+		},
+		{
+			name:   "missing field",
+			object: `{"credentials":{}}`,
+			path:   "credentials.oauthClient.client_secret",
+			want:   `{"credentials":{}}`,
+		},
+		{
+			name:   "field of every array element",
+			object: `{"providers":[{"id":"a","type":"OKTA"},{"id":"b"}]}`,
+			path:   "providers[*].type",
+			want:   `{"providers":[{"id":"a"},{"id":"b"}]}`,
+		},
+		{
+			name:   "field of an indexed element",
+			object: `{"providers":[{"id":"a","type":"OKTA"},{"id":"b","type":"OKTA"}]}`,
+			path:   "providers[1].type",
+			want:   `{"providers":[{"id":"a","type":"OKTA"},{"id":"b"}]}`,
+		},
+		{
+			name:    "array element",
+			object:  `{"uris":["https://a"]}`,
+			path:    "uris[0]",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			object := decodeJSON(t, test.object)
+			err := deleteJSONPath(object, test.path)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("deleteJSONPath(%q) = %v, want an error", test.path, object)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("deleteJSONPath(%q) returned %v", test.path, err)
+			}
+			if want := decodeJSON(t, test.want); !reflect.DeepEqual(object, want) {
+				t.Errorf("deleteJSONPath(%q) = %v, want %v", test.path, object, want)
+			}
+		})
+	}
+}
+
+func TestTransformApply(t *testing.T) {
+	application := BackupConfigResource{Name: "application", ListCommand: "lists"}
+	eventHook := BackupConfigResource{Name: "eventHook", ListCommand: "lists"}
+
+	file := filepath.Join(t.TempDir(), "transform.yaml")
+	data := `
+replace:
+  - from: dev-111.okta.com
+    to: dev-222.okta.com
+rules:
+  - resource: application
+    replace:
+      - regex: 'https://localhost:\d+'
+        to: https://${APP_HOST}
+    set:
+      settings.oauthClient.redirect_uris[*]: https://${APP_HOST}/callback
+    delete:
+      - credentials.oauthClient.client_secret
+`
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("APP_HOST", "test.example.com")
+	transform, err := LoadTransform(file)
+	if err != nil {
+		t.Fatalf("LoadTransform() returned %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		resource BackupConfigResource
+		object   string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "rule for the resource",
+			resource: application,
+			object: `{"settings":{"oauthClient":{"initiate_login_uri":"https://localhost:8080/login","redirect_uris":["https://localhost:8080/cb"]}},
+				"credentials":{"oauthClient":{"client_id":"a","client_secret":"b"}},"_links":{"self":{"href":"https://dev-111.okta.com/api/v1/apps/0oa1"}}}`,
+			want: `{"settings":{"oauthClient":{"initiate_login_uri":"https://test.example.com/login","redirect_uris":["https://test.example.com/callback"]}},
+				"credentials":{"oauthClient":{"client_id":"a"}},"_links":{"self":{"href":"https://dev-222.okta.com/api/v1/apps/0oa1"}}}`,
+		},
+		{
+			name:     "app without the fields",
+			resource: application,
+			object:   `{"signOnMode":"SAML_2_0","settings":{}}`,
+			want:     `{"signOnMode":"SAML_2_0","settings":{}}`,
+		},
+		{
+			name:     "other resource types only get top-level replacements",
+			resource: eventHook,
+			object:   `{"channel":{"config":{"uri":"https://localhost:8080/dev-111.okta.com"}}}`,
+			want:     `{"channel":{"config":{"uri":"https://localhost:8080/dev-222.okta.com"}}}`,
+		},
+		{
+			name:     "path that does not resolve",
+			resource: application,
+			object:   `{"settings":{"oauthClient":"none"}}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			object := decodeJSON(t, test.object)
+			err := transform.Apply(test.resource, object)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("Apply() = %v, want an error", object)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() returned %v", err)
+			}
+			if want := decodeJSON(t, test.want); !reflect.DeepEqual(object, want) {
+				t.Errorf("Apply() = %v, want %v", object, want)
+			}
+		})
+	}
+}
+
+func TestLoadTransformRejectsBadPaths(t *testing.T) {
+	tests := []string{
+		"rules:\n  - resource: application\n    set:\n      settings.redirect_uris[x]: a\n",
+		"rules:\n  - resource: application\n    set:\n      settings..label: a\n",
+		"rules:\n  - resource: application\n    delete:\n      - settings.redirect_uris[0]\n",
+	}
+
+	for _, data := range tests {
+		file := filepath.Join(t.TempDir(), "transform.yaml")
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadTransform(file); err == nil {
+			t.Errorf("LoadTransform(%q) returned no error", data)
+		}
+	}
+}